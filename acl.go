@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// permChars maps the textual permission form used by zkCli (rwcda) onto the zk.Perm bits.
+var permChars = []struct {
+	char rune
+	perm int32
+}{
+	{'r', zk.PermRead},
+	{'w', zk.PermWrite},
+	{'c', zk.PermCreate},
+	{'d', zk.PermDelete},
+	{'a', zk.PermAdmin},
+}
+
+// ParsePerms converts the textual permission form (any combination of "rwcda") into zk.Perm bits.
+func ParsePerms(perms string) (int32, error) {
+	var bits int32
+	for _, c := range perms {
+		found := false
+		for _, p := range permChars {
+			if p.char == c {
+				bits |= p.perm
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown permission %q in %q, expected a combination of rwcda", c, perms)
+		}
+	}
+	return bits, nil
+}
+
+// FormatPerms converts zk.Perm bits into their textual form, the inverse of ParsePerms.
+func FormatPerms(bits int32) string {
+	var perms []rune
+	for _, p := range permChars {
+		if bits&p.perm != 0 {
+			perms = append(perms, p.char)
+		}
+	}
+	return string(perms)
+}
+
+// ParseACL converts a single `scheme:id:perms` specification into a zk.ACL. The id may itself contain colons
+// (digest and ip schemes), so the scheme is taken up to the first colon and the perms after the last one.
+func ParseACL(spec string) (zk.ACL, error) {
+	first := strings.Index(spec, ":")
+	last := strings.LastIndex(spec, ":")
+	if first < 0 || first == last {
+		return zk.ACL{}, fmt.Errorf("invalid ACL %q, expected scheme:id:perms", spec)
+	}
+
+	scheme, id, perms := spec[:first], spec[first+1:last], spec[last+1:]
+	if scheme == "" {
+		return zk.ACL{}, fmt.Errorf("invalid ACL %q, scheme is empty", spec)
+	}
+	bits, err := ParsePerms(perms)
+	if err != nil {
+		return zk.ACL{}, err
+	}
+	return zk.ACL{Scheme: scheme, ID: id, Perms: bits}, nil
+}
+
+// FormatACL converts a zk.ACL into its `scheme:id:perms` specification, the inverse of ParseACL.
+func FormatACL(acl zk.ACL) string {
+	return fmt.Sprintf("%s:%s:%s", acl.Scheme, acl.ID, FormatPerms(acl.Perms))
+}
+
+// aclGrants reports whether the ACL may grant `perm` to this session. Only world:anyone entries can be evaluated
+// locally, other schemes (digest, ip, sasl ...) are given the benefit of the doubt and left for the server to
+// enforce. A permission is therefore only denied when no entry of the ACL grants it at all.
+func aclGrants(acl []zk.ACL, perm int32) bool {
+	for _, entry := range acl {
+		if entry.Perms&perm == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// aclCache holds znode ACLs for a limited time, allowing ACLs to be enforced without a GetACL per operation.
+type aclCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]aclCacheEntry
+}
+
+type aclCacheEntry struct {
+	acl     []zk.ACL
+	expires time.Time
+}
+
+func newACLCache(ttl time.Duration) *aclCache {
+	return &aclCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]aclCacheEntry),
+	}
+}
+
+// SetTTL changes how long the ACLs cached from here on are kept.
+func (c *aclCache) SetTTL(ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.ttl = ttl
+}
+
+// get returns the cached ACL of path, if present and not expired.
+func (c *aclCache) get(path string) ([]zk.ACL, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+	if c.now().After(entry.expires) {
+		delete(c.entries, path)
+		return nil, false
+	}
+	return entry.acl, true
+}
+
+func (c *aclCache) put(path string, acl []zk.ACL) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[path] = aclCacheEntry{acl: acl, expires: c.now().Add(c.ttl)}
+}
+
+func (c *aclCache) invalidate(path string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.entries, path)
+}
+
+// checkACL is the guard consulted ahead of read and write operations when ACL checks are enabled. It returns EACCES
+// when the ACL of `path` cannot grant `perm`. Failing to fetch the ACL does not block the operation, which is left
+// to fail (or succeed) on its own.
+func (f *FuseFS) checkACL(ctx context.Context, path string, perm int32) fuse.Status {
+	if !f.ACLCheck {
+		return fuse.OK
+	}
+
+	acl, _, err := f.zh.GetACL(ctx, path)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Debug("unable to fetch ACL, skipping check")
+		return fuse.OK
+	}
+	if !aclGrants(acl, perm) {
+		log.WithFields(log.Fields{
+			"path": path,
+			"perm": perm,
+		}).Warn("denied by znode ACL")
+		return fuse.EACCES
+	}
+	return fuse.OK
+}
+
+// parentPath returns the fuse path of the directory holding `path`.
+func parentPath(path string) string {
+	dir := filepath.Dir(path)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
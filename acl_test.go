@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseACL(t *testing.T) {
+	acl, err := ParseACL("world:anyone:cdrwa")
+	assert.Nil(t, err)
+	assert.Equal(t, zk.ACL{Scheme: "world", ID: "anyone", Perms: zk.PermAll}, acl)
+
+	// digest ids contain a colon of their own.
+	acl, err = ParseACL("digest:user:hash=:r")
+	assert.Nil(t, err)
+	assert.Equal(t, zk.ACL{Scheme: "digest", ID: "user:hash=", Perms: zk.PermRead}, acl)
+
+	_, err = ParseACL("world:anyone")
+	assert.NotNil(t, err)
+	_, err = ParseACL("world:anyone:rwx")
+	assert.NotNil(t, err)
+	_, err = ParseACL(":anyone:r")
+	assert.NotNil(t, err)
+}
+
+func TestFormatACL(t *testing.T) {
+	assert.Equal(t, "world:anyone:rwcda", FormatACL(zk.ACL{Scheme: "world", ID: "anyone", Perms: zk.PermAll}))
+	assert.Equal(t, "digest:user:hash=:r", FormatACL(zk.ACL{Scheme: "digest", ID: "user:hash=", Perms: zk.PermRead}))
+	assert.Equal(t, "ip:10.0.0.1:", FormatACL(zk.ACL{Scheme: "ip", ID: "10.0.0.1"}))
+}
+
+func TestACLCacheExpiry(t *testing.T) {
+	now := time.Now()
+	cache := newACLCache(time.Second)
+	cache.now = func() time.Time { return now }
+
+	_, ok := cache.get("/path")
+	assert.False(t, ok, "empty cache reported a hit")
+
+	cache.put("/path", zk.WorldACL(zk.PermRead))
+	acl, ok := cache.get("/path")
+	assert.True(t, ok)
+	assert.Equal(t, zk.WorldACL(zk.PermRead), acl)
+
+	now = now.Add(2 * time.Second)
+	_, ok = cache.get("/path")
+	assert.False(t, ok, "expired entry reported a hit")
+}
+
+// TestGetACLCached verifies a cached ACL saves the round trip to ZK, and that SetACL invalidates it.
+func TestGetACLCached(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	zh := ZooHandle{zk: mockClient, ZKRoot: "/", FuseMount: "/mnt/fuse", acls: newACLCache(time.Minute)}
+
+	readOnly := zk.WorldACL(zk.PermRead)
+	mockClient.zk.On("GetACL", "/app").Return(readOnly, &zk.Stat{}, nil)
+	mockClient.zk.On("SetACL", "/app", zk.WorldACL(zk.PermAll), int32(-1)).Return(&zk.Stat{}, nil)
+
+	// miss, then hit.
+	acl, _, err := zh.GetACL(ctx, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, readOnly, acl)
+	zh.GetACL(ctx, "app")
+	mockClient.zk.AssertNumberOfCalls(t, "GetACL", 1)
+
+	// changing the ACL drops the cached copy.
+	zh.SetACL(ctx, "app", zk.WorldACL(zk.PermAll), -1)
+	zh.GetACL(ctx, "app")
+	mockClient.zk.AssertNumberOfCalls(t, "GetACL", 2)
+}
+
+// TestCheckACL verifies operations not granted by the znode ACL are refused with EACCES.
+func TestCheckACL(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("GetACL", "secret").Return([]zk.ACL{{Scheme: "world", ID: "anyone", Perms: zk.PermAdmin}}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("GetACL", "readonly").Return(zk.WorldACL(zk.PermRead), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "readonly").Return([]byte("data"), &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, ACLCheck: true}
+
+	_, status := fs.Open("secret", uint32(0), nil)
+	assert.Equal(t, fuse.EACCES, status)
+
+	_, status = fs.Open("readonly", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = fs.Open("readonly", uint32(fuse.O_ANYWRITE), nil)
+	assert.Equal(t, fuse.EACCES, status)
+
+	// checks are skipped entirely when disabled.
+	mockZooKeeper.zk.On("Get", "secret").Return([]byte("data"), &zk.Stat{}, nil)
+	fs.ACLCheck = false
+	_, status = fs.Open("secret", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+}
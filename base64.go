@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+// Base64Suffix names the base64 view of a znode. With the `base64` flag every znode file `name` is accompanied by a
+// `name.b64` sibling, reads of which return the znode data base64 encoded and writes to which are base64 decoded
+// before reaching Zookeeper. This makes binary znodes safe to pipe through shell tools.
+const Base64Suffix = ".b64"
+
+// base64Target returns the znode path presented by the base64 view at `path`.
+func (f *FuseFS) base64Target(path string) (string, bool) {
+	if !f.Base64 || !strings.HasSuffix(path, Base64Suffix) || f.isVirtual(path) {
+		return "", false
+	}
+	target := strings.TrimSuffix(path, Base64Suffix)
+	if target == "" || strings.HasSuffix(target, "/") || strings.HasSuffix(target, ZNodeMarker) {
+		return "", false
+	}
+	return target, true
+}
+
+// base64Entries returns the base64 view entries of the regular files listed in `entries`.
+func base64Entries(entries []fuse.DirEntry) []fuse.DirEntry {
+	var views []fuse.DirEntry
+	for _, entry := range entries {
+		// entries of unknown mode (see LazyModes) may be files, they are given a view too.
+		if (entry.Mode == fuse.S_IFREG || entry.Mode == 0) && entry.Name != ZNodeMarker {
+			views = append(views, fuse.DirEntry{Name: entry.Name + Base64Suffix, Mode: fuse.S_IFREG})
+		}
+	}
+	return views
+}
+
+// base64Attr returns the attributes of the base64 view of `target`, which is always a regular file sized to the
+// encoded data.
+func (f *FuseFS) base64Attr(target string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	attr, status := f.GetAttr(target, context)
+	if !status.Ok() {
+		return nil, status
+	}
+	attr.Mode = fuse.S_IFREG | filePermissions(f.IsReadWrite)
+	attr.Size = uint64(base64.StdEncoding.EncodedLen(int(attr.Size)))
+	return attr, fuse.OK
+}
+
+// openBase64 opens the znode `target`, presenting its data base64 encoded.
+func (f *FuseFS) openBase64(target string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	file, status := f.Open(target, flags, context)
+	if !status.Ok() {
+		return nil, status
+	}
+	ff := file.(*FuseFile)
+	ff.data = []byte(base64.StdEncoding.EncodeToString(ff.data))
+	ff.attr.Size = uint64(len(ff.data))
+	ff.base64 = true
+	// encoded appends cannot be reconciled by concatenation, the offsets handed in by the kernel are used instead.
+	ff.append = false
+	return ff, fuse.OK
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestBase64View verifies the .b64 view encodes on read and decodes on write.
+func TestBase64View(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	binary := []byte{0x00, 0xff, 0x10, 0x80}
+	updated := []byte{0xde, 0xad, 0xbe, 0xef, 0x00}
+	mockZooKeeper.zk.On("Exists", "app/blob").Return(true, &zk.Stat{DataLength: int32(len(binary))}, nil)
+	mockZooKeeper.zk.On("Get", "app/blob").Return(binary, &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Set", "app/blob", updated, int32(1)).Return(&zk.Stat{Version: 2, DataLength: int32(len(updated))}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, Base64: true}
+	encoded := base64.StdEncoding.EncodeToString(binary)
+
+	attr, status := fs.GetAttr("app/blob"+Base64Suffix, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint64(len(encoded)), attr.Size)
+
+	file, status := fs.Open("app/blob"+Base64Suffix, uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, 64)
+	res, _ := file.Read(buf, 0)
+	data, _ := res.Bytes(buf)
+	assert.Equal(t, encoded, string(data))
+
+	content := []byte(base64.StdEncoding.EncodeToString(updated) + "\n")
+	written, status := file.Write(content, 0)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(len(content)), written)
+
+	_, status = file.Write([]byte("not base64!"), 0)
+	assert.Equal(t, fuse.EINVAL, status)
+}
+
+func TestBase64Entries(t *testing.T) {
+	entries := []fuse.DirEntry{
+		{Name: ZNodeMarker, Mode: fuse.S_IFREG},
+		{Name: "blob", Mode: fuse.S_IFREG},
+		{Name: "dir", Mode: fuse.S_IFDIR},
+	}
+	assert.Equal(t, []fuse.DirEntry{{Name: "blob" + Base64Suffix, Mode: fuse.S_IFREG}}, base64Entries(entries))
+
+	// the view only exists when enabled.
+	fs := &FuseFS{}
+	_, ok := fs.base64Target("blob" + Base64Suffix)
+	assert.False(t, ok)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// benchOps lists the Zoohandler operations exercised by the `bench` subcommand, in reporting order.
+var benchOps = []string{"Get", "Set", "Children", "Exists"}
+
+// percentile returns the nearest-rank percentile `p` (0-100) of the timings.
+func percentile(timings []time.Duration, p float64) time.Duration {
+	if len(timings) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, timings...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// benchmark times `ops` rounds of each of the benchOps. Get, Set and Exists target the scratch znode, Children lists
+// its parent.
+func benchmark(ctx context.Context, zh Zoohandler, scratch string, ops int) (map[string][]time.Duration, error) {
+	payload := []byte("zoofuse-bench")
+	calls := map[string]func() error{
+		"Get": func() error {
+			_, _, err := zh.Get(ctx, scratch)
+			return err
+		},
+		"Set": func() error {
+			_, err := zh.Set(ctx, scratch, payload, -1)
+			return err
+		},
+		"Children": func() error {
+			_, _, err := zh.Children(ctx, filepath.Dir(scratch))
+			return err
+		},
+		"Exists": func() error {
+			_, _, err := zh.Exists(ctx, scratch)
+			return err
+		},
+	}
+
+	timings := make(map[string][]time.Duration)
+	for i := 0; i < ops; i++ {
+		for _, op := range benchOps {
+			start := time.Now()
+			if err := calls[op](); err != nil {
+				return nil, fmt.Errorf("%s %s failed: %v", op, scratch, err)
+			}
+			timings[op] = append(timings[op], time.Since(start))
+		}
+	}
+	return timings, nil
+}
+
+// reportBench writes the latency percentiles of each operation.
+func reportBench(out io.Writer, timings map[string][]time.Duration) {
+	fmt.Fprintf(out, "%-10s %8s %12s %12s %12s %12s\n", "op", "count", "p50", "p90", "p99", "max")
+	for _, op := range benchOps {
+		t := timings[op]
+		fmt.Fprintf(out, "%-10s %8d %12s %12s %12s %12s\n", op, len(t),
+			percentile(t, 50), percentile(t, 90), percentile(t, 99), percentile(t, 100))
+	}
+}
+
+// runBench implements the `bench` subcommand, measuring Zookeeper latency as seen through the Zoohandler. A scratch
+// ephemeral znode is created beneath `-path` for the duration of the run, existing data is never modified. The
+// return value is the process exit code.
+func runBench(args []string, out io.Writer) int {
+	cmd := flag.NewFlagSet("bench", flag.ContinueOnError)
+	cmd.SetOutput(out)
+	zkConn := cmd.String("zkconn", "127.0.0.1:2181", "Zookeeper connection string, a comma separated list of host:port servers")
+	zkRoot := cmd.String("zkroot", "/", "Alias the root Zookeeper tree to an alternate path")
+	var auth stringList
+	cmd.Var(&auth, "auth", "Authenticate the session with digest credentials, user:password (repeatable)")
+	ops := cmd.Int("ops", 1000, "Number of rounds of each operation")
+	path := cmd.String("path", "/", "Existing znode beneath which the scratch znode is created")
+	if err := cmd.Parse(args); err != nil {
+		return 2
+	}
+
+	servers, err := ParseZKConn(*zkConn)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	zh, err := NewZooHandler(servers, *zkRoot, "/", auth, DefaultSessionTimeout, false)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	defer zh.Close()
+
+	ctx := context.Background()
+	scratch := filepath.Join(*path, fmt.Sprintf("zoofuse-bench-%d", os.Getpid()))
+	if _, err := zh.Create(ctx, scratch, nil, zk.FlagEphemeral, zk.WorldACL(zk.PermAll)); err != nil {
+		fmt.Fprintf(out, "unable to create scratch znode %s: %v\n", scratch, err)
+		return 1
+	}
+	defer zh.Delete(ctx, scratch, -1)
+
+	timings, err := benchmark(ctx, zh, scratch, *ops)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	reportBench(out, timings)
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPercentile(t *testing.T) {
+	var timings []time.Duration
+	// shuffled 1ms..100ms
+	for i := 100; i > 0; i-- {
+		timings = append(timings, time.Duration((i*37)%100+1)*time.Millisecond)
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentile(timings, 50))
+	assert.Equal(t, 90*time.Millisecond, percentile(timings, 90))
+	assert.Equal(t, 99*time.Millisecond, percentile(timings, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(timings, 100))
+	assert.Equal(t, 1*time.Millisecond, percentile(timings, 0))
+
+	// nearest rank over a small sample.
+	small := []time.Duration{3 * time.Second, 1 * time.Second, 2 * time.Second}
+	assert.Equal(t, 2*time.Second, percentile(small, 50))
+	assert.Equal(t, 3*time.Second, percentile(small, 99))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
+
+func TestBenchmark(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "/test/scratch").Return([]byte{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Set", "/test/scratch", mock.Anything, int32(-1)).Return(&zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Children", "/test").Return([]string{"scratch"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "/test/scratch").Return(true, &zk.Stat{}, nil)
+
+	timings, err := benchmark(ctx, mockZooKeeper, "/test/scratch", 5)
+	assert.Nil(t, err)
+	for _, op := range benchOps {
+		assert.Len(t, timings[op], 5, op)
+	}
+
+	var out bytes.Buffer
+	reportBench(&out, timings)
+	assert.Contains(t, out.String(), "p99")
+	assert.Contains(t, out.String(), "Children")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// bootstrap creates the znodes of the `template` dump beneath the mount root, provided the root holds no children
+// yet. The reserved /zookeeper tree found at the root of every ensemble does not count as a child. It reports whether
+// the template was applied, a populated tree is left untouched.
+func bootstrap(ctx context.Context, zh Zoohandler, template *Dump) (bool, error) {
+	children, _, err := zh.Children(ctx, "")
+	if err != nil {
+		return false, fmt.Errorf("unable to list the root: %v", err)
+	}
+	for _, child := range children {
+		if child != "zookeeper" {
+			return false, nil
+		}
+	}
+	return true, restoreDump(ctx, zh, template)
+}
+
+// restoreDump creates the znodes of `dump`, parents first. Ancestors missing from the dump are created empty, and
+// the data of the root is set when the dump holds it.
+func restoreDump(ctx context.Context, zh Zoohandler, dump *Dump) error {
+	nodes := append([]DumpNode{}, dump.Nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Path < nodes[j].Path })
+
+	created := map[string]bool{"": true}
+	for _, node := range nodes {
+		data, err := node.Bytes()
+		if err != nil {
+			return fmt.Errorf("node %s: %v", node.Path, err)
+		}
+		acl := zk.WorldACL(zk.PermAll)
+		if len(node.ACL) > 0 {
+			acl = nil
+			for _, spec := range node.ACL {
+				entry, err := ParseACL(spec)
+				if err != nil {
+					return fmt.Errorf("node %s: %v", node.Path, err)
+				}
+				acl = append(acl, entry)
+			}
+		}
+
+		path := cleanPath(node.Path)
+		if path == "" {
+			if _, err := zh.Set(ctx, path, data, -1); err != nil {
+				return fmt.Errorf("unable to set the root data: %v", err)
+			}
+			continue
+		}
+
+		parts := strings.Split(path, "/")
+		for i := 1; i < len(parts); i++ {
+			ancestor := strings.Join(parts[:i], "/")
+			if created[ancestor] {
+				continue
+			}
+			if _, err := zh.Create(ctx, ancestor, []byte{}, 0, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+				return fmt.Errorf("unable to create %s: %v", dumpPath(ancestor), err)
+			}
+			created[ancestor] = true
+		}
+		if _, err := zh.Create(ctx, path, data, 0, acl); err != nil {
+			return fmt.Errorf("unable to create %s: %v", node.Path, err)
+		}
+		created[path] = true
+		log.WithFields(log.Fields{
+			"path": node.Path,
+		}).Debug("restored znode")
+	}
+	return nil
+}
+
+// applyBootstrap applies the `-bootstrap` template before the handler is served, a failure is fatal as the mount
+// would otherwise present a partial tree.
+func applyBootstrap(zh Zoohandler, template *Dump) {
+	applied, err := bootstrap(context.Background(), zh, template)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Fatal("Failed to bootstrap the znode tree")
+	}
+	if applied {
+		log.WithFields(log.Fields{
+			"znodes": len(template.Nodes),
+		}).Info("bootstrapped empty znode tree from template")
+		return
+	}
+	log.Info("znode tree is populated, skipping bootstrap")
+}
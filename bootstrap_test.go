@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const bootstrapTemplate = `{"nodes": [
+	{"path": "/app/config", "data": "key=value"},
+	{"path": "/app"},
+	{"path": "/locks/deep/lock", "acl": ["world:anyone:r"]}
+]}`
+
+// TestBootstrap verifies the template populates an empty tree (holding only the reserved /zookeeper tree), parents
+// first and with missing ancestors created empty.
+func TestBootstrap(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	var created []string
+	mockZooKeeper.zk.On("Children", "").Return([]string{"zookeeper"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Create", "app", []byte{}, int32(0), zk.WorldACL(zk.PermAll)).Return("/app", nil)
+	mockZooKeeper.zk.On("Create", "app/config", []byte("key=value"), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/config", nil)
+	mockZooKeeper.zk.On("Create", "locks", []byte{}, int32(0), zk.WorldACL(zk.PermAll)).Return("/locks", nil)
+	mockZooKeeper.zk.On("Create", "locks/deep", []byte{}, int32(0), zk.WorldACL(zk.PermAll)).Return("/locks/deep", nil)
+	mockZooKeeper.zk.On("Create", "locks/deep/lock", []byte{}, int32(0), zk.WorldACL(zk.PermRead)).Return("/locks/deep/lock", nil)
+	for _, call := range mockZooKeeper.zk.ExpectedCalls {
+		if call.Method == "Create" {
+			call.Run(func(args mock.Arguments) { created = append(created, args.String(0)) })
+		}
+	}
+
+	template, err := ParseDump(strings.NewReader(bootstrapTemplate))
+	assert.Nil(t, err)
+	applied, err := bootstrap(ctx, mockZooKeeper, template)
+	assert.Nil(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, []string{"app", "app/config", "locks", "locks/deep", "locks/deep/lock"}, created)
+}
+
+// TestBootstrapPopulated verifies a tree holding znodes is left untouched.
+func TestBootstrapPopulated(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "").Return([]string{"existing"}, &zk.Stat{}, nil)
+
+	template, err := ParseDump(strings.NewReader(bootstrapTemplate))
+	assert.Nil(t, err)
+	applied, err := bootstrap(ctx, mockZooKeeper, template)
+	assert.Nil(t, err)
+	assert.False(t, applied)
+	mockZooKeeper.zk.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
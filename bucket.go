@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// ParseBucketRule builds a PathRule from the `pattern=prefixlen` form accepted by the `-bucket` flag. The children
+// of directories matching the pattern are presented in subdirectories (buckets) named by the first `prefixlen`
+// characters of the child name, keeping listings of huge directories tractable.
+func ParseBucketRule(rule string) (PathRule, error) {
+	r, err := ParsePathRule(rule)
+	if err != nil {
+		return PathRule{}, err
+	}
+	if n, err := strconv.Atoi(r.Value); err != nil || n < 1 {
+		return PathRule{}, fmt.Errorf("invalid prefix length in bucket rule %q, expected a positive integer", rule)
+	}
+	return r, nil
+}
+
+// bucketPrefixLen returns the prefix length the children of `dir` are bucketed by, if any.
+func (f *FuseFS) bucketPrefixLen(dir string) (int, bool) {
+	if dir == "" {
+		return 0, false
+	}
+	rule, ok := matchRule(f.pathRules(&f.Buckets), dir)
+	if !ok {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(rule.Value)
+	return n, true
+}
+
+// bucketName returns the name of the bucket `name` is presented in.
+func bucketName(name string, prefixLen int) string {
+	runes := []rune(name)
+	if len(runes) <= prefixLen {
+		return name
+	}
+	return string(runes[:prefixLen])
+}
+
+// bucket reports whether `path` is a bucket, returning the bucketed directory and the bucket name.
+func (f *FuseFS) bucket(path string) (string, string, bool) {
+	dir, name := f.unbucket(parentPath(path)), filepath.Base(path)
+	if _, ok := f.bucketPrefixLen(dir); !ok || name == ZNodeMarker {
+		return "", "", false
+	}
+	return dir, name, true
+}
+
+// unbucket maps a path reached through buckets onto the znode it presents, dropping every bucket it passes through
+// so the subtrees of bucketed children are reachable too. Other paths are returned unchanged.
+func (f *FuseFS) unbucket(path string) string {
+	parts := strings.Split(path, "/")
+	mapped := make([]string, 0, len(parts))
+	for i := 0; i < len(parts); i++ {
+		mapped = append(mapped, parts[i])
+		if _, ok := f.bucketPrefixLen(strings.Join(mapped, "/")); !ok || i+2 >= len(parts) {
+			continue
+		}
+		// the next component is a bucket when the child following it is named after it.
+		if name := parts[i+1]; name != ZNodeMarker && strings.HasPrefix(parts[i+2], name) {
+			i++
+		}
+	}
+	return strings.Join(mapped, "/")
+}
+
+// bucketChildren returns the children of the bucketed `dir` presented in bucket `name`.
+func (f *FuseFS) bucketChildren(ctx context.Context, dir, name string) ([]string, error) {
+	prefixLen, _ := f.bucketPrefixLen(dir)
+	children, _, err := f.zh.Children(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, child := range children {
+		if bucketName(child, prefixLen) == name {
+			matched = append(matched, child)
+		}
+	}
+	return matched, nil
+}
+
+// bucketAttr returns the attributes of bucket `name` within `dir`, a directory as long as it holds a child.
+func (f *FuseFS) bucketAttr(ctx context.Context, dir, name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	children, err := f.bucketChildren(ctx, dir, name)
+	if err != nil {
+		return nil, zkErrToStatus(err)
+	}
+	if len(children) == 0 {
+		return nil, fuse.ENOENT
+	}
+	return &fuse.Attr{
+		Mode:  fuse.S_IFDIR | dirPermissions(f.IsReadWrite),
+		Owner: contextOwner(context),
+	}, fuse.OK
+}
+
+// bucketEntries lists the bucketed directory `dir`, presenting one subdirectory per bucket in place of its children.
+func (f *FuseFS) bucketEntries(ctx context.Context, dir string, prefixLen int) ([]fuse.DirEntry, fuse.Status) {
+	children, _, err := f.zh.Children(ctx, dir)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": dir,
+			"err":  err,
+		}).Error("failed to fetch children")
+		f.errors.record("OpenDir", dir, err)
+		return nil, zkErrToStatus(err)
+	}
+
+	buckets := make(map[string]bool)
+	for _, child := range children {
+		buckets[bucketName(child, prefixLen)] = true
+	}
+	var names []string
+	for name := range buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dirEntries := []fuse.DirEntry{{Name: ZNodeMarker, Mode: fuse.S_IFREG}}
+	for _, name := range names {
+		dirEntries = append(dirEntries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR})
+	}
+	return dirEntries, fuse.OK
+}
+
+// openBucket lists the children of `dir` presented in bucket `name`.
+func (f *FuseFS) openBucket(ctx context.Context, dir, name string) ([]fuse.DirEntry, fuse.Status) {
+	children, err := f.bucketChildren(ctx, dir, name)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": dir,
+			"err":  err,
+		}).Error("failed to fetch children")
+		f.errors.record("OpenDir", dir, err)
+		return nil, zkErrToStatus(err)
+	}
+	if len(children) == 0 {
+		return nil, fuse.ENOENT
+	}
+
+	dirEntries, _ := f.childEntries(ctx, dir, children)
+	if f.Base64 {
+		dirEntries = append(dirEntries, base64Entries(dirEntries)...)
+	}
+	return dirEntries, fuse.OK
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseBucketRule(t *testing.T) {
+	rule, err := ParseBucketRule("sessions=2")
+	assert.Nil(t, err)
+	assert.Equal(t, PathRule{Pattern: "sessions", Value: "2"}, rule)
+
+	for _, invalid := range []string{"sessions", "sessions=0", "sessions=two", "=2"} {
+		_, err := ParseBucketRule(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestBucketName(t *testing.T) {
+	assert.Equal(t, "ab", bucketName("abcdef", 2))
+	assert.Equal(t, "a", bucketName("a", 2))
+	assert.Equal(t, "éz", bucketName("ézoo", 2))
+}
+
+// TestBucketing verifies the children of a bucketed directory are listed by bucket, and are reachable through it.
+func TestBucketing(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "sessions").Return([]string{"abc", "abd", "bcd", "b"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "sessions/abc").Return(true, &zk.Stat{DataLength: 4}, nil)
+	mockZooKeeper.zk.On("Exists", "sessions/abd").Return(true, &zk.Stat{NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Get", "sessions/abc").Return([]byte("data"), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Children", "sessions/abd").Return([]string{"leaf"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "sessions/abd/leaf").Return(true, &zk.Stat{DataLength: 4}, nil)
+	mockZooKeeper.zk.On("Get", "sessions/abd/leaf").Return([]byte("leaf"), &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, Buckets: []PathRule{{Pattern: "sessions", Value: "2"}}}
+
+	entries, status := fs.OpenDir("sessions", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, []fuse.DirEntry{
+		{Name: ZNodeMarker, Mode: fuse.S_IFREG},
+		{Name: "ab", Mode: fuse.S_IFDIR},
+		{Name: "b", Mode: fuse.S_IFDIR},
+		{Name: "bc", Mode: fuse.S_IFDIR},
+	}, entries)
+
+	attr, status := fs.GetAttr("sessions/ab", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.True(t, attr.IsDir())
+	_, status = fs.GetAttr("sessions/zz", nil)
+	assert.Equal(t, fuse.ENOENT, status)
+
+	entries, status = fs.OpenDir("sessions/ab", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.ElementsMatch(t, []fuse.DirEntry{
+		{Name: "abc", Mode: fuse.S_IFREG},
+		{Name: "abd", Mode: fuse.S_IFDIR},
+	}, entries)
+
+	// the real child is reachable through its bucket.
+	attr, status = fs.GetAttr("sessions/ab/abc", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint64(4), attr.Size)
+	file, status := fs.Open("sessions/ab/abc", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "sessions/abc", file.(*FuseFile).path)
+
+	entries, status = fs.OpenDir("sessions/ab/abd", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Contains(t, entries, fuse.DirEntry{Name: "leaf", Mode: fuse.S_IFREG})
+
+	// so is the subtree of a bucketed child.
+	attr, status = fs.GetAttr("sessions/ab/abd/leaf", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint64(4), attr.Size)
+	file, status = fs.Open("sessions/ab/abd/leaf", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "sessions/abd/leaf", file.(*FuseFile).path)
+	assert.Equal(t, "sessions/abd/leaf", fs.unbucket("sessions/ab/abd/leaf"))
+	assert.Equal(t, "sessions/ab", fs.unbucket("sessions/ab"))
+	assert.Equal(t, "sessions/zz/abc", fs.unbucket("sessions/zz/abc"))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// budgetFunc checks a write of `size` bytes to `path` against the size budgets of the mount.
+type budgetFunc func(ctx context.Context, path string, size int64) fuse.Status
+
+// ParseSizeBudget builds a PathRule from the `pattern=bytes` form accepted by the `-sizebudget` flag. The total data
+// size of the subtree rooted at each matching znode is capped at `bytes`.
+func ParseSizeBudget(rule string) (PathRule, error) {
+	r, err := ParsePathRule(rule)
+	if err != nil {
+		return PathRule{}, err
+	}
+	if n, err := strconv.ParseInt(r.Value, 10, 64); err != nil || n < 0 {
+		return PathRule{}, fmt.Errorf("invalid byte count in size budget %q", rule)
+	}
+	return r, nil
+}
+
+// subtreeSize returns the total data size of the znode at `path` and all of its descendants. There is no index of
+// the tree, so the subtree is walked on every call.
+func (f *FuseFS) subtreeSize(ctx context.Context, path string) (int64, error) {
+	size, _, err := f.subtreeStat(ctx, path)
+	return size, err
+}
+
+// subtreeStat returns the total data size of the znode at `path` and all of its descendants, along with their count.
+func (f *FuseFS) subtreeStat(ctx context.Context, path string) (int64, int64, error) {
+	found, stat, err := f.zh.Exists(ctx, path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return 0, 0, nil
+	}
+
+	size, count := int64(stat.DataLength), int64(1)
+	if stat.NumChildren == 0 {
+		return size, count, nil
+	}
+	children, _, err := f.zh.Children(ctx, path)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, child := range children {
+		childSize, childCount, err := f.subtreeStat(ctx, filepath.Join(path, child))
+		if err != nil {
+			return 0, 0, err
+		}
+		size += childSize
+		count += childCount
+	}
+	return size, count, nil
+}
+
+// checkBudget returns EDQUOT when setting the data of `path` to `size` bytes would push a subtree over its size
+// budget. Every budgeted ancestor of `path` is checked. A budget which cannot be computed fails the write with the
+// errno of the ZK error, rather than letting it bypass the quota.
+func (f *FuseFS) checkBudget(ctx context.Context, path string, size int64) fuse.Status {
+	return f.checkMoveBudget(ctx, "", path, size)
+}
+
+// checkMoveBudget is checkBudget for the subtree at `from`, holding `size` bytes, moved to `path`. The budgets of the
+// subtrees already holding `from` are not checked, the move leaves their size unchanged.
+func (f *FuseFS) checkMoveBudget(ctx context.Context, from, path string, size int64) fuse.Status {
+	if len(f.pathRules(&f.SizeBudgets)) == 0 {
+		return fuse.OK
+	}
+
+	for root := path; root != ""; root = parentPath(root) {
+		rule, ok := matchRule(f.pathRules(&f.SizeBudgets), root)
+		if !ok || (from != "" && strings.HasPrefix(from+"/", root+"/")) {
+			continue
+		}
+		budget, _ := strconv.ParseInt(rule.Value, 10, 64)
+
+		total, err := f.subtreeSize(ctx, root)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path": root,
+				"err":  err,
+			}).Error("unable to compute subtree size, refusing write")
+			return zkErrToStatus(err)
+		}
+		// the data currently held by `path` is replaced, rather than added to.
+		var current int64
+		if found, stat, err := f.zh.Exists(ctx, path); err == nil && found {
+			current = int64(stat.DataLength)
+		}
+
+		if total-current+size > budget {
+			log.WithFields(log.Fields{
+				"path":   path,
+				"budget": root,
+				"limit":  budget,
+			}).Warn("write refused, size budget exceeded")
+			return fuse.Status(syscall.EDQUOT)
+		}
+	}
+	return fuse.OK
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseSizeBudget(t *testing.T) {
+	rule, err := ParseSizeBudget("app=1024")
+	assert.Nil(t, err)
+	assert.Equal(t, PathRule{Pattern: "app", Value: "1024"}, rule)
+
+	for _, invalid := range []string{"app", "app=-1", "app=1k"} {
+		_, err := ParseSizeBudget(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+// TestSizeBudget verifies writes within the subtree budget are accepted and writes beyond it fail with EDQUOT.
+func TestSizeBudget(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	// app (2 bytes) holds a (3 bytes) and b (4 bytes), 9 bytes in total.
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{DataLength: 2, NumChildren: 2}, nil)
+	mockZooKeeper.zk.On("Children", "app").Return([]string{"a", "b"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "app/a").Return(true, &zk.Stat{DataLength: 3}, nil)
+	mockZooKeeper.zk.On("Exists", "app/b").Return(true, &zk.Stat{DataLength: 4}, nil)
+	mockZooKeeper.zk.On("Get", "app/a").Return([]byte("abc"), &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Set", "app/a", []byte("abcdefg"), int32(1)).Return(&zk.Stat{Version: 2, DataLength: 7}, nil)
+	mockZooKeeper.zk.On("Get", "app/b").Return([]byte("abcd"), &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Set", "app/b", []byte("abcd\x00\x00\x00\x00"), int32(1)).Return(&zk.Stat{Version: 2, DataLength: 8}, nil)
+	mockZooKeeper.zk.On("Get", "other").Return([]byte{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Set", "other", make([]byte, 1<<19), int32(0)).Return(&zk.Stat{Version: 1, DataLength: 1 << 19}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, SizeBudgets: []PathRule{{Pattern: "app", Value: "13"}}}
+
+	file, status := fs.Open("app/a", uint32(syscall.O_RDWR), nil)
+	assert.Equal(t, fuse.OK, status)
+
+	// 9 - 3 + 7 = 13 bytes, within the budget.
+	written, status := file.Write([]byte("abcdefg"), 0)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(7), written)
+
+	// 9 - 3 + 8 = 14 bytes, beyond the budget.
+	_, status = file.Write([]byte("abcdefgh"), 0)
+	assert.Equal(t, fuse.Status(syscall.EDQUOT), status)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 1)
+
+	assert.Equal(t, fuse.OK, fs.Truncate("app/b", 8, nil))
+	assert.Equal(t, fuse.Status(syscall.EDQUOT), fs.Truncate("app/b", 9, nil))
+
+	// paths outside of a budgeted subtree are not checked.
+	assert.Equal(t, fuse.OK, fs.Truncate("other", 1<<19, nil))
+}
+
+// TestSizeBudgetUnavailable verifies a write is refused when its budget cannot be computed, rather than let through.
+func TestSizeBudgetUnavailable(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app").Return(false, (*zk.Stat)(nil), zk.ErrConnectionClosed)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, SizeBudgets: []PathRule{{Pattern: "app", Value: "13"}}}
+	assert.Equal(t, fuse.EIO, fs.checkBudget(context.Background(), "app/a", 1))
+	mockZooKeeper.zk.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// XAttrCAS is the extended attribute holding the znode version the next write to a file is checked against, making
+// it a compare-and-set: `setfattr -n user.zk.cas -v 7 file; echo data > file` only writes the data while the znode is
+// still at version 7, failing with ESTALE otherwise.
+const XAttrCAS = "user.zk.cas"
+
+// pendingCAS holds the versions set through XAttrCAS until the file is next opened for write. The zero value is
+// ready for use.
+type pendingCAS struct {
+	sync.Mutex
+	versions map[string]int32
+}
+
+func (c *pendingCAS) get(path string) (int32, bool) {
+	c.Lock()
+	defer c.Unlock()
+	version, ok := c.versions[path]
+	return version, ok
+}
+
+func (c *pendingCAS) set(path string, version int32) {
+	c.Lock()
+	defer c.Unlock()
+	if c.versions == nil {
+		c.versions = make(map[string]int32)
+	}
+	c.versions[path] = version
+}
+
+// take returns the version pending for `path` and forgets it, so it only applies to a single write.
+func (c *pendingCAS) take(path string) (int32, bool) {
+	c.Lock()
+	defer c.Unlock()
+	version, ok := c.versions[path]
+	delete(c.versions, path)
+	return version, ok
+}
+
+// getCASAttr reports the version the next write to `path` is checked against, when one was set.
+func (f *FuseFS) getCASAttr(ctx context.Context, path string) ([]byte, error) {
+	version, ok := f.cas.get(path)
+	if !ok {
+		return nil, errNoAttr
+	}
+	return []byte(strconv.Itoa(int(version))), nil
+}
+
+// setCASAttr records the version the next write to `path` is checked against.
+func (f *FuseFS) setCASAttr(ctx context.Context, path string, data []byte) error {
+	version, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+	if err != nil || version < 0 {
+		return commandError{msg: "invalid znode version " + strconv.Quote(string(data))}
+	}
+	f.cas.set(path, int32(version))
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestCASWrite verifies a write following a user.zk.cas setxattr is made against the version set, and that the
+// version only applies to the next open.
+func TestCASWrite(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{Version: 9}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("fresh"), int32(7)).Return(&zk.Stat{Version: 8}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("again"), int32(9)).Return(&zk.Stat{Version: 10}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.OK, fs.SetXAttr("app/config", XAttrCAS, []byte("7\n"), 0, nil))
+	value, status := fs.GetXAttr("app/config", XAttrCAS, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "7", string(value))
+
+	file, status := fs.Open("app/config", syscall.O_WRONLY, nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write([]byte("fresh"), 0)
+	assert.Equal(t, fuse.OK, status)
+
+	// the pending version was consumed by the open.
+	_, status = fs.GetXAttr("app/config", XAttrCAS, nil)
+	assert.Equal(t, fuse.ENOATTR, status)
+	file, status = fs.Open("app/config", syscall.O_WRONLY, nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write([]byte("again"), 0)
+	assert.Equal(t, fuse.OK, status)
+	mockZooKeeper.zk.AssertExpectations(t)
+}
+
+// TestCASWriteStale verifies a compare-and-set write to a znode which moved past the expected version fails with
+// ESTALE without being retried, and that invalid versions are refused.
+func TestCASWriteStale(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{Version: 9}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("fresh"), int32(7)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, RetryBadVersion: MaxWriteRetries}
+	assert.Equal(t, fuse.EINVAL, fs.SetXAttr("app/config", XAttrCAS, []byte("-1"), 0, nil))
+	assert.Equal(t, fuse.EINVAL, fs.SetXAttr("app/config", XAttrCAS, []byte("seven"), 0, nil))
+	assert.Equal(t, fuse.OK, fs.SetXAttr("app/config", XAttrCAS, []byte("7"), 0, nil))
+
+	file, status := fs.Open("app/config", syscall.O_WRONLY, nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write([]byte("fresh"), 0)
+	assert.Equal(t, fuse.Status(syscall.ESTALE), status)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 1)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", 1)
+
+	fs = &FuseFS{zh: mockZooKeeper}
+	assert.Equal(t, fuse.EROFS, fs.SetXAttr("app/config", XAttrCAS, []byte("7"), 0, nil))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// walkTree calls `fn` for the znode at `path` and each of its descendants, parents before their children and
+// siblings in name order.
+func walkTree(ctx context.Context, zh Zoohandler, path string, fn func(path string) error) error {
+	if err := fn(path); err != nil {
+		return err
+	}
+	children, _, err := zh.Children(ctx, path)
+	if err != nil {
+		return err
+	}
+	sort.Strings(children)
+	for _, child := range children {
+		if err := walkTree(ctx, zh, filepath.Join(path, child), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// catTree writes the data of the znode at `path` to `out`. When `recursive` is set the data of every descendant
+// follows, each znode preceded by a `==> path <==` header.
+func catTree(ctx context.Context, zh Zoohandler, path string, recursive bool, out io.Writer) error {
+	if !recursive {
+		data, _, err := zh.Get(ctx, path)
+		if err != nil {
+			return fmt.Errorf("unable to Get %s: %v", path, err)
+		}
+		_, err = out.Write(data)
+		return err
+	}
+
+	first := true
+	return walkTree(ctx, zh, path, func(path string) error {
+		data, _, err := zh.Get(ctx, path)
+		if err != nil {
+			return fmt.Errorf("unable to Get %s: %v", path, err)
+		}
+		if !first {
+			fmt.Fprintln(out)
+		}
+		first = false
+		fmt.Fprintf(out, "==> %s <==\n", path)
+		out.Write(data)
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			fmt.Fprintln(out)
+		}
+		return nil
+	})
+}
+
+// runCat implements the `cat` subcommand, printing znode data without mounting. The return value is the process
+// exit code.
+func runCat(args []string, out io.Writer) int {
+	cmd := flag.NewFlagSet("cat", flag.ContinueOnError)
+	cmd.SetOutput(out)
+	zkConn := cmd.String("zkconn", "127.0.0.1:2181", "Zookeeper connection string, a comma separated list of host:port servers")
+	zkRoot := cmd.String("zkroot", "/", "Alias the root Zookeeper tree to an alternate path")
+	var auth stringList
+	cmd.Var(&auth, "auth", "Authenticate the session with digest credentials, user:password (repeatable)")
+	recursive := cmd.Bool("R", false, "Print the data of every descendant znode, each preceded by a path header")
+	if err := cmd.Parse(args); err != nil {
+		return 2
+	}
+	if cmd.NArg() != 1 {
+		fmt.Fprintln(out, "cat expects a single znode path")
+		return 2
+	}
+
+	servers, err := ParseZKConn(*zkConn)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	zh, err := NewZooHandler(servers, *zkRoot, "/", auth, DefaultSessionTimeout, false)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	defer zh.Close()
+
+	if err := catTree(context.Background(), zh, filepath.Join("/", cmd.Arg(0)), *recursive, out); err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestCatTree verifies a recursive cat concatenates the data of every descendant, each under its path header.
+func TestCatTree(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	tree := map[string]struct {
+		data     string
+		children []string
+	}{
+		"/app":            {"", []string{"db", "cache"}},
+		"/app/cache":      {"ttl=60\n", []string{}},
+		"/app/db":         {"host=db1", []string{"replica"}},
+		"/app/db/replica": {"host=db2\n", []string{}},
+	}
+	for path, node := range tree {
+		mockZooKeeper.zk.On("Get", path).Return([]byte(node.data), &zk.Stat{}, nil)
+		mockZooKeeper.zk.On("Children", path).Return(node.children, &zk.Stat{}, nil)
+	}
+
+	var out bytes.Buffer
+	assert.Nil(t, catTree(ctx, mockZooKeeper, "/app", true, &out))
+	assert.Equal(t, `==> /app <==
+
+==> /app/cache <==
+ttl=60
+
+==> /app/db <==
+host=db1
+
+==> /app/db/replica <==
+host=db2
+`, out.String())
+
+	out.Reset()
+	assert.Nil(t, catTree(ctx, mockZooKeeper, "/app/db", false, &out))
+	assert.Equal(t, "host=db1", out.String())
+
+	mockZooKeeper.zk.On("Get", "/missing").Return([]byte{}, (*zk.Stat)(nil), zk.ErrNoNode)
+	assert.NotNil(t, catTree(ctx, mockZooKeeper, "/missing", true, &out))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// flightCall is a ZK read in progress, shared by every caller requesting the same key while it runs.
+type flightCall struct {
+	wg   sync.WaitGroup
+	data []byte
+	stat *zk.Stat
+	ok   bool
+	err  error
+}
+
+// CoalescingZooHandler is a Zoohandler which deduplicates concurrent identical reads (singleflight). While a Get or
+// Exists of a path is in flight, further requests for the same path wait for, and share, its result rather than
+// issuing their own ZK call. This cuts the load a hot znode puts on the ensemble when many threads stat or read it
+// at once. A Create, Delete, Set or Sync of a path detaches the reads of it in flight once done, so a read following
+// the caller's own write or sync never shares the result of a read issued before it. All other calls are passed
+// through.
+type CoalescingZooHandler struct {
+	wrappedZooHandler
+	mu        sync.Mutex
+	calls     map[string]*flightCall
+	coalesced int64 // requests served by another caller's in-flight call, accessed atomically
+}
+
+// NewCoalescingZooHandler wraps `zh`, coalescing concurrent identical reads.
+func NewCoalescingZooHandler(zh Zoohandler) *CoalescingZooHandler {
+	return &CoalescingZooHandler{wrappedZooHandler: wrappedZooHandler{zh}, calls: make(map[string]*flightCall)}
+}
+
+// do runs `fn` for `key` unless a call for the same key is already in flight, in which case its result is awaited.
+func (c *CoalescingZooHandler) do(key string, fn func(call *flightCall)) *flightCall {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		atomic.AddInt64(&c.coalesced, 1)
+		call.wg.Wait()
+		return call
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	fn(call)
+
+	c.mu.Lock()
+	// the call may have been detached, and replaced by a later one, meanwhile.
+	if c.calls[key] == call {
+		delete(c.calls, key)
+	}
+	c.mu.Unlock()
+	call.wg.Done()
+	return call
+}
+
+// detach stops further reads of `path` from joining those already in flight, which may predate a change of it.
+func (c *CoalescingZooHandler) detach(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.calls, "get:"+path)
+	delete(c.calls, "exists:"+path)
+}
+
+// copyStat returns a copy of `stat`, so callers sharing a result cannot modify each other's.
+func copyStat(stat *zk.Stat) *zk.Stat {
+	if stat == nil {
+		return nil
+	}
+	s := *stat
+	return &s
+}
+
+// Get implements Zoohandler.Get, sharing the result of an identical Get already in flight. Each caller receives its
+// own copy of the data.
+func (c *CoalescingZooHandler) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
+	call := c.do("get:"+path, func(call *flightCall) {
+		call.data, call.stat, call.err = c.Zoohandler.Get(ctx, path)
+	})
+	var data []byte
+	if call.data != nil {
+		data = append([]byte{}, call.data...)
+	}
+	return data, copyStat(call.stat), call.err
+}
+
+// Exists implements Zoohandler.Exists, sharing the result of an identical Exists already in flight.
+func (c *CoalescingZooHandler) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	call := c.do("exists:"+path, func(call *flightCall) {
+		call.ok, call.stat, call.err = c.Zoohandler.Exists(ctx, path)
+	})
+	return call.ok, copyStat(call.stat), call.err
+}
+
+// Create implements Zoohandler.Create, detaching the reads of `path` in flight.
+func (c *CoalescingZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	defer c.detach(path)
+	return c.Zoohandler.Create(ctx, path, data, flags, acl)
+}
+
+// Delete implements Zoohandler.Delete, detaching the reads of `path` in flight.
+func (c *CoalescingZooHandler) Delete(ctx context.Context, path string, version int32) error {
+	defer c.detach(path)
+	return c.Zoohandler.Delete(ctx, path, version)
+}
+
+// Set implements Zoohandler.Set, detaching the reads of `path` in flight.
+func (c *CoalescingZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	defer c.detach(path)
+	return c.Zoohandler.Set(ctx, path, data, version)
+}
+
+// Sync implements Zoohandler.Sync, detaching the reads of `path` in flight.
+func (c *CoalescingZooHandler) Sync(ctx context.Context, path string) (string, error) {
+	defer c.detach(path)
+	return c.Zoohandler.Sync(ctx, path)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestCoalescingGet verifies concurrent identical Gets share a single downstream call.
+func TestCoalescingGet(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	// hold the first call in flight until every other caller has joined it.
+	release := make(chan time.Time)
+	mockZooKeeper.zk.On("Get", "app/hot").Return([]byte("data"), &zk.Stat{Version: 3}, nil).WaitUntil(release)
+
+	zh := NewCoalescingZooHandler(mockZooKeeper)
+
+	callers := 10
+	results := make([][]byte, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, stat, err := zh.Get(ctx, "app/hot")
+			assert.Nil(t, err)
+			assert.Equal(t, int32(3), stat.Version)
+			results[i] = data
+		}(i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&zh.coalesced) < int64(callers-1) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", 1)
+	for _, data := range results {
+		assert.Equal(t, []byte("data"), data)
+	}
+	// every caller holds its own copy of the data.
+	results[0][0] = 'X'
+	assert.Equal(t, []byte("data"), results[1])
+}
+
+// TestCoalescingSequential verifies calls which do not overlap are each passed through.
+func TestCoalescingSequential(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app/hot").Return(true, &zk.Stat{}, nil)
+
+	zh := NewCoalescingZooHandler(mockZooKeeper)
+	for i := 0; i < 3; i++ {
+		found, _, err := zh.Exists(ctx, "app/hot")
+		assert.True(t, found)
+		assert.Nil(t, err)
+	}
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 3)
+	assert.True(t, zh.Ready())
+	assert.False(t, NewCoalescingZooHandler(&LazyZooHandler{}).Ready())
+}
+
+// TestCoalescingAfterSet verifies a Get following a Set of the path does not join a Get issued before the Set.
+func TestCoalescingAfterSet(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	mockZooKeeper.zk.On("Get", "app/hot").Return([]byte("stale"), &zk.Stat{Version: 3}, nil).Run(func(mock.Arguments) {
+		close(started)
+		<-release
+	}).Once()
+	mockZooKeeper.zk.On("Get", "app/hot").Return([]byte("fresh"), &zk.Stat{Version: 4}, nil)
+	mockZooKeeper.zk.On("Set", "app/hot", []byte("fresh"), int32(3)).Return(&zk.Stat{Version: 4}, nil)
+	mockZooKeeper.zk.On("Sync", "app/hot").Return("/app/hot", nil)
+
+	zh := NewCoalescingZooHandler(mockZooKeeper)
+	done := make(chan []byte)
+	go func() {
+		data, _, _ := zh.Get(ctx, "app/hot")
+		done <- data
+	}()
+	<-started
+
+	_, err := zh.Set(ctx, "app/hot", []byte("fresh"), 3)
+	assert.Nil(t, err)
+	data, stat, err := zh.Get(ctx, "app/hot")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("fresh"), data)
+	assert.Equal(t, int32(4), stat.Version)
+
+	close(release)
+	assert.Equal(t, []byte("stale"), <-done)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", 2)
+
+	_, err = zh.Sync(ctx, "app/hot")
+	assert.Nil(t, err)
+	assert.Empty(t, zh.calls)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redacted replaces the value of any Config field tagged `redact:"true"` when the configuration is rendered.
+const redacted = "<redacted>"
+
+// Config holds the effective settings of a mount, as resolved from the command line. Fields holding secrets are
+// tagged `redact:"true"` and never rendered.
+type Config struct {
+	FuseRoot        string        `json:"mountpoint"`
+	ConfigFile      string        `json:"config"`
+	ZKConn          string        `json:"zkconn"`
+	ZKRoot          string        `json:"zkroot"`
+	Auth            []string      `json:"auth" redact:"true"`
+	ReadWrite       bool          `json:"rw"`
+	LogFile         string        `json:"logfile"`
+	Debug           bool          `json:"debug"`
+	ModeBits        bool          `json:"modebits"`
+	RetryBadVersion int           `json:"retrybadversion"`
+	Merge           []string      `json:"merge"`
+	ACLCheck        bool          `json:"aclcheck"`
+	ACLTTL          time.Duration `json:"aclttl"`
+	LazyMount       bool          `json:"lazymount"`
+	StripPrefix     []string      `json:"stripprefix"`
+	Syslog          bool          `json:"syslog"`
+	SyslogFacility  string        `json:"syslogfacility"`
+	SyslogTag       string        `json:"syslogtag"`
+	Base64          bool          `json:"base64"`
+	OnBusyUnmount   string        `json:"onbusyunmount"`
+	UnmountTimeout  time.Duration `json:"unmounttimeout"`
+	NamePattern     string        `json:"namepattern"`
+	MaxCreates      int64         `json:"maxcreates"`
+	Bucket          []string      `json:"bucket"`
+	SizeBudget      []string      `json:"sizebudget"`
+	Atime           string        `json:"atime"`
+	SafeDelete      bool          `json:"safedelete"`
+	Ephemeral       bool          `json:"ephemeral"`
+	EphemeralSuffix string        `json:"ephemeralsuffix"`
+	Snapshot        string        `json:"snapshot"`
+	UTF8Only        []string      `json:"utf8only"`
+	Identity        string        `json:"identity"`
+	MtimeStore      string        `json:"mtimestore"`
+	URLEncode       bool          `json:"urlencode"`
+	Watch           bool          `json:"watch"`
+	Sync            bool          `json:"sync"`
+	LatencyXAttr    bool          `json:"latencyxattr"`
+	Recursive       bool          `json:"recursive"`
+	MaxBackoff      time.Duration `json:"maxbackoff"`
+	DirTemplate     string        `json:"dirtemplate"`
+	Timeout         time.Duration `json:"timeout"`
+	ReadyFD         int           `json:"readyfd"`
+	ReadyFile       string        `json:"readyfile"`
+	LazyModes       bool          `json:"lazymodes"`
+	Ignore          []string      `json:"ignore"`
+	MaxConcurrency  int           `json:"maxconcurrency"`
+	AttrCache       time.Duration `json:"attrcache"`
+	ChildRetries    int           `json:"childretries"`
+	WatchCountXAttr bool          `json:"watchcountxattr"`
+	SyncWrites      bool          `json:"syncwrites"`
+	Bootstrap       string        `json:"bootstrap"`
+	MarkerFormat    string        `json:"markerformat"`
+	AllowOther      bool          `json:"allow-other"`
+	AllowRoot       bool          `json:"allow-root"`
+	MaxBackground   int           `json:"maxbackground"`
+	Congestion      int           `json:"congestionthreshold"`
+	MetricsAddr     string        `json:"metrics-addr"`
+	WriteUIDs       string        `json:"writeuids"`
+	MaxZnode        int           `json:"maxznode"`
+	DirCache        bool          `json:"dircache"`
+	ReadCap         int           `json:"readcap"`
+	TLS             bool          `json:"tls"`
+	TLSCert         string        `json:"tls-cert"`
+	TLSKey          string        `json:"tls-key"`
+	TLSCA           string        `json:"tls-ca"`
+	TLSInsecure     bool          `json:"tls-insecure"`
+	HotPaths        int           `json:"hotpaths"`
+	LinkCopy        bool          `json:"linkcopy"`
+	CreateRoot      bool          `json:"create-root"`
+	Coalesce        bool          `json:"coalesce"`
+}
+
+// redact returns the JSON object form of `v` (a struct), with the value of every non-empty field tagged
+// `redact:"true"` replaced.
+func redact(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if field.Tag.Get("redact") != "true" || isZero(rv.Field(i)) {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		out[name] = redacted
+	}
+	return out, nil
+}
+
+// isZero reports whether the field holds its zero value, or is an empty slice/map.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// renderConfig returns the effective configuration of the mount as JSON, with secrets redacted.
+func (f *FuseFS) renderConfig(ctx context.Context) ([]byte, error) {
+	var cfg Config
+	f.configMu.RLock()
+	if f.Config != nil {
+		cfg = *f.Config
+	}
+	f.configMu.RUnlock()
+	out, err := redact(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// identity is the content of the `identity` control file, naming the ensemble and chroot a mount presents.
+type identity struct {
+	Name   string `json:"name,omitempty"`
+	ZKConn string `json:"zkconn"`
+	ZKRoot string `json:"zkroot"`
+}
+
+// renderIdentity renders the `identity` control file, letting scripts detect which mount they are in.
+func (f *FuseFS) renderIdentity(ctx context.Context) ([]byte, error) {
+	cfg := f.Config
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	data, err := json.MarshalIndent(identity{Name: cfg.Identity, ZKConn: cfg.ZKConn, ZKRoot: cfg.ZKRoot}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// configFileArg returns the value of the `-config` flag found in `args`, ahead of flag parsing. The config file is
+// loaded before the command line is parsed, so flags take precedence over it.
+func configFileArg(args []string) string {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if arg == name || arg == "--" {
+			continue
+		}
+		if name == "config" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+	}
+	return ""
+}
+
+// loadConfigFile overlays the JSON config file at `path` onto `cfg`. Keys match the names rendered by
+// `.zoofuse/config`, settings absent from the file are left untouched.
+func loadConfigFile(cfg *Config, path string) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	dec := json.NewDecoder(fh)
+	dec.DisallowUnknownFields()
+	return dec.Decode(cfg)
+}
+
+// configChanges returns the names of the settings differing between two configurations.
+func configChanges(old, next *Config) ([]string, error) {
+	before, err := redact(old)
+	if err != nil {
+		return nil, err
+	}
+	after, err := redact(next)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for name, value := range after {
+		if !reflect.DeepEqual(before[name], value) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// configRules holds the path rules of a configuration, parsed.
+type configRules struct {
+	stripPrefixes []PathRule
+	buckets       []PathRule
+	sizeBudgets   []PathRule
+	utf8          []PathRule
+	ignore        []string
+}
+
+// parseConfigRules parses the path rules of `cfg`, naming the setting of the first invalid rule found.
+func parseConfigRules(cfg *Config) (configRules, error) {
+	var rules configRules
+	var err error
+	if rules.stripPrefixes, err = parseRules(cfg.StripPrefix, ParsePathRule); err != nil {
+		return rules, fmt.Errorf("invalid stripprefix: %v", err)
+	}
+	if rules.buckets, err = parseRules(cfg.Bucket, ParseBucketRule); err != nil {
+		return rules, fmt.Errorf("invalid bucket: %v", err)
+	}
+	if rules.sizeBudgets, err = parseRules(cfg.SizeBudget, ParseSizeBudget); err != nil {
+		return rules, fmt.Errorf("invalid sizebudget: %v", err)
+	}
+	if rules.utf8, err = parseRules(cfg.UTF8Only, ParseUTF8Rule); err != nil {
+		return rules, fmt.Errorf("invalid utf8only: %v", err)
+	}
+	for _, p := range cfg.Ignore {
+		pattern, err := ParseIgnorePattern(p)
+		if err != nil {
+			return rules, fmt.Errorf("invalid ignore: %v", err)
+		}
+		rules.ignore = append(rules.ignore, pattern)
+	}
+	return rules, nil
+}
+
+// logLevel returns the log level selected by the `debug` setting.
+func logLevel(debug bool) log.Level {
+	if debug {
+		return log.DebugLevel
+	}
+	return log.InfoLevel
+}
+
+// ttlCache is implemented by the caches whose entry lifetime reloadConfig may change.
+type ttlCache interface {
+	SetTTL(ttl time.Duration)
+}
+
+// reloadConfig re-reads the config file of the mount (on SIGHUP) and applies the settings which can change at
+// runtime: the log level, the unmount policy and timeout, the path rules (stripprefix, bucket, sizebudget, utf8only
+// and ignore) and the TTLs of the caches enabled at mount (attrcache and aclttl). The file is validated as a whole
+// first: changing any other setting, fixed for the life of the mount, rejects the reload without applying anything.
+func (f *FuseFS) reloadConfig() error {
+	f.configMu.Lock()
+	defer f.configMu.Unlock()
+	next := *f.Config
+	if err := loadConfigFile(&next, f.Config.ConfigFile); err != nil {
+		return err
+	}
+	if !validUnmountPolicy(next.OnBusyUnmount) {
+		return fmt.Errorf("invalid onbusyunmount policy %q, expected wait, force or fail", next.OnBusyUnmount)
+	}
+	rules, err := parseConfigRules(&next)
+	if err != nil {
+		return err
+	}
+
+	changed, err := configChanges(f.Config, &next)
+	if err != nil {
+		return err
+	}
+	var rejected []string
+	for _, name := range changed {
+		switch name {
+		case "debug", "onbusyunmount", "unmounttimeout", "stripprefix", "bucket", "sizebudget", "utf8only", "ignore":
+		case "attrcache":
+			// the cache can only be tuned, not enabled or disabled.
+			if f.StatCache == nil || next.AttrCache <= 0 {
+				rejected = append(rejected, name)
+			}
+		case "aclttl":
+			if f.ACLs == nil || next.ACLTTL <= 0 {
+				rejected = append(rejected, name)
+			}
+		default:
+			rejected = append(rejected, name)
+		}
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("settings %s cannot change at runtime, remount to apply them", strings.Join(rejected, ", "))
+	}
+
+	for _, name := range changed {
+		switch name {
+		case "debug":
+			f.Config.Debug = next.Debug
+			log.SetLevel(logLevel(next.Debug))
+		case "onbusyunmount":
+			f.Config.OnBusyUnmount = next.OnBusyUnmount
+			f.OnBusyUnmount = next.OnBusyUnmount
+		case "unmounttimeout":
+			f.Config.UnmountTimeout = next.UnmountTimeout
+			f.UnmountTimeout = next.UnmountTimeout
+		case "stripprefix":
+			f.Config.StripPrefix = next.StripPrefix
+			f.StripPrefixes = rules.stripPrefixes
+		case "bucket":
+			f.Config.Bucket = next.Bucket
+			f.Buckets = rules.buckets
+		case "sizebudget":
+			f.Config.SizeBudget = next.SizeBudget
+			f.SizeBudgets = rules.sizeBudgets
+		case "utf8only":
+			f.Config.UTF8Only = next.UTF8Only
+			f.UTF8Rules = rules.utf8
+		case "ignore":
+			f.Config.Ignore = next.Ignore
+			f.Ignore = rules.ignore
+		case "attrcache":
+			f.Config.AttrCache = next.AttrCache
+			f.StatCache.SetTTL(next.AttrCache)
+		case "aclttl":
+			f.Config.ACLTTL = next.ACLTTL
+			f.ACLs.SetTTL(next.ACLTTL)
+		}
+		log.WithFields(log.Fields{
+			"setting": name,
+		}).Info("setting reloaded")
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRenderConfig verifies the control file renders the effective configuration of the mount.
+func TestRenderConfig(t *testing.T) {
+	cfg := &Config{
+		FuseRoot:        "/mnt/zk",
+		ZKConn:          "zk1:2181",
+		ZKRoot:          "/chroot",
+		ReadWrite:       true,
+		RetryBadVersion: 2,
+		Merge:           []string{"out=base,override"},
+	}
+	fs := &FuseFS{Config: cfg}
+
+	attr, status := fs.GetAttr(ControlDir+"/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.S_IFREG|IfRegRO, attr.Mode)
+
+	file, status := fs.Open(ControlDir+"/config", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, attr.Size)
+	res, _ := file.Read(buf, 0)
+	data, _ := res.Bytes(buf)
+
+	var rendered Config
+	assert.Nil(t, json.Unmarshal(data, &rendered))
+	assert.Equal(t, *cfg, rendered)
+
+	_, status = fs.Open(ControlDir+"/config", uint32(fuse.O_ANYWRITE), nil)
+	assert.Equal(t, fuse.EROFS, status)
+}
+
+// TestRenderIdentity verifies the identity control file names the ensemble and chroot of the mount.
+func TestRenderIdentity(t *testing.T) {
+	ctx := context.Background()
+	fs := &FuseFS{Config: &Config{ZKConn: "zk1:2181,zk2:2181", ZKRoot: "/chroot", Identity: "prod"}}
+
+	file, status := fs.Open(ControlDir+"/identity", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, 1024)
+	res, _ := file.Read(buf, 0)
+	data, _ := res.Bytes(buf)
+	assert.JSONEq(t, `{"name": "prod", "zkconn": "zk1:2181,zk2:2181", "zkroot": "/chroot"}`, string(data))
+
+	fs = &FuseFS{Config: &Config{ZKConn: "zk1:2181", ZKRoot: "/"}}
+	data, err := fs.renderIdentity(ctx)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"zkconn": "zk1:2181", "zkroot": "/"}`, string(data))
+}
+
+func TestRedact(t *testing.T) {
+	settings := struct {
+		Host     string   `json:"host"`
+		Password string   `json:"password" redact:"true"`
+		Tokens   []string `json:"tokens" redact:"true"`
+		Unset    string   `json:"unset" redact:"true"`
+	}{Host: "zk1", Password: "hunter2", Tokens: []string{"a", "b"}}
+
+	out, err := redact(settings)
+	assert.Nil(t, err)
+	assert.Equal(t, "zk1", out["host"])
+	assert.Equal(t, redacted, out["password"])
+	assert.Equal(t, redacted, out["tokens"])
+	assert.Equal(t, "", out["unset"])
+}
+
+func TestControlDirListing(t *testing.T) {
+	fs := &FuseFS{}
+
+	attr, status := fs.GetAttr(ControlDir, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.S_IFDIR|IfDirRO, attr.Mode)
+
+	entries, status := fs.OpenDir(ControlDir, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Contains(t, entries, fuse.DirEntry{Name: "config", Mode: fuse.S_IFREG})
+
+	_, status = fs.GetAttr(ControlDir+"/missing", nil)
+	assert.Equal(t, fuse.ENOENT, status)
+}
+
+func TestConfigFileArg(t *testing.T) {
+	assert.Equal(t, "a.json", configFileArg([]string{"-rw", "-config", "a.json", "/mnt"}))
+	assert.Equal(t, "b.json", configFileArg([]string{"--config=b.json", "/mnt"}))
+	assert.Equal(t, "", configFileArg([]string{"-rw", "/mnt/config"}))
+	assert.Equal(t, "", configFileArg([]string{"-config"}))
+}
+
+// TestReloadConfig verifies a reload (SIGHUP) re-applies a changed log level, unmount policy, path rules and cache
+// TTLs, and that a change to a setting fixed for the mount rejects the reload as a whole.
+func TestReloadConfig(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(log.InfoLevel)
+
+	dir, err := ioutil.TempDir("", "zoofuse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zoofuse.json")
+
+	cfg := &Config{ConfigFile: path, ZKConn: "zk1:2181", OnBusyUnmount: UnmountForce, AttrCache: time.Second}
+	statCache := NewStatCachingZooHandler(&MockZooHandle{}, time.Second)
+	fs := &FuseFS{Config: cfg, OnBusyUnmount: UnmountForce, StatCache: statCache}
+
+	data := `{"debug": true, "onbusyunmount": "wait", "unmounttimeout": 30000000000, "attrcache": 5000000000,
+		"utf8only": ["conf/*=text"], "bucket": ["sessions=2"], "sizebudget": ["app=13"], "stripprefix": ["app=v1:"],
+		"ignore": ["zookeeper"]}`
+	assert.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+	assert.Nil(t, fs.reloadConfig())
+
+	assert.Equal(t, log.DebugLevel, log.GetLevel())
+	assert.True(t, cfg.Debug)
+	assert.Equal(t, UnmountWait, fs.OnBusyUnmount)
+	assert.Equal(t, 30*time.Second, fs.UnmountTimeout)
+	assert.Equal(t, 5*time.Second, statCache.ttl)
+	assert.Equal(t, []PathRule{{Pattern: "conf/*", Value: "text"}}, fs.UTF8Rules)
+	assert.Equal(t, []PathRule{{Pattern: "sessions", Value: "2"}}, fs.Buckets)
+	assert.Equal(t, []PathRule{{Pattern: "app", Value: "13"}}, fs.SizeBudgets)
+	assert.Equal(t, []PathRule{{Pattern: "app", Value: "v1:"}}, fs.StripPrefixes)
+	assert.Equal(t, []string{"zookeeper"}, fs.Ignore)
+	assert.True(t, fs.ignored("zookeeper/quota"))
+	assert.Equal(t, []string{"conf/*=text"}, cfg.UTF8Only)
+
+	// a setting fixed for the mount rejects the reload, nothing of it is applied.
+	data = `{"debug": false, "utf8only": [], "zkconn": "zk2:2181", "aclttl": 1000000000}`
+	assert.Nil(t, ioutil.WriteFile(path, []byte(data), 0644))
+	err = fs.reloadConfig()
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "aclttl, zkconn")
+	}
+	assert.Equal(t, log.DebugLevel, log.GetLevel())
+	assert.True(t, cfg.Debug)
+	assert.Len(t, fs.UTF8Rules, 1)
+	assert.Equal(t, "zk1:2181", cfg.ZKConn)
+
+	// the attribute cache can be tuned, not disabled.
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"attrcache": 0}`), 0644))
+	assert.NotNil(t, fs.reloadConfig())
+	assert.Equal(t, 5*time.Second, statCache.ttl)
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"debug": false, "zkconn": "zk1:2181"}`), 0644))
+	assert.Nil(t, fs.reloadConfig())
+	assert.Equal(t, log.InfoLevel, log.GetLevel())
+
+	// invalid config files are rejected as a whole.
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"debug": true, "onbusyunmount": "later"}`), 0644))
+	assert.NotNil(t, fs.reloadConfig())
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"debug": true, "bucket": ["sessions=none"]}`), 0644))
+	assert.NotNil(t, fs.reloadConfig())
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"unknown": true}`), 0644))
+	assert.NotNil(t, fs.reloadConfig())
+	assert.Equal(t, log.InfoLevel, log.GetLevel())
+}
+
+// TestReloadConfigConcurrent verifies a reload may run while the config is rendered and the mount unmounted (run
+// with -race).
+func TestReloadConfigConcurrent(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+
+	dir, err := ioutil.TempDir("", "zoofuse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "zoofuse.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"onbusyunmount": "wait"}`), 0644))
+
+	fs := &FuseFS{Config: &Config{ConfigFile: path, OnBusyUnmount: UnmountForce}, OnBusyUnmount: UnmountForce}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Nil(t, fs.reloadConfig())
+	}()
+	_, err = fs.renderConfig(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, fs.Unmount())
+	<-done
+	assert.Equal(t, UnmountWait, fs.OnBusyUnmount)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// mountInfoPath lists the mounts of the process, along with the device each is backed by.
+	mountInfoPath = "/proc/self/mountinfo"
+	// fuseConnectionsDir holds the tunables of each FUSE connection, keyed by the minor device number of the mount.
+	fuseConnectionsDir = "/sys/fs/fuse/connections"
+)
+
+// fuseConnection returns the FUSE connection (the minor device number) backing the mount at `mountpoint`, as listed
+// by `mountinfo`.
+func fuseConnection(mountinfo io.Reader, mountpoint string) (string, error) {
+	scanner := bufio.NewScanner(mountinfo)
+	for scanner.Scan() {
+		// 36 25 0:45 / /mnt/zk rw,nosuid,nodev relatime - fuse.zoofuse zoofuse rw,user_id=0,group_id=0
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || strings.Replace(fields[4], `\040`, " ", -1) != mountpoint {
+			continue
+		}
+		device := strings.SplitN(fields[2], ":", 2)
+		if len(device) != 2 {
+			return "", fmt.Errorf("invalid device %q in mountinfo", fields[2])
+		}
+		return device[1], nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s is not mounted", mountpoint)
+}
+
+// setCongestionThreshold sets the number of background requests past which the kernel considers the FUSE connection
+// of the mount at `mountpoint` congested. go-fuse always negotiates 3/4 of the max background requests, the threshold
+// is changed afterwards through the fusectl filesystem, which requires root.
+func setCongestionThreshold(mountpoint string, threshold int) error {
+	mountpoint, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return err
+	}
+	info, err := os.Open(mountInfoPath)
+	if err != nil {
+		return err
+	}
+	defer info.Close()
+
+	conn, err := fuseConnection(info, filepath.Clean(mountpoint))
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(fuseConnectionsDir, conn, "congestion_threshold")
+	return ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", threshold)), 0644)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFuseConnection verifies the FUSE connection of a mount is found by its mountpoint in mountinfo.
+func TestFuseConnection(t *testing.T) {
+	mountinfo := strings.Join([]string{
+		"22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw",
+		"36 22 0:45 / /mnt/zk rw,nosuid,nodev,relatime shared:20 - fuse.zoofuse zoofuse rw,user_id=0,group_id=0",
+		"37 22 0:46 / /mnt/zk\\040two rw,nosuid,nodev,relatime shared:21 - fuse.zoofuse zoofuse rw,user_id=0,group_id=0",
+	}, "\n")
+
+	conn, err := fuseConnection(strings.NewReader(mountinfo), "/mnt/zk")
+	assert.Nil(t, err)
+	assert.Equal(t, "45", conn)
+
+	conn, err = fuseConnection(strings.NewReader(mountinfo), "/mnt/zk two")
+	assert.Nil(t, err)
+	assert.Equal(t, "46", conn)
+
+	_, err = fuseConnection(strings.NewReader(mountinfo), "/mnt/other")
+	assert.NotNil(t, err)
+}
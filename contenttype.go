@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// XAttrContentType is the extended attribute reporting the MIME type of the data held by a znode, sniffed from its
+// first sniffLength bytes, for file managers and tools picking a viewer.
+const XAttrContentType = "user.zk.contenttype"
+
+// sniffLength bounds the data inspected to tell the content type of a znode.
+const sniffLength = 512
+
+// sniffContentType returns the MIME type of `data`, judged by its first sniffLength bytes. JSON documents are told
+// apart from plain text, any other data is typed by the content sniffing of net/http (XML, text, images, binary...).
+func sniffContentType(data []byte) string {
+	if len(data) > sniffLength {
+		data = data[:sniffLength]
+	}
+	if looksLikeJSON(data) {
+		return "application/json"
+	}
+	return http.DetectContentType(data)
+}
+
+// looksLikeJSON reports whether `data` opens a JSON object or array and holds no syntax error, allowing the document
+// to be cut short at the end of the sample.
+func looksLikeJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		_, err := dec.Token()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// sniffCache holds the content type sniffed for each znode alongside the zxid of the data it was sniffed from, so
+// the data is only fetched again once modified. The zero value is ready for use.
+type sniffCache struct {
+	sync.Mutex
+	types map[string]sniffedType
+}
+
+type sniffedType struct {
+	mzxid       int64
+	contentType string
+}
+
+func (s *sniffCache) get(path string, mzxid int64) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+	sniffed, ok := s.types[path]
+	return sniffed.contentType, ok && sniffed.mzxid == mzxid
+}
+
+func (s *sniffCache) set(path string, mzxid int64, contentType string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.types == nil {
+		s.types = make(map[string]sniffedType)
+	}
+	s.types[path] = sniffedType{mzxid: mzxid, contentType: contentType}
+}
+
+// getContentTypeAttr reports the content type of the data presented by the znode at `path`. The znode is stat'ed
+// to find whether the cached type is still current, its data is only fetched when it is not.
+func (f *FuseFS) getContentTypeAttr(ctx context.Context, path string) ([]byte, error) {
+	found, stat, err := f.zh.Exists(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, zk.ErrNoNode
+	}
+	if contentType, ok := f.sniffed.get(path, stat.Mzxid); ok {
+		return []byte(contentType), nil
+	}
+
+	data, stat, err := f.zh.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if rule, ok := matchRule(f.pathRules(&f.StripPrefixes), path); ok {
+		data = bytes.TrimPrefix(data, []byte(rule.Value))
+	}
+	contentType := sniffContentType(data)
+	f.sniffed.set(path, stat.Mzxid, contentType)
+	return []byte(contentType), nil
+}
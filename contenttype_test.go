@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSniffContentType(t *testing.T) {
+	assert.Equal(t, "application/json", sniffContentType([]byte(`{"name": "zoofuse", "ports": [2181]}`)))
+	assert.Equal(t, "application/json", sniffContentType([]byte("\n  [1, 2, 3]\n")))
+	// a document longer than the sample is judged by its beginning.
+	long := `{"hosts": [` + strings.Repeat(`"zk1:2181", `, 100) + `"zk2:2181"]}`
+	assert.Equal(t, "application/json", sniffContentType([]byte(long)))
+
+	assert.Equal(t, "text/xml; charset=utf-8", sniffContentType([]byte(`<?xml version="1.0"?><config/>`)))
+	assert.Equal(t, "text/plain; charset=utf-8", sniffContentType([]byte("{not json}")))
+	assert.Equal(t, "text/plain; charset=utf-8", sniffContentType([]byte("zk1:2181,zk2:2181")))
+	assert.Equal(t, "application/octet-stream", sniffContentType([]byte{0x00, 0x01, 0xfe, 0xff}))
+}
+
+// TestContentTypeXAttr verifies the content type is sniffed from the znode data once, and again after the znode was
+// modified.
+func TestContentTypeXAttr(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	binary := bytes.Repeat([]byte{0x00, 0xff}, 1024)
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{Mzxid: 1}, nil).Twice()
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte(`{"debug": true}`), &zk.Stat{Mzxid: 1}, nil).Once()
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{Mzxid: 2}, nil)
+	mockZooKeeper.zk.On("Get", "app/config").Return(binary, &zk.Stat{Mzxid: 2}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	data, status := fs.GetXAttr("app/config", XAttrContentType, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "application/json", string(data))
+	data, _ = fs.GetXAttr("app/config", XAttrContentType, nil)
+	assert.Equal(t, "application/json", string(data))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", 1)
+
+	data, status = fs.GetXAttr("app/config", XAttrContentType, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "application/octet-stream", string(data))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", 2)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxIncrementRetries is the number of times an increment is retried when the counter was modified concurrently.
+const MaxIncrementRetries = 10
+
+// increment atomically adds `delta` to the decimal counter held by the znode at `path`, returning the new value. The
+// read-modify-write is version checked, so a concurrent update causes the increment to be retried against the fresh
+// value rather than lost. An empty znode counts as 0.
+func increment(ctx context.Context, zh Zoohandler, path string, delta int64) (int64, error) {
+	for attempt := 0; attempt <= MaxIncrementRetries; attempt++ {
+		data, stat, err := zh.Get(ctx, path)
+		if err != nil {
+			return 0, err
+		}
+
+		var value int64
+		if trimmed := strings.TrimSpace(string(data)); trimmed != "" {
+			value, err = strconv.ParseInt(trimmed, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("znode %s does not hold a counter: %v", path, err)
+			}
+		}
+
+		value += delta
+		_, err = zh.Set(ctx, path, []byte(strconv.FormatInt(value, 10)), stat.Version)
+		if err == zk.ErrBadVersion {
+			log.WithFields(log.Fields{
+				"path":    path,
+				"attempt": attempt + 1,
+			}).Debug("counter modified concurrently, retrying increment")
+			continue
+		}
+		return value, err
+	}
+	return 0, fmt.Errorf("unable to increment %s, gave up after %d retries", path, MaxIncrementRetries)
+}
+
+// incrementCommand implements the `increment` control file. Each line written holds a counter path and the
+// (signed) delta to add to it, e.g. `counters/hits 5`.
+func (f *FuseFS) incrementCommand(ctx context.Context, content []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return commandError{fmt.Sprintf("invalid increment %q, expected: path delta", scanner.Text())}
+		}
+		delta, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return commandError{fmt.Sprintf("invalid increment delta %q", fields[1])}
+		}
+
+		path := cleanPath(fields[0])
+		value, err := increment(ctx, f.zh, path, delta)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"path":  path,
+			"delta": delta,
+			"value": value,
+		}).Debug("incremented counter")
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIncrement(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "counters/hits").Return([]byte("41\n"), &zk.Stat{Version: 3}, nil)
+	mockZooKeeper.zk.On("Set", "counters/hits", []byte("42"), int32(3)).Return(&zk.Stat{Version: 4}, nil)
+
+	value, err := increment(ctx, mockZooKeeper, "counters/hits", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), value)
+}
+
+// TestIncrementContention verifies a counter modified concurrently is re-read and the increment retried.
+func TestIncrementContention(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "counters/hits").Return([]byte("41"), &zk.Stat{Version: 3}, nil).Once()
+	mockZooKeeper.zk.On("Set", "counters/hits", []byte("46"), int32(3)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Get", "counters/hits").Return([]byte("50"), &zk.Stat{Version: 4}, nil).Once()
+	mockZooKeeper.zk.On("Set", "counters/hits", []byte("55"), int32(4)).Return(&zk.Stat{Version: 5}, nil)
+
+	value, err := increment(ctx, mockZooKeeper, "counters/hits", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(55), value)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 2)
+}
+
+func TestIncrementNotACounter(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "config").Return([]byte("{}"), &zk.Stat{}, nil)
+
+	_, err := increment(ctx, mockZooKeeper, "config", 1)
+	assert.NotNil(t, err)
+}
+
+// TestIncrementControlFile drives an increment through the control file.
+func TestIncrementControlFile(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "counters/hits").Return([]byte(""), &zk.Stat{Version: 0}, nil)
+	mockZooKeeper.zk.On("Set", "counters/hits", []byte("-2"), int32(0)).Return(&zk.Stat{Version: 1}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	file, status := fs.Open(ControlDir+"/increment", uint32(os.O_WRONLY), nil)
+	assert.Equal(t, fuse.OK, status)
+
+	command := []byte("/counters/hits -2\n")
+	written, status := file.Write(command, 0)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(len(command)), written)
+
+	_, status = file.Write([]byte("counters/hits many\n"), 0)
+	assert.Equal(t, fuse.EINVAL, status)
+
+	// commands are refused on a read-only mount.
+	fs.IsReadWrite = false
+	_, status = fs.Open(ControlDir+"/increment", uint32(os.O_WRONLY), nil)
+	assert.Equal(t, fuse.EROFS, status)
+}
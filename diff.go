@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LoadDump reads and parses the dump held in the file at `path`.
+func LoadDump(path string) (*Dump, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseDump(file)
+}
+
+// dumpPath maps a fuse path onto the absolute form used by dumps. Dump paths are relative to the mount root.
+func dumpPath(path string) string {
+	return "/" + path
+}
+
+// diffDump compares the live tree against `dump` and returns one line per znode that differs, ordered by path.
+// Znodes only found live are reported as `+ path`, those only found in the dump as `- path` and those whose data
+// changed as `~ path`. The root is present on every mount and is only compared when the dump holds it.
+func diffDump(ctx context.Context, zh Zoohandler, dump *Dump) ([]string, error) {
+	live := make(map[string][]byte)
+	err := walkTree(ctx, zh, "", func(path string) error {
+		data, _, err := zh.Get(ctx, path)
+		if err != nil {
+			return fmt.Errorf("unable to Get %s: %v", path, err)
+		}
+		live[dumpPath(path)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]bool)
+	var lines []string
+	for _, node := range dump.Nodes {
+		snapshot[node.Path] = true
+		data, err := node.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("snapshot node %s: %v", node.Path, err)
+		}
+		current, ok := live[node.Path]
+		switch {
+		case !ok:
+			lines = append(lines, "- "+node.Path)
+		case !bytes.Equal(current, data):
+			lines = append(lines, "~ "+node.Path)
+		}
+	}
+	for path := range live {
+		if !snapshot[path] && path != "/" {
+			lines = append(lines, "+ "+path)
+		}
+	}
+
+	sort.Slice(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	return lines, nil
+}
+
+// renderDiff renders the `diff` control file, the changes made to the tree since the snapshot was taken. The whole
+// tree is walked on every read.
+func (f *FuseFS) renderDiff(ctx context.Context) ([]byte, error) {
+	lines, err := diffDump(ctx, f.zh, f.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
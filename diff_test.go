@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestDiffDump verifies the diff control file reports the znodes added, removed and changed since the snapshot.
+func TestDiffDump(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "").Return([]string{"app"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Children", "app").Return([]string{"new", "same", "changed"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Children", mock.Anything).Return([]string{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "").Return([]byte(nil), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app").Return([]byte(nil), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app/new").Return([]byte("new"), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app/same").Return([]byte("same"), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app/changed").Return([]byte("after"), &zk.Stat{}, nil)
+
+	snapshot, err := ParseDump(strings.NewReader(`{"nodes": [
+		{"path": "/app"},
+		{"path": "/app/same", "data": "same"},
+		{"path": "/app/changed", "data": "YmVmb3Jl", "encoding": "base64"},
+		{"path": "/app/removed", "data": "gone"}
+	]}`))
+	assert.Nil(t, err)
+
+	fs := &FuseFS{zh: mockZooKeeper, Snapshot: snapshot}
+	file, status := fs.Open(ControlDir+"/diff", uint32(0), nil)
+	assert.True(t, status.Ok())
+	buf := make([]byte, 1024)
+	result, status := file.Read(buf, 0)
+	assert.True(t, status.Ok())
+	data, _ := result.Bytes(buf)
+	assert.Equal(t, "~ /app/changed\n+ /app/new\n- /app/removed\n", string(data))
+
+	// without a snapshot there is nothing to compare against.
+	fs = &FuseFS{zh: mockZooKeeper}
+	_, status = fs.GetAttr(ControlDir+"/diff", nil)
+	assert.False(t, status.Ok())
+}
+
+// TestLoadDump verifies a snapshot is read from a dump file.
+func TestLoadDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zoofuse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dump.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"nodes": [{"path": "/app", "data": "x"}]}`), 0644))
+
+	dump, err := LoadDump(path)
+	assert.Nil(t, err)
+	assert.Len(t, dump.Nodes, 1)
+
+	_, err = LoadDump(filepath.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// listingCache holds the child entries resolved by OpenDir for each directory alongside the cversion of the znode
+// they were resolved at (see the `dircache` flag). The cversion changes whenever a child is created or deleted, so a
+// re-listing of an unchanged directory is answered without stat'ing each child again. The zero value is ready for use.
+type listingCache struct {
+	sync.Mutex
+	listings map[string]listing
+}
+
+type listing struct {
+	cversion int32
+	entries  []fuse.DirEntry
+}
+
+// get returns the entries cached for `path`, when they were resolved at `cversion`.
+func (l *listingCache) get(path string, cversion int32) ([]fuse.DirEntry, bool) {
+	l.Lock()
+	defer l.Unlock()
+	cached, ok := l.listings[path]
+	if !ok || cached.cversion != cversion {
+		return nil, false
+	}
+	return append([]fuse.DirEntry{}, cached.entries...), true
+}
+
+func (l *listingCache) set(path string, cversion int32, entries []fuse.DirEntry) {
+	l.Lock()
+	defer l.Unlock()
+	if l.listings == nil {
+		l.listings = make(map[string]listing)
+	}
+	l.listings[path] = listing{cversion: cversion, entries: append([]fuse.DirEntry{}, entries...)}
+}
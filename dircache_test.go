@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestOpenDirCache verifies a re-listing at the same cversion is served without stat'ing the children, while a
+// cversion change resolves the children again.
+func TestOpenDirCache(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "dir").Return([]string{"a", "b"}, &zk.Stat{Cversion: 2}, nil).Twice()
+	mockZooKeeper.zk.On("Children", "dir").Return([]string{"a", "b", "c"}, &zk.Stat{Cversion: 3}, nil)
+	mockZooKeeper.zk.On("Exists", "dir/a").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "dir/b").Return(true, &zk.Stat{NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Exists", "dir/c").Return(true, &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, DirCache: true}
+	expected := []fuse.DirEntry{
+		{Name: ZNodeMarker, Mode: fuse.S_IFREG},
+		{Name: "a", Mode: fuse.S_IFREG},
+		{Name: "b", Mode: fuse.S_IFDIR},
+	}
+	entries, status := fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, expected, entries)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 2)
+
+	// the second listing hits the cache.
+	entries, status = fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, expected, entries)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 2)
+
+	// a child was added, bumping the cversion.
+	entries, status = fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, append(expected, fuse.DirEntry{Name: "c", Mode: fuse.S_IFREG}), entries)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 5)
+}
+
+// TestOpenDirCacheIncomplete verifies a listing missing a child which could not be stat'ed is not cached, so the
+// child is listed again once it can be.
+func TestOpenDirCacheIncomplete(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "dir").Return([]string{"a", "b"}, &zk.Stat{Cversion: 2}, nil)
+	mockZooKeeper.zk.On("Exists", "dir/a").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "dir/b").Return(false, (*zk.Stat)(nil), zk.ErrConnectionClosed).Once()
+	mockZooKeeper.zk.On("Exists", "dir/b").Return(true, &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, DirCache: true}
+	entries, status := fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.NotContains(t, entries, fuse.DirEntry{Name: "b", Mode: fuse.S_IFREG})
+
+	entries, status = fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Contains(t, entries, fuse.DirEntry{Name: "b", Mode: fuse.S_IFREG})
+
+	// the complete listing is cached.
+	_, status = fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 4)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dump is the serialised form of a znode tree. It is a flat list of znodes, each identified by its absolute path.
+type Dump struct {
+	Nodes []DumpNode `json:"nodes"`
+}
+
+// DumpNode is a single znode within a Dump.
+type DumpNode struct {
+	Path     string   `json:"path"`
+	Data     string   `json:"data,omitempty"`
+	Encoding string   `json:"encoding,omitempty"` // how Data is encoded, empty (raw text) or "base64"
+	ACL      []string `json:"acl,omitempty"`      // scheme:id:perms entries, defaults to world:anyone:cdrwa
+}
+
+// ParseDump decodes a JSON dump. Unknown fields are rejected so that typos do not silently drop data.
+func ParseDump(r io.Reader) (*Dump, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var dump Dump
+	if err := dec.Decode(&dump); err != nil {
+		return nil, fmt.Errorf("unable to parse dump: %v", err)
+	}
+	return &dump, nil
+}
+
+// Bytes returns the decoded data payload of the znode.
+func (n *DumpNode) Bytes() ([]byte, error) {
+	switch n.Encoding {
+	case "":
+		return []byte(n.Data), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(n.Data)
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", n.Encoding)
+	}
+}
+
+// validZNodePath checks a path against the naming rules enforced by the ZK server.
+func validZNodePath(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("path must be absolute")
+	}
+	if path == "/" {
+		return nil
+	}
+	if strings.HasSuffix(path, "/") {
+		return fmt.Errorf("path must not end with /")
+	}
+	if strings.ContainsRune(path, 0) {
+		return fmt.Errorf("path must not contain the null character")
+	}
+	for _, name := range strings.Split(path[1:], "/") {
+		if name == "" || name == "." || name == ".." {
+			return fmt.Errorf("path contains an empty, . or .. element")
+		}
+	}
+	if path == "/zookeeper" || strings.HasPrefix(path, "/zookeeper/") {
+		return fmt.Errorf("path is within the reserved /zookeeper tree")
+	}
+	return nil
+}
+
+// Validate checks the structure of the dump without contacting ZK. It returns every problem found rather than
+// stopping at the first, so a dump can be fixed in a single pass before it is restored.
+func (d *Dump) Validate() []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, node := range d.Nodes {
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, fmt.Errorf("node %d (%s): %s", i, node.Path, fmt.Sprintf(format, args...)))
+		}
+
+		if err := validZNodePath(node.Path); err != nil {
+			fail("%v", err)
+		}
+		if seen[node.Path] {
+			fail("duplicate path")
+		}
+		seen[node.Path] = true
+
+		data, err := node.Bytes()
+		if err != nil {
+			fail("%v", err)
+		} else if len(data) > MaxZnodeData {
+			fail("data length %d exceeds allowable limit (%d)", len(data), MaxZnodeData)
+		}
+
+		for _, spec := range node.ACL {
+			if _, err := ParseACL(spec); err != nil {
+				fail("%v", err)
+			}
+		}
+	}
+	return errs
+}
+
+// validateDump implements the `validate-dump` subcommand. The dump is read from `in` and every problem found is
+// reported to `out`. The return value is the process exit code.
+func validateDump(in io.Reader, out io.Writer) int {
+	dump, err := ParseDump(in)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	errs := dump.Validate()
+	for _, err := range errs {
+		fmt.Fprintln(out, err)
+	}
+	if len(errs) > 0 {
+		fmt.Fprintf(out, "dump is invalid, %d error(s) found\n", len(errs))
+		return 1
+	}
+	fmt.Fprintf(out, "dump is valid, %d znode(s)\n", len(dump.Nodes))
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDump(t *testing.T) {
+	valid := `{"nodes": [
+		{"path": "/app"},
+		{"path": "/app/config", "data": "{}", "acl": ["world:anyone:cdrwa"]},
+		{"path": "/app/blob", "data": "AAEC", "encoding": "base64"}
+	]}`
+	var out bytes.Buffer
+	assert.Equal(t, 0, validateDump(strings.NewReader(valid), &out))
+	assert.Contains(t, out.String(), "dump is valid, 3 znode(s)")
+}
+
+func TestValidateDumpMalformed(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, 1, validateDump(strings.NewReader(`{"nodes": [`), &out))
+	assert.Contains(t, out.String(), "unable to parse dump")
+
+	out.Reset()
+	assert.Equal(t, 1, validateDump(strings.NewReader(`{"znodes": []}`), &out))
+	assert.Contains(t, out.String(), "unable to parse dump")
+}
+
+// TestValidateDumpReportsAllErrors verifies that every invalid node is reported, not only the first.
+func TestValidateDumpReportsAllErrors(t *testing.T) {
+	oversized := strings.Repeat("x", MaxZnodeData+1)
+	invalid := `{"nodes": [
+		{"path": "relative/path"},
+		{"path": "/app/"},
+		{"path": "/app/../etc"},
+		{"path": "/zookeeper/quota"},
+		{"path": "/dup"},
+		{"path": "/dup"},
+		{"path": "/big", "data": "` + oversized + `"},
+		{"path": "/acl", "acl": ["world:anyone:rwx"]},
+		{"path": "/enc", "data": "!!", "encoding": "base64"}
+	]}`
+
+	dump, err := ParseDump(strings.NewReader(invalid))
+	assert.Nil(t, err)
+	assert.Len(t, dump.Validate(), 8)
+
+	var out bytes.Buffer
+	assert.Equal(t, 1, validateDump(strings.NewReader(invalid), &out))
+	assert.Contains(t, out.String(), "8 error(s) found")
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrReadOnlyDump is returned by a DumpZooHandler for every call modifying the tree.
+var ErrReadOnlyDump = errors.New("dump is read-only")
+
+// dumpEntry is a znode held by a DumpZooHandler.
+type dumpEntry struct {
+	data     []byte
+	acl      []zk.ACL
+	children []string
+}
+
+// DumpZooHandler is a read-only Zoohandler serving the znodes of a Dump from memory, allowing a dump to be inspected
+// without a live ensemble. Znodes missing from the dump but holding descendants within it are presented as empty
+// znodes, the way ZK requires them to exist.
+type DumpZooHandler struct {
+	nodes  map[string]*dumpEntry
+	loaded int64 // time the dump was loaded, in ms, reported as the mtime and ctime of each znode
+}
+
+// NewDumpZooHandler loads the znodes of `dump`.
+func NewDumpZooHandler(dump *Dump) (*DumpZooHandler, error) {
+	d := &DumpZooHandler{
+		nodes:  map[string]*dumpEntry{"/": {acl: zk.WorldACL(zk.PermAll)}},
+		loaded: time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	for _, node := range dump.Nodes {
+		data, err := node.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %v", node.Path, err)
+		}
+		acl := zk.WorldACL(zk.PermAll)
+		if len(node.ACL) > 0 {
+			acl = nil
+			for _, spec := range node.ACL {
+				entry, err := ParseACL(spec)
+				if err != nil {
+					return nil, fmt.Errorf("node %s: %v", node.Path, err)
+				}
+				acl = append(acl, entry)
+			}
+		}
+		entry := d.entry(node.Path)
+		entry.data, entry.acl = data, acl
+	}
+	for _, entry := range d.nodes {
+		sort.Strings(entry.children)
+	}
+	return d, nil
+}
+
+// entry returns the znode at the absolute `path`, adding it and any missing ancestor to the tree.
+func (d *DumpZooHandler) entry(path string) *dumpEntry {
+	if entry, ok := d.nodes[path]; ok {
+		return entry
+	}
+	entry := &dumpEntry{acl: zk.WorldACL(zk.PermAll)}
+	d.nodes[path] = entry
+	parent := d.entry(filepath.Dir(path))
+	parent.children = append(parent.children, filepath.Base(path))
+	return entry
+}
+
+// lookup returns the znode presented at the fuse `path`. The ZNodeMarker is aliased to its parent, as ZooHandle does.
+func (d *DumpZooHandler) lookup(path string) (*dumpEntry, error) {
+	path = filepath.Join("/", strings.TrimSuffix(path, ZNodeMarker))
+	entry, ok := d.nodes[path]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+	return entry, nil
+}
+
+// stat returns the zk.Stat of a znode held by the dump.
+func (d *DumpZooHandler) stat(entry *dumpEntry) *zk.Stat {
+	return &zk.Stat{
+		Ctime:       d.loaded,
+		Mtime:       d.loaded,
+		DataLength:  int32(len(entry.data)),
+		NumChildren: int32(len(entry.children)),
+	}
+}
+
+// Close implements Zoohandler.Close, there is no connection to release.
+func (d *DumpZooHandler) Close() {}
+
+// Children implements Zoohandler.Children
+func (d *DumpZooHandler) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
+	entry, err := d.lookup(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append([]string{}, entry.children...), d.stat(entry), nil
+}
+
+// Create implements Zoohandler.Create, the dump is read-only.
+func (d *DumpZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	return "", ErrReadOnlyDump
+}
+
+// Delete implements Zoohandler.Delete, the dump is read-only.
+func (d *DumpZooHandler) Delete(ctx context.Context, path string, version int32) error {
+	return ErrReadOnlyDump
+}
+
+// Exists implements Zoohandler.Exists
+func (d *DumpZooHandler) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	entry, err := d.lookup(path)
+	if err != nil {
+		return false, nil, nil
+	}
+	return true, d.stat(entry), nil
+}
+
+// Get implements Zoohandler.Get
+func (d *DumpZooHandler) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
+	entry, err := d.lookup(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append([]byte{}, entry.data...), d.stat(entry), nil
+}
+
+// Set implements Zoohandler.Set, the dump is read-only.
+func (d *DumpZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	return nil, ErrReadOnlyDump
+}
+
+// GetACL implements Zoohandler.GetACL
+func (d *DumpZooHandler) GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error) {
+	entry, err := d.lookup(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append([]zk.ACL{}, entry.acl...), d.stat(entry), nil
+}
+
+// SetACL implements Zoohandler.SetACL, the dump is read-only.
+func (d *DumpZooHandler) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	return nil, ErrReadOnlyDump
+}
+
+// GetW implements Zoohandler.GetW. A dump never changes, the watch never fires.
+func (d *DumpZooHandler) GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	data, stat, err := d.Get(ctx, path)
+	return data, stat, nil, err
+}
+
+// ChildrenW implements Zoohandler.ChildrenW. A dump never changes, the watch never fires.
+func (d *DumpZooHandler) ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	children, stat, err := d.Children(ctx, path)
+	return children, stat, nil, err
+}
+
+// Sync implements Zoohandler.Sync, a dump is always up to date.
+func (d *DumpZooHandler) Sync(ctx context.Context, path string) (string, error) {
+	if _, err := d.lookup(path); err != nil {
+		return "", err
+	}
+	return filepath.Join("/", path), nil
+}
+
+// runMountDump implements the `mount-dump` subcommand, mounting a dump as a read-only filesystem until the process
+// is interrupted. The return value is the process exit code.
+func runMountDump(args []string, out io.Writer) int {
+	cmd := flag.NewFlagSet("mount-dump", flag.ContinueOnError)
+	cmd.SetOutput(out)
+	if err := cmd.Parse(args); err != nil {
+		return 2
+	}
+	if cmd.NArg() != 2 {
+		fmt.Fprintln(out, "mount-dump expects a dump file and a mountpoint")
+		return 2
+	}
+
+	dump, err := LoadDump(cmd.Arg(0))
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	if errs := dump.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(out, err)
+		}
+		fmt.Fprintf(out, "dump is invalid, %d error(s) found\n", len(errs))
+		return 1
+	}
+	zh, err := NewDumpZooHandler(dump)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	fuseFS := FuseFS{
+		FileSystem: pathfs.NewDefaultFileSystem(),
+		zh:         zh,
+		FuseRoot:   cmd.Arg(1),
+		Config:     &Config{FuseRoot: cmd.Arg(1), Snapshot: cmd.Arg(0)},
+	}
+	if err := fuseFS.Mount(nil); err != nil {
+		fmt.Fprintf(out, "unable to mount %s: %v\n", fuseFS.FuseRoot, err)
+		return 1
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range c {
+			if err := fuseFS.Unmount(); err != nil {
+				log.WithFields(log.Fields{
+					"err": err,
+				}).Error("Failed to unmount FUSE")
+				continue
+			}
+		}
+	}()
+
+	log.WithFields(log.Fields{
+		"dump":       cmd.Arg(0),
+		"mountpoint": fuseFS.FuseRoot,
+		"znodes":     len(zh.nodes),
+	}).Info("serving dump")
+	fuseFS.Serve()
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+// newDumpFS returns a read-only FuseFS serving the znodes of the given JSON dump.
+func newDumpFS(t *testing.T, dump string) (*FuseFS, *DumpZooHandler) {
+	parsed, err := ParseDump(strings.NewReader(dump))
+	assert.Nil(t, err)
+	zh, err := NewDumpZooHandler(parsed)
+	assert.Nil(t, err)
+	return &FuseFS{zh: zh}, zh
+}
+
+// TestDumpZooHandler verifies the dump handler serves the data, children and ACLs held by the dump, synthesises the
+// ancestors missing from it and refuses modifications.
+func TestDumpZooHandler(t *testing.T) {
+	ctx := context.Background()
+	_, zh := newDumpFS(t, `{"nodes": [
+		{"path": "/app/b", "data": "YmluYXJ5", "encoding": "base64"},
+		{"path": "/app/a", "data": "text", "acl": ["digest:ops:x:r"]}
+	]}`)
+
+	data, stat, err := zh.Get(ctx, "app/a")
+	assert.Nil(t, err)
+	assert.Equal(t, "text", string(data))
+	assert.Equal(t, int32(4), stat.DataLength)
+
+	data, _, err = zh.Get(ctx, "app/b")
+	assert.Nil(t, err)
+	assert.Equal(t, "binary", string(data))
+
+	children, stat, err := zh.Children(ctx, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, children)
+	assert.Equal(t, int32(2), stat.NumChildren)
+
+	children, _, err = zh.Children(ctx, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app"}, children)
+
+	data, _, err = zh.Get(ctx, "app/a/"+ZNodeMarker)
+	assert.Nil(t, err)
+	assert.Equal(t, "text", string(data))
+
+	acl, _, err := zh.GetACL(ctx, "app/a")
+	assert.Nil(t, err)
+	assert.Equal(t, []zk.ACL{{Perms: zk.PermRead, Scheme: "digest", ID: "ops:x"}}, acl)
+	acl, _, err = zh.GetACL(ctx, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, zk.WorldACL(zk.PermAll), acl)
+
+	exists, _, err := zh.Exists(ctx, "missing")
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	_, _, err = zh.Get(ctx, "missing")
+	assert.Equal(t, zk.ErrNoNode, err)
+
+	_, err = zh.Set(ctx, "app/a", []byte("new"), -1)
+	assert.Equal(t, ErrReadOnlyDump, err)
+	assert.Equal(t, ErrReadOnlyDump, zh.Delete(ctx, "app/a", -1))
+	_, err = zh.Create(ctx, "app/c", nil, 0, nil)
+	assert.Equal(t, ErrReadOnlyDump, err)
+}
+
+// TestDumpZooHandlerInvalid verifies a dump holding undecodable data is refused.
+func TestDumpZooHandlerInvalid(t *testing.T) {
+	dump, err := ParseDump(strings.NewReader(`{"nodes": [{"path": "/a", "data": "!", "encoding": "base64"}]}`))
+	assert.Nil(t, err)
+	_, err = NewDumpZooHandler(dump)
+	assert.NotNil(t, err)
+}
+
+// TestDumpFS verifies GetAttr, OpenDir and Open of a filesystem served from a dump.
+func TestDumpFS(t *testing.T) {
+	fs, _ := newDumpFS(t, `{"nodes": [
+		{"path": "/app"},
+		{"path": "/app/config", "data": "key=value"}
+	]}`)
+
+	attr, status := fs.GetAttr("app", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.True(t, attr.IsDir())
+	assert.Equal(t, uint32(fuse.S_IFDIR|IfDirRO), attr.Mode)
+
+	attr, status = fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.True(t, attr.IsRegular())
+	assert.Equal(t, uint64(len("key=value")), attr.Size)
+
+	_, status = fs.GetAttr("app/missing", nil)
+	assert.Equal(t, fuse.ENOENT, status)
+
+	entries, status := fs.OpenDir("app", nil)
+	assert.Equal(t, fuse.OK, status)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	assert.Contains(t, names, "config")
+
+	file, status := fs.Open("app/config", 0, nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, 64)
+	result, status := file.Read(buf, 0)
+	assert.Equal(t, fuse.OK, status)
+	data, _ := result.Bytes(buf)
+	assert.Equal(t, "key=value", string(data))
+}
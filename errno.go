@@ -0,0 +1,36 @@
+package main
+
+import (
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// zkErrToStatus maps the error of a Zookeeper call onto the errno returned to the kernel. A znode modified since its
+// version was read is reported as EAGAIN, the operation may be retried against the fresh version. Writes tell a
+// failed compare-and-set (ESTALE) and exhausted retries (EIO) apart on their own, see FuseFile.push. Errors without
+// a closer errno, such as a lost connection, are reported as EIO.
+func zkErrToStatus(err error) fuse.Status {
+	switch err {
+	case nil:
+		return fuse.OK
+	case zk.ErrNoNode:
+		return fuse.ENOENT
+	case zk.ErrNodeExists:
+		return fuse.Status(syscall.EEXIST)
+	case zk.ErrNotEmpty:
+		return fuse.Status(syscall.ENOTEMPTY)
+	case zk.ErrNoAuth, zk.ErrAuthFailed:
+		return fuse.EACCES
+	case zk.ErrBadVersion:
+		return fuse.EAGAIN
+	case ErrNotReady:
+		return fuse.EAGAIN
+	case zk.ErrInvalidACL:
+		return fuse.EINVAL
+	case ErrReadOnlyMount, ErrReadOnlyDump:
+		return fuse.EROFS
+	}
+	return fuse.EIO
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestZkErrToStatus verifies the errno each Zookeeper error is reported with.
+func TestZkErrToStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status fuse.Status
+	}{
+		{nil, fuse.OK},
+		{zk.ErrNoNode, fuse.ENOENT},
+		{zk.ErrNodeExists, fuse.Status(syscall.EEXIST)},
+		{zk.ErrNotEmpty, fuse.Status(syscall.ENOTEMPTY)},
+		{zk.ErrNoAuth, fuse.EACCES},
+		{zk.ErrAuthFailed, fuse.EACCES},
+		{zk.ErrBadVersion, fuse.EAGAIN},
+		{zk.ErrInvalidACL, fuse.EINVAL},
+		{zk.ErrConnectionClosed, fuse.EIO},
+		{zk.ErrSessionExpired, fuse.EIO},
+		{ErrNotReady, fuse.EAGAIN},
+		{ErrReadOnlyMount, fuse.EROFS},
+		{ErrReadOnlyDump, fuse.EROFS},
+		{errors.New("unexpected"), fuse.EIO},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.status, zkErrToStatus(test.err), "%v", test.err)
+	}
+}
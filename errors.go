@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MaxRecentErrors is the number of errors retained by the errorLog, older errors are dropped.
+const MaxRecentErrors = 50
+
+// errorEntry is a single failed operation recorded by the errorLog.
+type errorEntry struct {
+	Time  time.Time `json:"time"`
+	Op    string    `json:"op"`
+	Path  string    `json:"path"`
+	Error string    `json:"error"`
+}
+
+// errorLog is a ring buffer of the most recent MaxRecentErrors errors, exposed through the ControlDir as `errors`.
+// The zero value is ready for use.
+type errorLog struct {
+	mu      sync.Mutex
+	entries []errorEntry
+	next    int // slot overwritten by the next error once the buffer is full
+}
+
+// record adds a failed operation to the log, evicting the oldest entry once the buffer is full.
+func (l *errorLog) record(op, path string, err error) {
+	entry := errorEntry{Time: time.Now(), Op: op, Path: path, Error: err.Error()}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < MaxRecentErrors {
+		l.entries = append(l.entries, entry)
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % MaxRecentErrors
+}
+
+// snapshot returns the recorded errors, oldest first.
+func (l *errorLog) snapshot() []errorEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := make([]errorEntry, 0, len(l.entries))
+	entries = append(entries, l.entries[l.next:]...)
+	return append(entries, l.entries[:l.next]...)
+}
+
+// renderErrors returns the recent errors of the mount as JSON.
+func (f *FuseFS) renderErrors(ctx context.Context) ([]byte, error) {
+	data, err := json.MarshalIndent(f.errors.snapshot(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestErrorLogCap verifies the error log retains only the most recent MaxRecentErrors errors, oldest first.
+func TestErrorLogCap(t *testing.T) {
+	var errs errorLog
+	assert.Empty(t, errs.snapshot())
+
+	extra := 5
+	for i := 0; i < MaxRecentErrors+extra; i++ {
+		errs.record("Open", fmt.Sprintf("node-%d", i), zk.ErrNoNode)
+	}
+
+	entries := errs.snapshot()
+	assert.Len(t, entries, MaxRecentErrors)
+	assert.Equal(t, fmt.Sprintf("node-%d", extra), entries[0].Path)
+	assert.Equal(t, fmt.Sprintf("node-%d", MaxRecentErrors+extra-1), entries[len(entries)-1].Path)
+}
+
+// TestErrorLogRecorded verifies failed operations are exposed through the errors control file.
+func TestErrorLogRecorded(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/missing").Return([]byte{}, (*zk.Stat)(nil), zk.ErrNoNode)
+	mockZooKeeper.zk.On("Children", "app/gone").Return([]string{}, (*zk.Stat)(nil), zk.ErrConnectionClosed)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	_, status := fs.Open("app/missing", uint32(0), nil)
+	assert.Equal(t, fuse.ENOENT, status)
+	_, status = fs.OpenDir("app/gone", nil)
+	assert.Equal(t, fuse.EIO, status)
+
+	data, err := fs.renderErrors(ctx)
+	assert.Nil(t, err)
+	var entries []errorEntry
+	assert.Nil(t, json.Unmarshal(data, &entries))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "Open", entries[0].Op)
+	assert.Equal(t, "app/missing", entries[0].Path)
+	assert.Equal(t, zk.ErrNoNode.Error(), entries[0].Error)
+	assert.Equal(t, "OpenDir", entries[1].Op)
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -25,9 +32,40 @@ const (
 	// IfRegRO file mask for RO files
 	IfRegRO = uint32(0444)
 
-	// MaxConcurrentRequests represents max number of parallel requests to send to the remote ZK directory.
-	// This attempts to speed up OpenDir requests against trees that have many children.
+	// MaxConcurrentRequests represents max number of parallel requests to send to the remote ZK directory, unless
+	// configured otherwise (see FuseFS.MaxConcurrency). This attempts to speed up OpenDir requests against trees that
+	// have many children.
 	MaxConcurrentRequests = 25
+
+	// ChildRetries is the default number of times a failed stat of a child is retried by OpenDir.
+	ChildRetries = 2
+
+	// ChildRetryBackoff is the delay ahead of the first retry of a failed stat of a child, doubled with each retry.
+	ChildRetryBackoff = 50 * time.Millisecond
+
+	// ModeEphemeral is the mode bit (sticky) flagging an ephemeral znode when create modes are surfaced.
+	ModeEphemeral = uint32(syscall.S_ISVTX)
+	// ModeSequential is the mode bit (setgid) flagging a sequential znode when create modes are surfaced.
+	ModeSequential = uint32(syscall.S_ISGID)
+
+	// AtimeNow reports the time of the request as the access time of a znode.
+	AtimeNow = "now"
+	// AtimeMtime reports the modification time of a znode as its access time, stable across restarts.
+	AtimeMtime = "mtime"
+
+	// StatFsBlocks is the synthetic size of the filesystem reported by StatFs, in blocks of the znode data limit. Each
+	// znode is accounted as one block, ZK offers no cheap way of measuring the data held by a tree.
+	StatFsBlocks = 1 << 20
+
+	// SequentialMarker ends the name of a file created as a sequential znode. The marker is dropped and ZK appends its
+	// counter to the remaining name, e.g. `job-+` creates `job-0000000001`.
+	SequentialMarker = "+"
+
+	// sequenceSuffixLen is the length of the zero padded counter ZK appends to the name of a sequential znode.
+	sequenceSuffixLen = 10
+
+	// maxBackground is the number of requests the kernel keeps in flight, the go-fuse default.
+	maxBackground = 12
 )
 
 // FuseFS is the container for the filesystem. This is built-upon the go-fuse "pathfs" machinery. The other notable
@@ -37,7 +75,66 @@ type FuseFS struct {
 	zh                Zoohandler // ZK connection reference
 	FuseRoot          string
 	FSServer          *fuse.Server
-	IsReadWrite       bool // Will write actions be enabled
+	IsReadWrite       bool           // Will write actions be enabled
+	MergeRules        []MergeRule    // virtual files presenting the merged content of several znodes
+	ShowCreateMode    bool           // flag ephemeral and sequential znodes via the sticky and setgid mode bits
+	RetryBadVersion   int            // times a write is retried with a refreshed version when the znode moved under it
+	Config            *Config        // effective configuration of the mount, exposed through the ControlDir
+	ACLCheck          bool           // refuse operations the znode ACL does not grant, ahead of the ZK round trip
+	StripPrefixes     []PathRule     // prefixes (header) hidden from the data of matching znodes
+	Base64            bool           // accompany each znode file by a base64 encoded view (see Base64Suffix)
+	OnBusyUnmount     string         // policy applied by Unmount when file handles are open (UnmountWait, UnmountForce or UnmountFail)
+	UnmountTimeout    time.Duration  // how long the UnmountWait policy waits for open handles to close
+	NamePattern       *regexp.Regexp // names given to created znodes must match, when set
+	MaxCreates        int64          // znodes the mount may create before Create/Mkdir return ENOSPC, 0 for no limit
+	Buckets           []PathRule     // directories whose children are presented in buckets, by name prefix length
+	SizeBudgets       []PathRule     // caps on the total data size of matching subtrees, in bytes
+	AtimeMode         string         // source of the reported access time (AtimeNow or AtimeMtime)
+	SafeDelete        bool           // deletes are checked against the znode version, EAGAIN when it moved concurrently
+	Ephemeral         bool           // files are created as ephemeral znodes, removed by ZK when the session ends
+	EphemeralSuffix   string         // files created with a name ending in this suffix are ephemeral znodes, when set
+	Snapshot          *Dump          // tree the live tree is compared against by the `diff` control file, when set
+	UTF8Rules         []PathRule     // paths whose writes must hold valid UTF-8 (text) or are exempt (binary)
+	MtimeStore        string         // znode holding the modification times set by Utimens, hidden from listings, when set
+	Watch             bool           // watch opened znodes, invalidating the kernel cache when they change
+	SyncReads         bool           // sync the connected server with the leader before a znode is opened
+	Latencies         latencySource  // times the ZK operations of each path, exposed as an xattr, when set
+	RecursiveRmdir    bool           // rmdir removes the whole subtree of a znode, rather than failing with ENOTEMPTY
+	DirTemplate       []byte         // data directory znodes created by Mkdir are seeded with, when set
+	OnServing         func() error   // called once the mount is serving requests, when set
+	LazyModes         bool           // list children without stat'ing them, leaving their file type to GetAttr
+	Ignore            []string       // glob patterns of the paths masked from the mount, along with their subtrees
+	MaxConcurrency    int            // parallel requests OpenDir sends to ZK, MaxConcurrentRequests when zero
+	ChildRetries      int            // times OpenDir retries a failed stat of a child before leaving it out
+	WatchCounts       watchCounter   // counts the watches registered on a znode, exposed as an xattr, when set
+	SyncWrites        bool           // sync the connected server with the leader once a write succeeded
+	ZKRoot            string         // chroot znode presented as the root, its stat is reported by the root unless "/"
+	MarkerFormat      string         // format of the ZNodeStatMarker content (MarkerFormatText or MarkerFormatJSON)
+	AllowOther        bool           // the mount is accessible to every user (requires user_allow_other in /etc/fuse.conf)
+	AllowRoot         bool           // the mount is accessible to root alongside the mounting user (idem)
+	MaxBackground     int            // requests the kernel keeps in flight, maxBackground when 0
+	Congestion        int            // background requests past which the connection is congested, 0 for 3/4 of MaxBackground
+	WriteUIDs         []uint32       // users allowed to perform mutating operations, any user when empty
+	MaxZnode          int            // largest znode data written, larger writes fail with EFBIG (MaxZnodeData when 0)
+	DirCache          bool           // re-listings of a directory whose cversion is unchanged are served from listings
+	ReadCap           int            // reads of znodes holding more data are cut to this many bytes, no cap when 0
+	HotPaths          hotPathSource  // counts the ZK operations of each path, exposed through the ControlDir, when set
+	LinkCopy          bool           // hard links create a copy of the data of the original, rather than failing with EPERM
+	StatCache         ttlCache       // caches the stats of znodes (attrcache), its TTL changed on reload, when set
+	ACLs              ttlCache       // caches the ACLs of znodes (aclcheck), its TTL changed on reload, when set
+	creates           int64          // znodes created by the mount, accessed atomically
+	handles           handleTracker  // file handles currently open on the mount
+	stats             Stats          // runtime counters, exposed through the ControlDir
+	errors            errorLog       // most recent failed operations, exposed through the ControlDir
+	modes             modeOverlay    // permission bits set by chmod
+	times             timeOverlay    // access and modification times set by touch
+	sniffed           sniffCache     // content types sniffed from znode data, see XAttrContentType
+	listings          listingCache   // child entries resolved by OpenDir, used with DirCache
+	cas               pendingCAS     // versions the next write of a file is checked against, see XAttrCAS
+	symlinks          symlinkCache   // znodes presented as links, see SymlinkPrefix
+	configMu          sync.RWMutex   // guards Config, OnBusyUnmount and UnmountTimeout, changed by reloadConfig
+	watches           watchSet       // watches pending on the ensemble
+	notifier          notifier       // invalidates the kernel cache, set once mounted
 }
 
 // dirPermissions returns the appropriate directory permission mask
@@ -56,22 +153,143 @@ func filePermissions(isReadWrite bool) uint32 {
 	return IfRegRO
 }
 
+// isSequential reports whether a znode name carries the counter suffix ZK appends to sequential nodes. ZK does not
+// record the create mode of a znode, so this is a best effort guess based on the name alone.
+func isSequential(path string) bool {
+	name := filepath.Base(path)
+	if len(name) < sequenceSuffixLen {
+		return false
+	}
+	for _, c := range name[len(name)-sequenceSuffixLen:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// createModeBits maps the ZK create mode of a znode onto the sticky (ephemeral) and setgid (sequential) mode bits.
+func createModeBits(path string, stat *zk.Stat) uint32 {
+	var mode uint32
+	if stat.EphemeralOwner != 0 {
+		mode |= ModeEphemeral
+	}
+	if isSequential(path) {
+		mode |= ModeSequential
+	}
+	return mode
+}
+
+// createFlags returns the ZK create flags of a file created at `path`. Files are persistent znodes unless the mount
+// creates ephemeral znodes, or the name carries the EphemeralSuffix.
+func (f *FuseFS) createFlags(path string) int32 {
+	if f.Ephemeral || (f.EphemeralSuffix != "" && strings.HasSuffix(path, f.EphemeralSuffix)) {
+		return zk.FlagEphemeral
+	}
+	return 0
+}
+
+// contextOwner returns the uid/gid of the process making the request, falling back to the owner of the ZooFuse
+// process when no request context is available. Znodes carry no owner, so files are reported as owned by the
+// requester.
+func contextOwner(context *fuse.Context) fuse.Owner {
+	if context == nil {
+		return *fuse.CurrentOwner()
+	}
+	return context.Owner
+}
+
+// atime returns the access time reported for a znode, ZK does not track one.
+func (f *FuseFS) atime(stat *zk.Stat) uint64 {
+	if f.AtimeMode == AtimeMtime {
+		return uint64(stat.Mtime / 1000)
+	}
+	return uint64(time.Now().Unix())
+}
+
+// checkName enforces the NamePattern on the name of a znode about to be created, returning EINVAL when it does not
+// match.
+func (f *FuseFS) checkName(path string) fuse.Status {
+	if f.NamePattern == nil || f.NamePattern.MatchString(filepath.Base(path)) {
+		return fuse.OK
+	}
+	log.WithFields(log.Fields{
+		"path":    path,
+		"pattern": f.NamePattern.String(),
+	}).Warn("znode name does not match the name pattern")
+	return fuse.EINVAL
+}
+
+// reserveCreate claims one of the MaxCreates znode creations allowed per session, reporting false once the limit is
+// exhausted. A reservation is handed back with releaseCreate when the create fails.
+func (f *FuseFS) reserveCreate() bool {
+	return f.reserveCreates(1)
+}
+
+// reserveCreates claims `n` of the MaxCreates znode creations at once, or none of them.
+func (f *FuseFS) reserveCreates(n int64) bool {
+	if f.MaxCreates <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&f.creates, n) > f.MaxCreates {
+		atomic.AddInt64(&f.creates, -n)
+		log.WithFields(log.Fields{
+			"limit": f.MaxCreates,
+		}).Warn("refusing create, maxcreates limit reached")
+		return false
+	}
+	return true
+}
+
+// releaseCreate hands back a reservation taken by reserveCreate.
+func (f *FuseFS) releaseCreate() {
+	f.releaseCreates(1)
+}
+
+// releaseCreates hands back the reservations taken by reserveCreates.
+func (f *FuseFS) releaseCreates(n int64) {
+	if f.MaxCreates > 0 {
+		atomic.AddInt64(&f.creates, -n)
+	}
+}
+
 // GetAttr manages file system attributes for each file object. On each GetAttr request
 // we perform a query (Get) against the znode to ensure it exists. If the znode exists
 // this assigns the attributes for the file object. A further check is made to determine
 // if the znode has any children, if so the S_IFDIR file mode is set.
+// A znode holding the SymlinkPrefix is reported as a symbolic link.
 func (f *FuseFS) GetAttr(path string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	ctx := traceRequest(context, "GetAttr", path)
 	if path == "" {
-		return &fuse.Attr{
-			Mode: fuse.S_IFDIR | dirPermissions(f.IsReadWrite),
-		}, fuse.OK
+		return f.rootAttr(ctx, context), fuse.OK
 	}
 
-	found, stat, err := f.zh.Exists(path)
+	if f.isVirtual(path) {
+		return f.virtualAttr(ctx, path)
+	}
+
+	if status := f.ready(); !status.Ok() {
+		return nil, status
+	}
+
+	if target, ok := f.base64Target(path); ok {
+		return f.base64Attr(target, context)
+	}
+
+	if dir, name, ok := f.bucket(path); ok {
+		return f.bucketAttr(ctx, dir, name, context)
+	}
+	path = f.unbucket(path)
+	if f.ignored(path) {
+		return nil, fuse.ENOENT
+	}
+
+	found, stat, err := f.zh.Exists(ctx, path)
 
 	if err != nil {
 		log.Error(err)
-		return nil, fuse.ENOENT
+		f.errors.record("GetAttr", path, err)
+		return nil, zkErrToStatus(err)
 	}
 
 	if !found {
@@ -88,60 +306,200 @@ func (f *FuseFS) GetAttr(path string, context *fuse.Context) (*fuse.Attr, fuse.S
 	if strings.HasSuffix(path, ZNodeMarker) {
 		// marker file is always RO
 		fa.Mode = fuse.S_IFREG | IfRegRO
+	} else if target, ok := f.symlinkTarget(ctx, path, stat); ok {
+		// links always carry full permissions, access is checked against their target.
+		fa.Mode = fuse.S_IFLNK | 0777
+		fa.Size = uint64(len(target))
+		fa.Ctime = uint64(stat.Ctime / 1000)
+		fa.Mtime = uint64(stat.Mtime / 1000)
+		fa.Atime = f.atime(stat)
+		fa.Owner = contextOwner(context)
+		return &fa, fuse.OK
 	} else if stat.NumChildren == 0 {
 		fa.Mode = fuse.S_IFREG | filePermissions(f.IsReadWrite)
 	} else {
 		fa.Mode = fuse.S_IFDIR | dirPermissions(f.IsReadWrite)
 	}
 
-	// additional file attributues populated from the znode (stat) data.
-	fa.Size = uint64(stat.DataLength)
+	if !strings.HasSuffix(path, ZNodeMarker) {
+		fa.Mode = f.modes.apply(path, fa.Mode)
+	}
+	if f.ShowCreateMode && !strings.HasSuffix(path, ZNodeMarker) {
+		fa.Mode |= createModeBits(path, stat)
+	}
+
+	// additional file attributues populated from the znode (stat) data. The ZNodeMarker is aliased to its parent by
+	// the Zoohandler, so the marker reports the length of the parent data.
+	fa.Size = f.capSize(uint64(stat.DataLength))
 	fa.Mtime = uint64(stat.Mtime / 1000)
+	if mtime, ok := f.storedMtime(ctx, path); ok {
+		fa.Mtime = mtime
+	}
 	fa.Ctime = uint64(stat.Ctime / 1000)
+	fa.Atime = f.atime(stat)
+	if !strings.HasSuffix(path, ZNodeMarker) {
+		f.times.apply(path, &fa)
+	}
+	fa.Owner = contextOwner(context)
 	return &fa, fuse.OK
 }
 
+// rootAttr returns the attributes of the mount root, a directory carrying the timestamps and size of the chroot
+// znode. The attributes are synthetic when the whole tree is mounted, as the ZK root carries no meaningful stat, or
+// when the chroot cannot be stat'ed.
+func (f *FuseFS) rootAttr(ctx context.Context, context *fuse.Context) *fuse.Attr {
+	attr := &fuse.Attr{
+		Mode:  fuse.S_IFDIR | dirPermissions(f.IsReadWrite),
+		Owner: contextOwner(context),
+	}
+	if cleanPath(f.ZKRoot) == "" || !f.ready().Ok() {
+		return attr
+	}
+
+	found, stat, err := f.zh.Exists(ctx, "")
+	if err != nil || !found {
+		log.WithFields(log.Fields{
+			"zkroot": f.ZKRoot,
+			"err":    err,
+		}).Warn("unable to stat the chroot znode, reporting synthetic root attributes")
+		return attr
+	}
+	attr.Size = uint64(stat.DataLength)
+	attr.Mtime = uint64(stat.Mtime / 1000)
+	if mtime, ok := f.storedMtime(ctx, ""); ok {
+		attr.Mtime = mtime
+	}
+	attr.Ctime = uint64(stat.Ctime / 1000)
+	attr.Atime = f.atime(stat)
+	f.times.apply("", attr)
+	return attr
+}
+
 // OpenDir builds the current working directory from the remote ZK tree. This is done by
 // performing a fetch of all `Children` znodes for the current `path`. The only file
 // attributes set here is the `mode` (S_IFDIR or S_IFREG)
 func (f *FuseFS) OpenDir(path string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
-	children, _, err := f.zh.Children(path)
+	ctx := traceRequest(context, "OpenDir", path)
+	if path == ControlDir {
+		return f.virtualEntries(path), fuse.OK
+	}
+
+	if status := f.ready(); !status.Ok() {
+		return nil, status
+	}
+
+	if prefixLen, ok := f.bucketPrefixLen(path); ok {
+		return f.bucketEntries(ctx, path, prefixLen)
+	}
+	if dir, name, ok := f.bucket(path); ok {
+		return f.openBucket(ctx, dir, name)
+	}
+	name := path
+	path = f.unbucket(path)
+	if f.ignored(path) {
+		return nil, fuse.ENOENT
+	}
+
+	// a nonexistent path is not listed as a directory holding only the ZNodeMarker.
+	children, stat, err := f.zh.Children(ctx, path)
+	if err == zk.ErrNoNode {
+		log.WithFields(log.Fields{
+			"path": path,
+		}).Debug("directory znode does not exist")
+		return nil, fuse.ENOENT
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"path": path,
 			"err":  err,
 		}).Error("failed to fetch children")
-		return nil, fuse.ENOENT
+		f.errors.record("OpenDir", path, err)
+		return nil, zkErrToStatus(err)
 	}
 
+	f.watchChildren(ctx, name, path)
+
 	var dirEntries []fuse.DirEntry
 	dirEntries = append(dirEntries, fuse.DirEntry{Name: ZNodeMarker, Mode: fuse.S_IFREG})
+	dirEntries = append(dirEntries, f.cachedChildEntries(ctx, path, stat, children)...)
 
+	if f.Base64 {
+		dirEntries = append(dirEntries, base64Entries(dirEntries)...)
+	}
+	return append(dirEntries, f.virtualEntries(path)...), fuse.OK
+}
+
+// cachedChildEntries returns the entries of the `children` of the znode at `path`, sparing the stat of each child
+// with DirCache when the directory is listed again at the same cversion. A child turning into a directory without
+// children being added or removed is only reflected once the cversion changes, or the kernel looks the child up. A
+// listing missing a child which could not be stat'ed is not cached, so the child shows again on the next listing.
+func (f *FuseFS) cachedChildEntries(ctx context.Context, path string, stat *zk.Stat, children []string) []fuse.DirEntry {
+	if !f.DirCache || stat == nil {
+		entries, _ := f.childEntries(ctx, path, f.hideIgnored(path, f.hideMtimeStore(path, children)))
+		return entries
+	}
+	if entries, ok := f.listings.get(path, stat.Cversion); ok {
+		return entries
+	}
+	entries, complete := f.childEntries(ctx, path, f.hideIgnored(path, f.hideMtimeStore(path, children)))
+	if complete {
+		f.listings.set(path, stat.Cversion, entries)
+	}
+	return entries
+}
+
+// childEntries stats each of the `children` of the znode at `path` in parallel, returning their directory entries in
+// the order of `children`. The only file attribute set is the `mode` (S_IFDIR or S_IFREG). With LazyModes the
+// children are not stat'ed, their mode is left unknown (DT_UNKNOWN) for the kernel to learn from GetAttr on lookup,
+// saving a round trip per child. Children which could not be stat'ed are left out, the listing is then reported
+// incomplete.
+func (f *FuseFS) childEntries(ctx context.Context, path string, children []string) ([]fuse.DirEntry, bool) {
+	var dirEntries []fuse.DirEntry
 	if len(children) == 0 {
-		return dirEntries, fuse.OK
+		return dirEntries, true
+	}
+	if f.LazyModes {
+		for _, child := range children {
+			dirEntries = append(dirEntries, fuse.DirEntry{Name: child})
+		}
+		return dirEntries, true
 	}
 
-	maxWorkers := MaxConcurrentRequests
+	maxWorkers := f.MaxConcurrency
+	if maxWorkers <= 0 {
+		maxWorkers = MaxConcurrentRequests
+	}
 
 	if maxWorkers > len(children) {
 		maxWorkers = len(children)
 	}
 
+	// each worker fills the slot of its child, children which could not be stat'ed leave theirs empty.
+	results := make([]*fuse.DirEntry, len(children))
+	var dropped int32 // set atomically once a child could not be stat'ed
 	chanLimiter := make(chan struct{}, maxWorkers)
 	var wg sync.WaitGroup
-	for _, child := range children {
+	for i, child := range children {
 		wg.Add(1)
-		go func(path, directory string) {
+		go func(i int, path, directory string) {
 			defer wg.Done()
-			chanLimiter <- struct{}{}
+			select {
+			case chanLimiter <- struct{}{}:
+			default:
+				// all workers are busy, record the saturation while waiting for a slot.
+				done := f.stats.limiterWait()
+				chanLimiter <- struct{}{}
+				done()
+			}
 
 			defer func() {
 				<-chanLimiter
 			}()
 
-			found, stat, err := f.zh.Exists(filepath.Join(path, string(os.PathSeparator), directory))
+			found, stat, err := f.statChild(ctx, filepath.Join(path, string(os.PathSeparator), directory))
 			if err != nil {
 				log.Error(err)
+				atomic.StoreInt32(&dropped, 1)
 				return
 			}
 
@@ -158,116 +516,555 @@ func (f *FuseFS) OpenDir(path string, context *fuse.Context) ([]fuse.DirEntry, f
 			} else {
 				dirEntry.Mode = fuse.S_IFREG
 			}
-			dirEntries = append(dirEntries, dirEntry)
-		}(path, child)
+			results[i] = &dirEntry
+		}(i, path, child)
 	}
 	wg.Wait()
 
-	return dirEntries, fuse.OK
+	for _, dirEntry := range results {
+		if dirEntry != nil {
+			dirEntries = append(dirEntries, *dirEntry)
+		}
+	}
+	return dirEntries, atomic.LoadInt32(&dropped) == 0
 }
 
-// Utimens is called after the creation of a file. This syscall sets the timestamps in nanos.
-func (f *FuseFS) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) (code fuse.Status) {
-	return fuse.OK
+// statChild stats a child listed by OpenDir, retrying failed attempts up to ChildRetries times with a doubling
+// backoff, so a brief hiccup does not drop the child from the listing.
+func (f *FuseFS) statChild(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	backoff := ChildRetryBackoff
+	for retry := 0; ; retry++ {
+		found, stat, err := f.zh.Exists(ctx, path)
+		if err == nil || retry >= f.ChildRetries {
+			return found, stat, err
+		}
+		log.WithFields(log.Fields{
+			"path":  path,
+			"err":   err,
+			"retry": retry + 1,
+		}).Warn("failed to stat listed child, retrying")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
 }
 
+// Truncate resizes the data of the znode at `name` to `size`, as `truncate -s` and opening a file with O_TRUNC do. Data
+// past `size` is dropped, a file grown is padded with zeros. The znode is written back at the version it was read at,
+// a concurrent write fails the truncate with EAGAIN. Truncating to the current size saves the write.
 func (f *FuseFS) Truncate(name string, size uint64, context *fuse.Context) (code fuse.Status) {
+	ctx := traceRequest(context, "Truncate", name)
+	if f.isVirtual(name) {
+		if _, ok := f.controlWriter(name); ok {
+			return fuse.OK
+		}
+		return fuse.EROFS
+	}
+	if !f.IsReadWrite {
+		return fuse.EROFS
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+	// a base64 view can only be emptied, any other size does not decode to a known length.
+	path := name
+	if target, ok := f.base64Target(name); ok {
+		if size != 0 {
+			return fuse.EINVAL
+		}
+		path = target
+	}
+	path = f.unbucket(path)
+	if status := f.checkACL(ctx, path, zk.PermRead|zk.PermWrite); !status.Ok() {
+		return status
+	}
+
+	data, stat, err := f.zh.Get(ctx, path)
+	if err == zk.ErrNoNode {
+		return fuse.ENOENT
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Error("unable to Get znode from zookeeper")
+		f.errors.record("Truncate", path, err)
+		return zkErrToStatus(err)
+	}
+	var prefix []byte
+	if rule, ok := matchRule(f.pathRules(&f.StripPrefixes), path); ok && bytes.HasPrefix(data, []byte(rule.Value)) {
+		prefix = []byte(rule.Value)
+	}
+	if uint64(len(data)-len(prefix)) == size {
+		return fuse.OK
+	}
+
+	limit := f.znodeLimit()
+	if size > uint64(limit-len(prefix)) {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"size":  size,
+			"limit": limit,
+		}).Warn("truncate exceeds the znode data limit")
+		return fuse.Status(syscall.EFBIG)
+	}
+	if status := f.checkBudget(ctx, path, int64(len(prefix))+int64(size)); !status.Ok() {
+		return status
+	}
+
+	resized := make([]byte, len(prefix)+int(size))
+	copy(resized, data)
+	_, err = f.zh.Set(ctx, path, resized, stat.Version)
+	if err == zk.ErrBadVersion {
+		log.WithFields(log.Fields{
+			"path":    path,
+			"version": stat.Version,
+		}).Warn("znode was modified concurrently, not truncating it")
+		return fuse.EAGAIN
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Error("unable to Set truncated znode data")
+		f.errors.record("Truncate", path, err)
+		return zkErrToStatus(err)
+	}
+	f.notify(name, false)
 	return fuse.OK
 }
 
 // Create new file object. This creates a new znode inside ZK with an emtpy set of data. Create also
-// returns a new FuseFile struct that provides read/write capabilities.
+// returns a new FuseFile struct that provides read/write capabilities. Should the first write to the
+// file fail, the znode is removed again rather than left behind empty. A name ending in SequentialMarker
+// creates a sequential znode, the returned handle writes to the name assigned by ZK.
 func (f *FuseFS) Create(path string, flags uint32, mode uint32, context *fuse.Context) (file nodefs.File, code fuse.Status) {
+	ctx := traceRequest(context, "Create", path)
+	name := path
 	if !f.IsReadWrite {
-		return nil, fuse.EACCES
+		return nil, fuse.EROFS
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return nil, status
 	}
-	_, err := f.zh.Create(path, nil, int32(0), zk.WorldACL(zk.PermAll))
+	if f.isVirtual(path) {
+		return nil, fuse.EROFS
+	}
+	if status := f.ready(); !status.Ok() {
+		return nil, status
+	}
+	if status := f.checkACL(ctx, parentPath(path), zk.PermCreate); !status.Ok() {
+		return nil, status
+	}
+
+	// creating a base64 view creates the znode it presents.
+	target, isBase64 := f.base64Target(path)
+	if isBase64 {
+		path = target
+	}
+	path = f.unbucket(path)
+	sequential := strings.HasSuffix(path, SequentialMarker)
+	path = strings.TrimSuffix(path, SequentialMarker)
+	if sequential && (path == "" || strings.HasSuffix(path, "/")) {
+		return nil, fuse.EINVAL
+	}
+	if status := f.checkName(path); !status.Ok() {
+		return nil, status
+	}
+
+	zkFlags := f.createFlags(path)
+	if sequential {
+		zkFlags |= zk.FlagSequence
+	}
+	if !f.reserveCreate() {
+		return nil, fuse.Status(syscall.ENOSPC)
+	}
+	created, err := f.zh.Create(ctx, path, nil, zkFlags, zk.WorldACL(zk.PermAll))
 
 	if err != nil {
+		f.releaseCreate()
 		log.WithFields(log.Fields{
 			"path": path,
 			"err":  err,
 		}).Error("failed to create znode.")
-		return nil, fuse.ENOENT
+		f.errors.record("Create", path, err)
+		return nil, zkErrToStatus(err)
+	}
+	// the handle writes to the znode ZK named, the kernel keeps the name it asked for until the next listing.
+	if sequential {
+		path = filepath.Join(parentPath(path), filepath.Base(created))
+		log.WithFields(log.Fields{
+			"path": path,
+		}).Info("created sequential znode")
+	}
+	ff := NewFuseFile(nil, IfRegRW, path, f.zh)
+	ff.attr.Owner = contextOwner(context)
+	ff.errors = &f.errors
+	ff.budget = f.checkBudget
+	ff.utf8 = f.utf8Only(path)
+	ff.syncWrites = f.SyncWrites
+	ff.maxData = f.MaxZnode
+	ff.version = 0
+	ff.retryBadVersion = f.RetryBadVersion
+	ff.created = true
+	ff.base64 = isBase64
+	ff.invalidate = func() { f.notify(name, false) }
+	ff.rolledBack = func() {
+		f.releaseCreate()
+		f.modes.clear(path)
+		f.times.clear(path)
+	}
+	ff.release = f.handles.open()
+	if rule, ok := matchRule(f.pathRules(&f.StripPrefixes), path); ok {
+		ff.prefix = []byte(rule.Value)
 	}
-	return NewFuseFile(nil, IfRegRW, path, f.zh), fuse.OK
+	return ff, fuse.OK
+}
+
+// Mkdir creates an empty znode. Zookeeper has no notion of a directory, so the new znode is presented as a regular
+// file until children are created beneath it.
+func (f *FuseFS) Mkdir(path string, mode uint32, context *fuse.Context) fuse.Status {
+	ctx := traceRequest(context, "Mkdir", path)
+	if !f.IsReadWrite {
+		return fuse.EROFS
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	if f.isVirtual(path) {
+		return fuse.EROFS
+	}
+	path = f.unbucket(path)
+	if status := f.checkName(path); !status.Ok() {
+		return status
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+	if status := f.checkACL(ctx, parentPath(path), zk.PermCreate); !status.Ok() {
+		return status
+	}
+
+	if !f.reserveCreate() {
+		return fuse.Status(syscall.ENOSPC)
+	}
+	if _, err := f.zh.Create(ctx, path, f.DirTemplate, int32(0), zk.WorldACL(zk.PermAll)); err != nil {
+		f.releaseCreate()
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Error("failed to create znode.")
+		f.errors.record("Mkdir", path, err)
+		return zkErrToStatus(err)
+	}
+	return fuse.OK
 }
 
 // Open a filedescriptor for read or write ops. Open returns a new FuseFile (nodefs.File), populated with the
 // current znode payload (or empty)
 func (f *FuseFS) Open(path string, flags uint32, context *fuse.Context) (file nodefs.File, code fuse.Status) {
-	data, _, err := f.zh.Get(path)
+	ctx := traceRequest(context, "Open", path)
+	if flags&fuse.O_ANYWRITE != 0 {
+		if !f.IsReadWrite {
+			return nil, fuse.EROFS
+		}
+		if status := f.checkWriter(context); !status.Ok() {
+			return nil, status
+		}
+	}
+	if f.isVirtual(path) {
+		return f.openVirtual(ctx, path, flags)
+	}
+
+	if status := f.ready(); !status.Ok() {
+		return nil, status
+	}
+
+	if target, ok := f.base64Target(path); ok {
+		return f.openBase64(target, flags, context)
+	}
+	name := path
+	path = f.unbucket(path)
+
+	perm := int32(zk.PermRead)
+	if flags&fuse.O_ANYWRITE != 0 {
+		perm |= zk.PermWrite
+	}
+	if status := f.checkACL(ctx, path, perm); !status.Ok() {
+		return nil, status
+	}
+
+	// the connected server may lag behind the leader, syncing guarantees writes made elsewhere are seen.
+	if f.SyncReads {
+		if _, err := f.zh.Sync(ctx, path); err != nil {
+			log.WithFields(log.Fields{
+				"path": path,
+				"err":  err,
+			}).Error("unable to Sync znode with the leader")
+			f.errors.record("Open", path, err)
+			return nil, zkErrToStatus(err)
+		}
+	}
+
+	data, stat, err := f.zh.Get(ctx, path)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"path": path,
 			"err":  err,
 		}).Error("unable to Get znode from zookeeper")
-		return nil, fuse.ENOENT
+		f.errors.record("Open", path, err)
+		return nil, zkErrToStatus(err)
 	}
-	return NewFuseFile([]byte(data), IfRegRW, path, f.zh), fuse.OK
+	f.watchData(ctx, name, path)
+	// the prefix is only re-added on write when it was found, so znodes lacking it are left untouched.
+	var prefix []byte
+	if rule, ok := matchRule(f.pathRules(&f.StripPrefixes), path); ok && bytes.HasPrefix(data, []byte(rule.Value)) {
+		prefix = []byte(rule.Value)
+		data = data[len(prefix):]
+	}
+
+	// writing back a truncated file would drop the data past the cap.
+	data, truncated := f.capRead(path, data)
+	if truncated && flags&fuse.O_ANYWRITE != 0 {
+		return nil, fuse.Status(syscall.EFBIG)
+	}
+
+	ff := NewFuseFile([]byte(data), IfRegRW, path, f.zh)
+	ff.attr.Owner = contextOwner(context)
+	ff.errors = &f.errors
+	ff.budget = f.checkBudget
+	ff.utf8 = f.utf8Only(path)
+	ff.syncWrites = f.SyncWrites
+	ff.maxData = f.MaxZnode
+	ff.attr.Atime = f.atime(stat)
+	ff.version = stat.Version
+	ff.append = flags&syscall.O_APPEND != 0
+	ff.retryBadVersion = f.RetryBadVersion
+	ff.prefix = prefix
+	ff.invalidate = func() { f.notify(name, false) }
+	// a compare-and-set write must fail once the znode moved past the expected version, rather than be retried.
+	if flags&fuse.O_ANYWRITE != 0 {
+		if version, ok := f.cas.take(path); ok {
+			ff.version = version
+			ff.cas = true
+		}
+	}
+	ff.release = f.handles.open()
+	return ff, fuse.OK
 }
 
-// Unlink removes the file/znode from the tree.
+// Unlink removes the file/znode from the tree. With SafeDelete the delete is checked against the znode version, a
+// znode modified in the meantime is left in place and EAGAIN returned.
 func (f *FuseFS) Unlink(path string, context *fuse.Context) (code fuse.Status) {
+	ctx := traceRequest(context, "Unlink", path)
+	if !f.IsReadWrite {
+		return fuse.EROFS
+	}
 	// guard ensures that a user cannot remove the ZNodeMarker file at any time.
-	// Additional checks in place to ensure ZooFuse is launched in +rw mode.
-	if strings.HasSuffix(path, ZNodeMarker) || !f.IsReadWrite {
+	if strings.HasSuffix(path, ZNodeMarker) {
 		return fuse.EACCES
 	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	if _, ok := f.base64Target(path); ok {
+		return fuse.EACCES
+	}
+	if f.isVirtual(path) {
+		return fuse.EROFS
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+	path = f.unbucket(path)
+	if status := f.checkACL(ctx, parentPath(path), zk.PermDelete); !status.Ok() {
+		return status
+	}
 
-	err := f.zh.Delete(path, -1)
+	version := int32(-1)
+	if f.SafeDelete {
+		found, stat, err := f.zh.Exists(ctx, path)
+		if err != nil {
+			log.Error(err)
+			return zkErrToStatus(err)
+		}
+		if !found {
+			return fuse.ENOENT
+		}
+		version = stat.Version
+	}
+
+	err := f.zh.Delete(ctx, path, version)
+	if err == zk.ErrBadVersion {
+		log.WithFields(log.Fields{
+			"path":    path,
+			"version": version,
+		}).Warn("znode was modified concurrently, not deleting it")
+		return fuse.EAGAIN
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"path": path,
 			"err":  err,
 		}).Error("unable to Delete znode from zookeeper")
-		return fuse.EIO
+		f.errors.record("Unlink", path, err)
+		return zkErrToStatus(err)
 	}
+	f.modes.clear(path)
+	f.times.clear(path)
+	f.clearMtime(ctx, path)
 	return fuse.OK
 }
 
-// Rmdir removes a znode and its children.
+// Rmdir removes a znode. A znode holding children is refused with ENOTEMPTY, unless RecursiveRmdir is set in which
+// case the whole subtree is removed. A znode without children (an empty directory, or a leaf) is always removable.
 func (f *FuseFS) Rmdir(path string, context *fuse.Context) (code fuse.Status) {
-	found, stat, err := f.zh.Exists(path)
-	if err != nil {
-		log.Error(err)
-		return fuse.ENOENT
+	ctx := traceRequest(context, "Rmdir", path)
+	if !f.IsReadWrite || f.isVirtual(path) {
+		return fuse.EROFS
 	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+	path = f.unbucket(path)
 
-	if !found {
+	children, stat, err := f.zh.Children(ctx, path)
+	if err == zk.ErrNoNode {
 		log.WithFields(log.Fields{
 			"path": path,
 		}).Error("znode does not exist")
 		return fuse.ENOENT
 	}
+	if err != nil {
+		log.Error(err)
+		f.errors.record("Rmdir", path, err)
+		return zkErrToStatus(err)
+	}
 
-	if stat.NumChildren == 0 {
-		log.WithFields(log.Fields{
-			"path": path,
-		}).Error("ENOTDIR - skipping, number of children is 0.")
-		return fuse.ENOTDIR
+	if status := f.checkACL(ctx, parentPath(path), zk.PermDelete); !status.Ok() {
+		return status
+	}
+
+	if len(children) > 0 {
+		if !f.RecursiveRmdir {
+			return fuse.Status(syscall.ENOTEMPTY)
+		}
+		for _, child := range children {
+			if err := f.deleteTree(ctx, filepath.Join(path, child)); err != nil {
+				log.WithFields(log.Fields{
+					"path": path,
+					"err":  err,
+				}).Error("unable to delete subtree")
+				f.errors.record("Rmdir", path, err)
+				return zkErrToStatus(err)
+			}
+		}
 	}
 
-	err = f.zh.Delete(path, -1)
+	version := int32(-1)
+	if f.SafeDelete {
+		version = stat.Version
+	}
+	err = f.zh.Delete(ctx, path, version)
+	if err == zk.ErrBadVersion {
+		log.WithFields(log.Fields{
+			"path":    path,
+			"version": version,
+		}).Warn("znode was modified concurrently, not deleting it")
+		return fuse.EAGAIN
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"path": path,
 			"err":  err,
 		}).Error("received error when deleting directory")
-		return fuse.ENOENT
+		f.errors.record("Rmdir", path, err)
+		return zkErrToStatus(err)
 	}
+	f.modes.clear(path)
+	f.times.clear(path)
+	f.clearMtime(ctx, path)
 	return fuse.OK
 }
 
-// Access limits capabilities to the file when requested mode is for +w.
+// Access checks the requested R_OK, W_OK and X_OK bits against the mode reported by GetAttr, so probing tools see
+// the same permissions as `ls -l`. Write access is only granted on read/write mounts, and never to the ZNodeMarker.
+// A missing znode reports ENOENT.
 func (f *FuseFS) Access(name string, mode uint32, context *fuse.Context) (code fuse.Status) {
-	if mode == fuse.W_OK && !f.IsReadWrite {
-		return fuse.EACCES
+	attr, status := f.GetAttr(name, context)
+	if !status.Ok() {
+		return status
+	}
+
+	perms := map[uint32]uint32{fuse.R_OK: 0400, fuse.W_OK: 0200, fuse.X_OK: 0100}
+	for bit, perm := range perms {
+		if mode&bit != 0 && attr.Mode&perm == 0 {
+			return fuse.EACCES
+		}
 	}
 	return fuse.OK
 }
 
-// Mount manages the creation of the FileSystem.
+// znodeLimit returns the largest znode data written, beyond which writes fail with EFBIG.
+func (f *FuseFS) znodeLimit() int {
+	if f.MaxZnode > 0 {
+		return f.MaxZnode
+	}
+	return MaxZnodeData
+}
+
+// StatFs reports a synthetic filesystem to `df`, sized StatFsBlocks blocks of the znode data limit. The znodes
+// directly beneath the root are counted as used blocks and inodes, on a best effort basis. StatFs never fails.
+func (f *FuseFS) StatFs(name string) *fuse.StatfsOut {
+	ctx := traceRequest(nil, "StatFs", name)
+	var used uint64
+	if f.ready().Ok() {
+		if found, stat, err := f.zh.Exists(ctx, ""); err == nil && found {
+			used = uint64(stat.NumChildren)
+		}
+	}
+	if used > StatFsBlocks {
+		used = StatFsBlocks
+	}
+
+	limit := uint32(f.znodeLimit())
+	return &fuse.StatfsOut{
+		Blocks:  StatFsBlocks,
+		Bfree:   StatFsBlocks - used,
+		Bavail:  StatFsBlocks - used,
+		Files:   StatFsBlocks,
+		Ffree:   StatFsBlocks - used,
+		Bsize:   limit,
+		NameLen: 255,
+		Frsize:  limit,
+	}
+}
+
+// mountOptions returns the options the filesystem is mounted with, `opts` being passed to the kernel alongside those
+// derived from the FuseFS.
+func (f *FuseFS) mountOptions(opts []string) *fuse.MountOptions {
+	options := append([]string{}, opts...)
+	if f.AllowRoot {
+		options = append(options, "allow_root")
+	}
+	background := f.MaxBackground
+	if background <= 0 {
+		background = maxBackground
+	}
+	return &fuse.MountOptions{
+		AllowOther:    f.AllowOther,
+		Options:       options,
+		MaxBackground: background,
+	}
+}
+
+// Mount manages the creation of the FileSystem. Mounts shared with other users are refused by fusermount unless
+// user_allow_other is set in /etc/fuse.conf, the error returned points at it.
 func (f *FuseFS) Mount(opts []string) error {
 
 	log.Infof("mount FUSE filesystem at FuseRoot=%s", f.FuseRoot)
@@ -277,24 +1074,101 @@ func (f *FuseFS) Mount(opts []string) error {
 	fsopts.AttrTimeout = 1 * time.Second
 	fsopts.NegativeTimeout = 1 * time.Second
 	conn := nodefs.NewFileSystemConnector(nfs.Root(), fsopts)
+	f.notifier = nfs
 
-	server, err := fuse.NewServer(conn.RawFS(), f.FuseRoot, nil)
+	server, err := fuse.NewServer(conn.RawFS(), f.FuseRoot, f.mountOptions(opts))
 	if err != nil {
+		if f.AllowOther || f.AllowRoot {
+			return fmt.Errorf("%v (allow_other and allow_root require user_allow_other in /etc/fuse.conf)", err)
+		}
 		return err
 	}
 	f.FSServer = server
+	if f.Congestion > 0 {
+		if err := setCongestionThreshold(f.FuseRoot, f.Congestion); err != nil {
+			log.WithFields(log.Fields{
+				"threshold": f.Congestion,
+				"err":       err,
+			}).Warn("unable to set the congestion threshold of the FUSE connection")
+		}
+	}
 	return nil
 }
 
-// Serve initiates the FUSE loop. This is a blocking call.
+// Serve initiates the FUSE loop. This is a blocking call. OnServing is called once the first request was served.
 func (f *FuseFS) Serve() {
+	if f.OnServing != nil {
+		go f.signalServing(f.FSServer.WaitMount)
+	}
 	f.FSServer.Serve()
 }
 
-// Unmount drops the currently mounted Fuse filesystem. This should be called at exit. Note there is still room for data that is left behind, if
-// a user has an open file handle that resides within FUSE, the file system will not cleanly unmount.
-// TODO: add check for open files under Root mount?
-func (f *FuseFS) Unmount() {
+// Unmount drops the currently mounted Fuse filesystem. This should be called at exit. If a user has an open file handle that
+// resides within FUSE, the file system will not cleanly unmount, the `OnBusyUnmount` policy decides how open handles are
+// treated: wait for them to close (up to `UnmountTimeout`), force the unmount regardless, or fail with EBUSY. A mount
+// the kernel still reports busy, e.g. the working directory of a shell, is detached lazily unless the policy is fail.
+func (f *FuseFS) Unmount() error {
+	policy, timeout := f.unmountPolicy()
+	if open := f.handles.count(); open > 0 {
+		log.WithFields(log.Fields{
+			"handles": open,
+			"policy":  policy,
+		}).Warn("unmounting with open file handles")
+
+		switch policy {
+		case UnmountFail:
+			return syscall.EBUSY
+		case UnmountWait:
+			if !f.handles.waitIdle(timeout) {
+				return syscall.EBUSY
+			}
+		}
+	}
+
 	log.Infof("Unmounting FUSE filesystem at FuseRoot=%s ...", f.FuseRoot)
-	f.FSServer.Unmount()
+	if f.FSServer == nil {
+		return nil
+	}
+	return f.lazyFallback(f.FSServer.Unmount())
+}
+
+// unmountPolicy returns the OnBusyUnmount policy and UnmountTimeout in effect, which a reload may change.
+func (f *FuseFS) unmountPolicy() (string, time.Duration) {
+	f.configMu.RLock()
+	defer f.configMu.RUnlock()
+	return f.OnBusyUnmount, f.UnmountTimeout
+}
+
+// lazyFallback handles the error `err` of unmounting the server. When the mount is busy it is detached from the tree
+// lazily (`fusermount -uz`), the kernel completes the unmount once the last reference to it is gone.
+func (f *FuseFS) lazyFallback(err error) error {
+	if policy, _ := f.unmountPolicy(); err == nil || policy == UnmountFail || !isBusy(err) {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"err": err,
+	}).Warn("mount is busy, detaching it lazily")
+	if lazyErr := lazyUnmount(f.FuseRoot); lazyErr != nil {
+		log.WithFields(log.Fields{
+			"err": lazyErr,
+		}).Error("lazy unmount failed")
+		return err
+	}
+	return nil
+}
+
+// isBusy reports whether an unmount failed as the mount is in use. fusermount only reports the reason on stderr,
+// which go-fuse hands back as the error text.
+func isBusy(err error) bool {
+	return err == syscall.EBUSY || strings.Contains(err.Error(), "busy")
+}
+
+// lazyUnmount detaches the mount at `mountpoint`, leaving the kernel to complete the unmount once it is no longer
+// busy. It is replaced by tests.
+var lazyUnmount = func(mountpoint string) error {
+	out, err := exec.Command("fusermount", "-u", "-z", mountpoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v", strings.TrimSpace(string(out)), err)
+	}
+	return nil
 }
@@ -1,9 +1,18 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestDirPermissions(t *testing.T) {
@@ -16,3 +25,693 @@ func TestFilePermissions(t *testing.T) {
 	assert.Equal(t, filePermissions(true), IfRegRW)
 	assert.Equal(t, filePermissions(false), IfRegRO)
 }
+
+func TestIsSequential(t *testing.T) {
+	assert.True(t, isSequential("locks/lock-0000000042"))
+	assert.False(t, isSequential("locks/lock-42"))
+	assert.False(t, isSequential("locks/config"))
+}
+
+// TestGetAttrCreateModeBits verifies ephemeral and sequential znodes are flagged via the sticky and setgid bits.
+func TestGetAttrCreateModeBits(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "locks/lock-0000000001").Return(true, &zk.Stat{EphemeralOwner: 1234}, nil)
+	mockZooKeeper.zk.On("Exists", "locks/config").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "queue/item-0000000007").Return(true, &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, ShowCreateMode: true}
+
+	attr, status := fs.GetAttr("locks/lock-0000000001", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.S_IFREG|IfRegRO|ModeEphemeral|ModeSequential, attr.Mode)
+
+	attr, _ = fs.GetAttr("locks/config", nil)
+	assert.Equal(t, fuse.S_IFREG|IfRegRO, attr.Mode)
+
+	attr, _ = fs.GetAttr("queue/item-0000000007", nil)
+	assert.Equal(t, fuse.S_IFREG|IfRegRO|ModeSequential, attr.Mode)
+
+	// without the flag the create mode is not surfaced.
+	fs.ShowCreateMode = false
+	attr, _ = fs.GetAttr("locks/lock-0000000001", nil)
+	assert.Equal(t, fuse.S_IFREG|IfRegRO, attr.Mode)
+}
+
+// TestStripPrefix verifies a configured prefix is hidden on read and re-added on write.
+func TestStripPrefix(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("HDR1{}"), &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("HDR1new"), int32(1)).Return(&zk.Stat{Version: 2, DataLength: 7}, nil)
+	mockZooKeeper.zk.On("Get", "app/plain").Return([]byte("{}"), &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Set", "app/plain", []byte("new"), int32(1)).Return(&zk.Stat{Version: 2, DataLength: 3}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, StripPrefixes: []PathRule{{Pattern: "app/*", Value: "HDR1"}}}
+
+	file, status := fs.Open("app/config", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, 16)
+	res, _ := file.Read(buf, 0)
+	data, _ := res.Bytes(buf)
+	assert.Equal(t, []byte("{}"), data)
+
+	written, status := file.Write([]byte("new"), 0)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(3), written)
+
+	// a znode lacking the prefix is presented, and written back, untouched.
+	file, _ = fs.Open("app/plain", uint32(0), nil)
+	res, _ = file.Read(buf, 0)
+	data, _ = res.Bytes(buf)
+	assert.Equal(t, []byte("{}"), data)
+	written, status = file.Write([]byte("new"), 0)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(3), written)
+}
+
+// TestCreateRollback verifies the znode created by Create is deleted again when the first write fails.
+func TestCreateRollback(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	data := []byte("data")
+	mockZooKeeper.zk.On("Create", "app/new", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/new", nil)
+	mockZooKeeper.zk.On("Set", "app/new", data, int32(0)).Return((*zk.Stat)(nil), zk.ErrNoAuth)
+	mockZooKeeper.zk.On("Delete", "app/new").Return(nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	file, status := fs.Create("app/new", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+
+	_, status = file.Write(data, 0)
+	assert.Equal(t, fuse.EACCES, status)
+	mockZooKeeper.zk.AssertCalled(t, "Delete", "app/new")
+}
+
+// TestCreateRollbackRetry verifies a rolled back create releases its bookkeeping, so the create counts neither
+// towards MaxCreates nor as an open handle, and a retried create of the same path succeeds.
+func TestCreateRollbackRetry(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	data := []byte("data")
+	mockZooKeeper.zk.On("Create", "app/new", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/new", nil)
+	mockZooKeeper.zk.On("Set", "app/new", data, int32(0)).Return((*zk.Stat)(nil), zk.ErrConnectionClosed).Once()
+	mockZooKeeper.zk.On("Set", "app/new", data, int32(0)).Return(&zk.Stat{Version: 1, DataLength: 4}, nil)
+	mockZooKeeper.zk.On("Delete", "app/new").Return(nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, MaxCreates: 1}
+	file, status := fs.Create("app/new", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write(data, 0)
+	assert.Equal(t, fuse.EIO, status)
+	assert.Equal(t, 0, fs.handles.count())
+
+	file, status = fs.Create("app/new", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write(data, 0)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, 1, fs.handles.count())
+
+	// the handle of the rolled back create is released once only.
+	file.Release()
+	assert.Equal(t, 0, fs.handles.count())
+}
+
+// TestCreateNoRollback verifies a successfully written znode is kept, even when a later write fails.
+func TestCreateNoRollback(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	data := []byte("data")
+	mockZooKeeper.zk.On("Create", "app/new", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/new", nil)
+	mockZooKeeper.zk.On("Set", "app/new", data, int32(0)).Return(&zk.Stat{Version: 1, DataLength: 4}, nil)
+	mockZooKeeper.zk.On("Set", "app/new", data, int32(1)).Return((*zk.Stat)(nil), zk.ErrNoAuth)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	file, _ := fs.Create("app/new", uint32(0), uint32(0), nil)
+
+	_, status := file.Write(data, 0)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write(data, 0)
+	assert.Equal(t, fuse.EACCES, status)
+	mockZooKeeper.zk.AssertNotCalled(t, "Delete", "app/new")
+}
+
+// TestNamePattern verifies created znode names are checked against the name pattern.
+func TestNamePattern(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Create", "app/service-a", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/service-a", nil)
+	mockZooKeeper.zk.On("Create", "app/config", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/config", nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, NamePattern: regexp.MustCompile(`^[a-z0-9-]+$`)}
+
+	_, status := fs.Create("app/service-a", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.OK, fs.Mkdir("app/config", uint32(0), nil))
+
+	_, status = fs.Create("app/Service A", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.EINVAL, status)
+	assert.Equal(t, fuse.EINVAL, fs.Mkdir("app/UPPER", uint32(0), nil))
+	// only the name is matched, not the parent path.
+	_, status = fs.Create("App Dir/service_b", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.EINVAL, status)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Create", 2)
+}
+
+// TestContextOwner verifies files are reported as owned by the requesting uid/gid.
+func TestContextOwner(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	context := &fuse.Context{Owner: fuse.Owner{Uid: 1042, Gid: 2042}}
+
+	attr, status := fs.GetAttr("app/config", context)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.Owner{Uid: 1042, Gid: 2042}, attr.Owner)
+
+	attr, _ = fs.GetAttr("", context)
+	assert.Equal(t, uint32(1042), attr.Uid)
+
+	file, status := fs.Open("app/config", uint32(0), context)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(1042), file.(*FuseFile).attr.Uid)
+
+	// without a request context the ZooFuse process owner is reported.
+	attr, _ = fs.GetAttr("app/config", nil)
+	assert.Equal(t, *fuse.CurrentOwner(), attr.Owner)
+}
+
+// TestMaxCreates verifies creates beyond the per session limit fail with ENOSPC.
+func TestMaxCreates(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Create", "app/a", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/a", nil)
+	mockZooKeeper.zk.On("Create", "app/b", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("", zk.ErrNodeExists)
+	mockZooKeeper.zk.On("Create", "app/c", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/c", nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, MaxCreates: 2}
+
+	_, status := fs.Create("app/a", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	// a failed create does not count towards the limit.
+	_, status = fs.Create("app/b", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.Status(syscall.EEXIST), status)
+	assert.Equal(t, fuse.OK, fs.Mkdir("app/c", uint32(0), nil))
+
+	_, status = fs.Create("app/d", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.Status(syscall.ENOSPC), status)
+	assert.Equal(t, fuse.Status(syscall.ENOSPC), fs.Mkdir("app/e", uint32(0), nil))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Create", 3)
+}
+
+// TestOpenDirManyChildren verifies every child of a large directory is listed, in order and after the ZNodeMarker.
+// Run with -race to verify the workers do not race on the result.
+func TestOpenDirManyChildren(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	var children []string
+	for i := 0; i < 150; i++ {
+		children = append(children, fmt.Sprintf("child-%03d", i))
+	}
+	mockZooKeeper.zk.On("Children", "dir").Return(children, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "dir/child-042").Return(false, (*zk.Stat)(nil), nil)
+	mockZooKeeper.zk.On("Exists", mock.Anything).Return(true, &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	entries, status := fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.DirEntry{Name: ZNodeMarker, Mode: fuse.S_IFREG}, entries[0])
+
+	// the vanished child is skipped, the remaining ones keep their order.
+	var expected []fuse.DirEntry
+	for _, child := range children {
+		if child != "child-042" {
+			expected = append(expected, fuse.DirEntry{Name: child, Mode: fuse.S_IFREG})
+		}
+	}
+	assert.Equal(t, expected, entries[1:])
+}
+
+// TestAtimeMtime verifies the mtime atime mode reports the znode modification time as the access time.
+func TestAtimeMtime(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	stat := &zk.Stat{Mtime: 1546300800123}
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, stat, nil)
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), stat, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, AtimeMode: AtimeMtime}
+	attr, status := fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint64(1546300800), attr.Atime)
+	assert.Equal(t, attr.Mtime, attr.Atime)
+
+	file, _ := fs.Open("app/config", uint32(0), nil)
+	assert.Equal(t, uint64(1546300800), file.(*FuseFile).attr.Atime)
+
+	fs.AtimeMode = AtimeNow
+	attr, _ = fs.GetAttr("app/config", nil)
+	assert.True(t, attr.Atime > attr.Mtime)
+}
+
+// TestMarkerSize verifies the ZNodeMarker of a directory holding data reports the data length of the parent znode
+// as its size, so the data is read in full.
+func TestMarkerSize(t *testing.T) {
+	conn := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	conn.zk.On("Exists", "/app").Return(true, &zk.Stat{DataLength: 12, NumChildren: 2}, nil)
+	conn.zk.On("Get", "/app").Return([]byte("parent data!"), &zk.Stat{DataLength: 12, NumChildren: 2}, nil)
+
+	fs := &FuseFS{zh: &ZooHandle{zk: conn}}
+	attr, status := fs.GetAttr("app/"+ZNodeMarker, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.True(t, attr.IsRegular())
+	assert.Equal(t, uint64(12), attr.Size)
+
+	file, status := fs.Open("app/"+ZNodeMarker, uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, attr.Size)
+	result, _ := file.Read(buf, 0)
+	data, _ := result.Bytes(buf)
+	assert.Equal(t, "parent data!", string(data))
+}
+
+// TestOpenDirLazyModes verifies children are listed without being stat'ed with LazyModes, their mode left unknown.
+func TestOpenDirLazyModes(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "dir").Return([]string{"a", "b"}, &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, LazyModes: true}
+	entries, status := fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, []fuse.DirEntry{
+		{Name: ZNodeMarker, Mode: fuse.S_IFREG},
+		{Name: "a"},
+		{Name: "b"},
+	}, entries)
+	mockZooKeeper.zk.AssertNotCalled(t, "Exists", mock.Anything)
+}
+
+// countingZooHandle answers Children and Exists after a simulated round trip, counting the calls made and the most
+// Exists calls seen in flight at once.
+type countingZooHandle struct {
+	Zoohandler
+	children   []string
+	roundTrip  time.Duration
+	childCalls int64
+	existCalls int64
+	inFlight   int64
+	peak       int64
+}
+
+func (c *countingZooHandle) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
+	atomic.AddInt64(&c.childCalls, 1)
+	time.Sleep(c.roundTrip)
+	return c.children, &zk.Stat{NumChildren: int32(len(c.children))}, nil
+}
+
+func (c *countingZooHandle) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	atomic.AddInt64(&c.existCalls, 1)
+	n := atomic.AddInt64(&c.inFlight, 1)
+	defer atomic.AddInt64(&c.inFlight, -1)
+	for peak := atomic.LoadInt64(&c.peak); n > peak && !atomic.CompareAndSwapInt64(&c.peak, peak, n); {
+		peak = atomic.LoadInt64(&c.peak)
+	}
+	time.Sleep(c.roundTrip)
+	return true, &zk.Stat{}, nil
+}
+
+// TestOpenDirMaxConcurrency verifies the children of a directory are stat'ed by at most MaxConcurrency requests at
+// once, serially with a concurrency of 1.
+func TestOpenDirMaxConcurrency(t *testing.T) {
+	var children []string
+	for i := 0; i < 40; i++ {
+		children = append(children, fmt.Sprintf("child-%02d", i))
+	}
+	for _, tc := range []struct {
+		concurrency int
+		peak        int64
+	}{
+		{1, 1},
+		{8, 8},
+		{0, MaxConcurrentRequests},
+	} {
+		zh := &countingZooHandle{children: children, roundTrip: 5 * time.Millisecond}
+		fs := &FuseFS{zh: zh, MaxConcurrency: tc.concurrency}
+		entries, status := fs.OpenDir("dir", nil)
+		assert.Equal(t, fuse.OK, status)
+		assert.Len(t, entries, len(children)+1)
+		assert.Equal(t, int64(len(children)), zh.existCalls)
+		assert.True(t, zh.peak <= tc.peak, "concurrency %d peaked at %d", tc.concurrency, zh.peak)
+		if tc.concurrency == 1 {
+			assert.Equal(t, int64(1), zh.peak)
+		} else {
+			assert.True(t, zh.peak > 1, "concurrency %d ran serially", tc.concurrency)
+		}
+	}
+}
+
+// BenchmarkOpenDir compares listing a directory of 2000 znodes with and without LazyModes, reporting the ZK calls
+// made per listing.
+func BenchmarkOpenDir(b *testing.B) {
+	var children []string
+	for i := 0; i < 2000; i++ {
+		children = append(children, fmt.Sprintf("child-%04d", i))
+	}
+	for _, lazy := range []bool{false, true} {
+		b.Run(fmt.Sprintf("lazymodes=%t", lazy), func(b *testing.B) {
+			zh := &countingZooHandle{children: children, roundTrip: 100 * time.Microsecond}
+			fs := &FuseFS{zh: zh, LazyModes: lazy}
+			for i := 0; i < b.N; i++ {
+				fs.OpenDir("dir", nil)
+			}
+			b.ReportMetric(float64(zh.childCalls+zh.existCalls)/float64(b.N), "zkcalls/op")
+		})
+	}
+}
+
+// TestOpenDirChildRetry verifies a child whose stat fails once is retried and listed, while a child failing past
+// the retries is left out.
+func TestOpenDirChildRetry(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "dir").Return([]string{"flaky", "broken"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "dir/flaky").Return(false, (*zk.Stat)(nil), zk.ErrConnectionClosed).Once()
+	mockZooKeeper.zk.On("Exists", "dir/flaky").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "dir/broken").Return(false, (*zk.Stat)(nil), zk.ErrConnectionClosed)
+
+	fs := &FuseFS{zh: mockZooKeeper, ChildRetries: 1}
+	entries, status := fs.OpenDir("dir", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, []fuse.DirEntry{{Name: ZNodeMarker, Mode: fuse.S_IFREG}, {Name: "flaky", Mode: fuse.S_IFREG}}, entries)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 4)
+}
+
+// TestRootAttr verifies the root of a chroot'ed mount reports the stat of the chroot znode, while the root of a mount
+// of the whole tree is synthetic.
+func TestRootAttr(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "").Return(true, &zk.Stat{Mtime: 1546300800123, Ctime: 1546214400000, DataLength: 7}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, ZKRoot: "/app"}
+	attr, status := fs.GetAttr("", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.True(t, attr.IsDir())
+	assert.Equal(t, uint64(1546300800), attr.Mtime)
+	assert.Equal(t, uint64(1546214400), attr.Ctime)
+	assert.Equal(t, uint64(7), attr.Size)
+
+	fs = &FuseFS{zh: mockZooKeeper, ZKRoot: "/"}
+	attr, status = fs.GetAttr("", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.True(t, attr.IsDir())
+	assert.Equal(t, uint64(0), attr.Mtime)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 1)
+}
+
+// TestOpenDirNonexistent verifies listing a nonexistent path returns ENOENT rather than a lone ZNodeMarker.
+func TestOpenDirNonexistent(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "app/missing").Return([]string(nil), (*zk.Stat)(nil), zk.ErrNoNode)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	entries, status := fs.OpenDir("app/missing", nil)
+	assert.Equal(t, fuse.ENOENT, status)
+	assert.Empty(t, entries)
+	// a missing directory is a plain lookup miss, not an error of the mount.
+	assert.Empty(t, fs.errors.snapshot())
+}
+
+// TestAccess verifies the R_OK, W_OK and X_OK checks against read-only and read/write mounts.
+func TestAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		rw       bool
+		path     string
+		mode     uint32
+		expected fuse.Status
+	}{
+		{"ro read file", false, "app/file", fuse.R_OK, fuse.OK},
+		{"ro write file", false, "app/file", fuse.W_OK, fuse.EACCES},
+		{"ro read write file", false, "app/file", fuse.R_OK | fuse.W_OK, fuse.EACCES},
+		{"ro exec file", false, "app/file", fuse.X_OK, fuse.EACCES},
+		{"ro exec dir", false, "app", fuse.X_OK, fuse.OK},
+		{"ro write dir", false, "app", fuse.W_OK, fuse.EACCES},
+		{"rw read file", true, "app/file", fuse.R_OK, fuse.OK},
+		{"rw write file", true, "app/file", fuse.W_OK, fuse.OK},
+		{"rw exec file", true, "app/file", fuse.X_OK, fuse.EACCES},
+		{"rw exec dir", true, "app", fuse.X_OK, fuse.OK},
+		{"rw write dir", true, "app", fuse.W_OK, fuse.OK},
+		{"rw read marker", true, "app/" + ZNodeMarker, fuse.R_OK, fuse.OK},
+		{"rw write marker", true, "app/" + ZNodeMarker, fuse.W_OK, fuse.EACCES},
+		{"ro exists", false, "app/file", fuse.F_OK, fuse.OK},
+		{"rw missing", true, "app/missing", fuse.R_OK, fuse.ENOENT},
+		{"ro missing", false, "app/missing", fuse.F_OK, fuse.ENOENT},
+	}
+
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Exists", "app/"+ZNodeMarker).Return(true, &zk.Stat{NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Exists", "app/file").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "app/missing").Return(false, (*zk.Stat)(nil), nil)
+
+	for _, tc := range tests {
+		fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: tc.rw}
+		assert.Equal(t, tc.expected, fs.Access(tc.path, tc.mode, nil), tc.name)
+	}
+}
+
+// TestSafeDelete verifies a delete racing a concurrent modification fails with EAGAIN.
+func TestSafeDelete(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app/stale").Return(true, &zk.Stat{Version: 3}, nil)
+	mockZooKeeper.zk.On("Delete", "app/stale").Return(zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Children", "app/dir").Return([]string{}, &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Delete", "app/dir").Return(zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Exists", "app/current").Return(true, &zk.Stat{Version: 4}, nil)
+	mockZooKeeper.zk.On("Delete", "app/current").Return(nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, SafeDelete: true}
+	assert.Equal(t, fuse.EAGAIN, fs.Unlink("app/stale", nil))
+	assert.Equal(t, fuse.EAGAIN, fs.Rmdir("app/dir", nil))
+	assert.Equal(t, fuse.OK, fs.Unlink("app/current", nil))
+}
+
+// TestStatFs verifies StatFs reports a sane synthetic filesystem, even when Zookeeper cannot be reached.
+func TestStatFs(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "").Return(true, &zk.Stat{NumChildren: 12}, nil).Once()
+	mockZooKeeper.zk.On("Exists", "").Return(false, (*zk.Stat)(nil), zk.ErrConnectionClosed)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	out := fs.StatFs("")
+	assert.Equal(t, uint32(MaxZnodeData), out.Bsize)
+	assert.NotZero(t, out.Blocks)
+	assert.Equal(t, out.Blocks-12, out.Bfree)
+
+	out = fs.StatFs("")
+	assert.NotNil(t, out)
+	assert.Equal(t, out.Blocks, out.Bfree)
+
+	// the block size follows the data limit the writes are checked against.
+	fs = &FuseFS{zh: mockZooKeeper, MaxZnode: 4096}
+	out = fs.StatFs("")
+	assert.Equal(t, uint32(4096), out.Bsize)
+	assert.Equal(t, uint32(4096), out.Frsize)
+}
+
+// TestCreateEphemeral verifies files are created as ephemeral znodes when the mount, or the name suffix, asks for it.
+func TestCreateEphemeral(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Create", "app/lock.ephemeral", []byte(nil), int32(zk.FlagEphemeral), zk.WorldACL(zk.PermAll)).Return("/app/lock.ephemeral", nil)
+	mockZooKeeper.zk.On("Create", "app/config", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/config", nil)
+	mockZooKeeper.zk.On("Create", "app/member", []byte(nil), int32(zk.FlagEphemeral), zk.WorldACL(zk.PermAll)).Return("/app/member", nil)
+	mockZooKeeper.zk.On("Create", "app/dir", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/dir", nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, EphemeralSuffix: ".ephemeral"}
+	_, status := fs.Create("app/lock.ephemeral", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = fs.Create("app/config", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+
+	fs = &FuseFS{zh: mockZooKeeper, IsReadWrite: true, Ephemeral: true}
+	_, status = fs.Create("app/member", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	// directories are always persistent.
+	assert.Equal(t, fuse.OK, fs.Mkdir("app/dir", uint32(0), nil))
+	mockZooKeeper.zk.AssertExpectations(t)
+}
+
+// TestMkdirTemplate verifies directory znodes created by Mkdir are seeded with the DirTemplate data, while files
+// are still created empty.
+func TestMkdirTemplate(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Create", "app/dir", []byte("{}"), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/dir", nil)
+	mockZooKeeper.zk.On("Create", "app/file", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/file", nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, DirTemplate: []byte("{}")}
+	assert.Equal(t, fuse.OK, fs.Mkdir("app/dir", uint32(0), nil))
+	_, status := fs.Create("app/file", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	mockZooKeeper.zk.AssertExpectations(t)
+}
+
+// TestCreateSequential verifies a name ending in the sequential marker creates a sequential znode, and the handle
+// writes to the name assigned by ZK.
+func TestCreateSequential(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	data := []byte("data")
+	mockZooKeeper.zk.On("Create", "queue/job-", []byte(nil), int32(zk.FlagSequence), zk.WorldACL(zk.PermAll)).Return("/root/queue/job-0000000007", nil)
+	mockZooKeeper.zk.On("Set", "queue/job-0000000007", data, int32(0)).Return(&zk.Stat{Version: 1}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	file, status := fs.Create("queue/job-+", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write(data, 0)
+	assert.Equal(t, fuse.OK, status)
+
+	// the marker alone leaves no name to sequence.
+	_, status = fs.Create("queue/+", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.EINVAL, status)
+	mockZooKeeper.zk.AssertExpectations(t)
+}
+
+// TestOpenSync verifies the connected server is synced with the leader before the znode is read, when enabled.
+func TestOpenSync(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	var calls []string
+	mockZooKeeper.zk.On("Sync", "app/config").Return("/app/config", nil).Run(func(mock.Arguments) { calls = append(calls, "Sync") })
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{}, nil).Run(func(mock.Arguments) { calls = append(calls, "Get") })
+	mockZooKeeper.zk.On("Sync", "app/lagging").Return("", zk.ErrConnectionClosed)
+
+	fs := &FuseFS{zh: mockZooKeeper, SyncReads: true}
+	_, status := fs.Open("app/config", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, []string{"Sync", "Get"}, calls)
+
+	_, status = fs.Open("app/lagging", uint32(0), nil)
+	assert.Equal(t, fuse.EIO, status)
+
+	// without the flag znodes are read straight away.
+	calls = nil
+	fs.SyncReads = false
+	fs.Open("app/config", uint32(0), nil)
+	assert.Equal(t, []string{"Get"}, calls)
+}
+
+// TestRmdir verifies znodes without children are removed and znodes holding children are refused with ENOTEMPTY.
+func TestRmdir(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "app/empty").Return([]string{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Delete", "app/empty").Return(nil)
+	mockZooKeeper.zk.On("Children", "app/full").Return([]string{"child"}, &zk.Stat{NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Children", "app/missing").Return([]string(nil), (*zk.Stat)(nil), zk.ErrNoNode)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.OK, fs.Rmdir("app/empty", nil))
+	assert.Equal(t, fuse.Status(syscall.ENOTEMPTY), fs.Rmdir("app/full", nil))
+	assert.Equal(t, fuse.ENOENT, fs.Rmdir("app/missing", nil))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Delete", 1)
+}
+
+// TestRmdirRecursive verifies the whole subtree is removed, children first, when recursive removal is enabled.
+func TestRmdirRecursive(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	var deleted []string
+	record := func(args mock.Arguments) { deleted = append(deleted, args.String(0)) }
+	mockZooKeeper.zk.On("Children", "app").Return([]string{"a"}, &zk.Stat{NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Children", "app/a").Return([]string{"b"}, &zk.Stat{NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Children", "app/a/b").Return([]string{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Delete", mock.Anything).Return(nil).Run(record)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, RecursiveRmdir: true}
+	assert.Equal(t, fuse.OK, fs.Rmdir("app", nil))
+	assert.Equal(t, []string{"app/a/b", "app/a", "app"}, deleted)
+}
+
+// TestMountOptions verifies the mount options reflect the allow-other, allow-root and maxbackground settings.
+func TestMountOptions(t *testing.T) {
+	fs := &FuseFS{}
+	opts := fs.mountOptions(nil)
+	assert.False(t, opts.AllowOther)
+	assert.Empty(t, opts.Options)
+	assert.Equal(t, maxBackground, opts.MaxBackground)
+
+	fs = &FuseFS{AllowOther: true}
+	opts = fs.mountOptions([]string{"ro"})
+	assert.True(t, opts.AllowOther)
+	assert.Equal(t, []string{"ro"}, opts.Options)
+
+	fs = &FuseFS{AllowRoot: true}
+	opts = fs.mountOptions(nil)
+	assert.False(t, opts.AllowOther)
+	assert.Equal(t, []string{"allow_root"}, opts.Options)
+
+	fs = &FuseFS{MaxBackground: 64, Congestion: 48}
+	assert.Equal(t, 64, fs.mountOptions(nil).MaxBackground)
+}
+
+// TestTruncate verifies truncating a path resizes the znode data, dropping the data past the size or padding it with
+// zeros, and that a truncate to the current size saves the write.
+func TestTruncate(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("abcd"), &zk.Stat{Version: 3}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("ab"), int32(3)).Return(&zk.Stat{Version: 4}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("abcd\x00\x00"), int32(3)).Return(&zk.Stat{Version: 4}, nil)
+	mockZooKeeper.zk.On("Get", "app/busy").Return([]byte("abcd"), &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Set", "app/busy", []byte{}, int32(1)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.OK, fs.Truncate("app/config", 2, nil))
+	assert.Equal(t, fuse.OK, fs.Truncate("app/config", 6, nil))
+	assert.Equal(t, fuse.OK, fs.Truncate("app/config", 4, nil))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 2)
+
+	assert.Equal(t, fuse.Status(syscall.EFBIG), fs.Truncate("app/config", MaxZnodeData+1, nil))
+	assert.Equal(t, fuse.EAGAIN, fs.Truncate("app/busy", 0, nil))
+
+	fs = &FuseFS{zh: mockZooKeeper}
+	assert.Equal(t, fuse.EROFS, fs.Truncate("app/config", 0, nil))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 3)
+}
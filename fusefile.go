@@ -1,20 +1,46 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/hanwen/go-fuse/fuse"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/samuel/go-zookeeper/zk"
 	log "github.com/sirupsen/logrus"
 )
 
+// MaxWriteRetries is the default number of times a write is retried against a refreshed znode version when the
+// znode was modified since it was read (see the `retrybadversion` flag).
+const MaxWriteRetries = 3
+
 // FuseFile is the file object container. FuseFile implements the bare minmum system calls (`read` and `write`)
 type FuseFile struct {
 	nodefs.File
-	data []byte     // contents of the file
-	attr *fuse.Attr // file mode attributes
-	zh   Zoohandler // reference to the zookeeper connection
-	path string     // path of the file
+	data            []byte     // contents of the file
+	attr            *fuse.Attr // file mode attributes
+	zh              Zoohandler // reference to the zookeeper connection
+	path            string     // path of the file
+	version         int32      // znode version the data was read at, -1 when unknown (unconditional writes)
+	retryBadVersion int        // number of times a write is retried against a refreshed version on ErrBadVersion
+	prefix          []byte     // header stripped from the znode data on read, re-added on write
+	created         bool       // znode was created by this handle and has not been written yet
+	base64          bool       // data is presented base64 encoded, writes are decoded before reaching ZK
+	release         func()     // called once the handle is released, unregistering it from the open handles
+	errors          *errorLog  // failed writes are recorded here, when set
+	budget          budgetFunc // refuses writes exceeding a size budget, when set
+	append          bool       // opened with O_APPEND, writes are added to the end of the known data
+	utf8            bool       // writes holding invalid UTF-8 are refused with EINVAL
+	dirty           bool       // data was truncated since it was last written to ZK
+	syncWrites      bool       // writes are only reported successful once synced with the leader
+	maxData         int        // largest znode data written, larger writes fail with EFBIG (MaxZnodeData when 0)
+	invalidate      func()     // invalidates the kernel cache of the file once written, when set
+	cas             bool       // version was set through XAttrCAS, a write to a moved znode fails with ESTALE
+	rolledBack      func()     // called once the znode created alongside the handle was rolled back, when set
 }
 
 func NewFuseFile(data []byte, mode uint32, path string, zh Zoohandler) *FuseFile {
@@ -27,14 +53,24 @@ func NewFuseFile(data []byte, mode uint32, path string, zh Zoohandler) *FuseFile
 		Owner: *fuse.CurrentOwner(),
 	}
 	return &FuseFile{data: data,
-		File: nodefs.NewDefaultFile(),
-		attr: attr,
-		path: path,
-		zh:   zh}
+		File:    nodefs.NewDefaultFile(),
+		attr:    attr,
+		path:    path,
+		zh:      zh,
+		version: -1}
 }
 
-// Read implements a simple buffer read operation required for file access.
+// Read implements a simple buffer read operation required for file access. A read starting at or beyond the end of
+// the data is EOF and returns an empty result, as kernels and tools may read speculatively past the end. A negative
+// offset is rejected with EINVAL.
 func (f *FuseFile) Read(buf []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	if off < 0 {
+		return nil, fuse.EINVAL
+	}
+	if off >= int64(len(f.data)) {
+		return fuse.ReadResultData([]byte{}), fuse.OK
+	}
+
 	end := int(off) + int(len(buf))
 	if end > len(f.data) {
 		end = len(f.data)
@@ -43,26 +79,301 @@ func (f *FuseFile) Read(buf []byte, off int64) (fuse.ReadResult, fuse.Status) {
 	return fuse.ReadResultData(f.data[off:end]), fuse.OK
 }
 
-// Write pushes the []byte array into the Zookeeper node. An array size of 0 is a (silent) no-op. Returns
-// the number of bytes written and the status of the errno returns to kernel.
-func (f *FuseFile) Write(content []byte, off int64) (uint32, fuse.Status) {
+// splice returns a copy of `data` with `content` written at `off`, growing it as needed. A gap between the end of
+// `data` and `off` is zero filled.
+func splice(data, content []byte, off int64) []byte {
+	size := len(data)
+	if end := int(off) + len(content); end > size {
+		size = end
+	}
+	out := make([]byte, size)
+	copy(out, data)
+	copy(out[off:], content)
+	return out
+}
+
+// Write splices the []byte array into the file buffer at `off` and pushes the full buffer into the Zookeeper node.
+// An array size of 0 is a (silent) no-op. Returns the number of bytes consumed from `content` and the status of the
+// errno returns to kernel.
+func (f *FuseFile) Write(content []byte, off int64) (written uint32, code fuse.Status) {
+	ctx := traceRequest(nil, "Write", f.path)
 
 	// save a round trip to zk in the event the content length is 0
 	if len(content) == 0 {
 		return 0, fuse.OK
 	}
 
-	// TODO: what is the implication of Set(..) with a version of -1. My assumption is that
-	// it overwrites (resets) the current znode version in ZK.
-	stat, err := f.zh.Set(f.path, content, -1)
+	if f.created {
+		defer func() {
+			if !code.Ok() {
+				f.rollbackCreate(ctx)
+			}
+			f.created = false
+		}()
+	}
+
+	if off < 0 {
+		return 0, fuse.EINVAL
+	}
+	// appends go to the end of the buffer held by the handle, which saves re-reading the znode for each write.
+	if f.append {
+		off = int64(len(f.data))
+	}
+	data := splice(f.data, content, off)
+	if status := f.push(ctx, data, content, off); !status.Ok() {
+		return 0, status
+	}
+	return uint32(len(content)), fuse.OK
+}
+
+// push writes the file `data` to the znode, `content` being the part of it written by the caller at `off` (re-applied
+// when the write is retried). On success the data becomes the content of the file.
+func (f *FuseFile) push(ctx context.Context, data, content []byte, off int64) fuse.Status {
+	payload, err := f.payload(data)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": f.path,
+			"err":  err,
+		}).Warn("invalid base64 data written")
+		return fuse.EINVAL
+	}
+	if f.utf8 && !utf8.Valid(payload) {
+		log.WithFields(log.Fields{
+			"path": f.path,
+		}).Warn("invalid UTF-8 written to a text path")
+		return fuse.EINVAL
+	}
+
+	// Zookeeper refuses znode data past its limit, which is reported as "file too large" rather than an I/O error.
+	limit := MaxZnodeData
+	if f.maxData > 0 {
+		limit = f.maxData
+	}
+	if len(payload) > limit {
+		log.WithFields(log.Fields{
+			"path":  f.path,
+			"size":  len(payload),
+			"limit": limit,
+		}).Warn("write exceeds the znode data limit")
+		return fuse.Status(syscall.EFBIG)
+	}
+
+	if f.budget != nil {
+		if status := f.budget(ctx, f.path, int64(len(payload))); !status.Ok() {
+			return status
+		}
+	}
+
+	stat, err := f.zh.Set(ctx, f.path, payload, f.version)
+	status := zkErrToStatus(err)
+	// a compare-and-set write must fail once the znode moved past the expected version, rather than be retried. The
+	// mismatch is reported as ESTALE, telling it apart from a write given up on once its retries are exhausted (EIO).
+	if err == zk.ErrBadVersion && f.cas {
+		log.WithFields(log.Fields{
+			"path":    f.path,
+			"version": f.version,
+		}).Warn("znode moved past the version expected by the compare-and-set write")
+		status = fuse.Status(syscall.ESTALE)
+	} else if err == zk.ErrBadVersion {
+		stat, data, err = f.retrySet(ctx, data, content, off)
+		status = zkErrToStatus(err)
+		if err == zk.ErrBadVersion {
+			log.WithFields(log.Fields{
+				"path":    f.path,
+				"version": f.version,
+				"retries": f.retryBadVersion,
+			}).Warn("znode kept being modified since it was read, giving up on the write")
+			status = fuse.EIO
+		}
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"path": f.path,
 			"err":  err,
 		}).Warn("Failed to Set znode data")
-		return 0, fuse.EIO
+		if f.errors != nil {
+			f.errors.record("Write", f.path, err)
+		}
+		return status
+	}
+	if stat == nil {
+		log.WithFields(log.Fields{
+			"path": f.path,
+		}).Error("Set succeeded without returning the znode stat")
+		return fuse.EIO
+	}
+
+	f.version = stat.Version
+	f.data = data
+	f.attr.Size = uint64(len(data))
+	f.dirty = false
+	// the kernel may hold the pages of the inode locked until the write returns, so the invalidation is not awaited.
+	if f.invalidate != nil {
+		go f.invalidate()
+	}
+	if f.syncWrites {
+		return f.sync(ctx)
+	}
+	return fuse.OK
+}
+
+// resize returns `data` cut or zero filled to `size` bytes.
+func resize(data []byte, size int) []byte {
+	if size <= len(data) {
+		return data[:size]
+	}
+	return splice(data, nil, int64(size))
+}
+
+// Truncate resizes the file buffer, as happens when a file is opened with O_TRUNC. The change is held in memory and
+// reaches Zookeeper with the next write, Flush or Fsync.
+func (f *FuseFile) Truncate(size uint64) fuse.Status {
+	f.data = resize(f.data, int(size))
+	f.attr.Size = size
+	f.dirty = true
+	return fuse.OK
+}
+
+// Flush is called on each close of the file. Writes reach Zookeeper as they are made, so only a truncate held in
+// memory is pushed, its failure being reported by close. Once pushed, further flushes are no-ops.
+func (f *FuseFile) Flush() fuse.Status {
+	if !f.dirty {
+		return fuse.OK
+	}
+	return f.push(traceRequest(nil, "Flush", f.path), f.data, nil, 0)
+}
+
+// Fsync is a durability barrier. Writes reach Zookeeper as they are made, so only a truncate held in memory is
+// pushed, after which the connected server is synced with the leader so the data is seen by every client reading
+// from the ensemble.
+func (f *FuseFile) Fsync(flags int) fuse.Status {
+	ctx := traceRequest(nil, "Fsync", f.path)
+	if f.dirty {
+		if status := f.push(ctx, f.data, nil, 0); !status.Ok() {
+			return status
+		}
+		if f.syncWrites {
+			return fuse.OK
+		}
+	}
+	return f.sync(ctx)
+}
+
+// sync brings the connected server up to date with the leader for the znode of the file, confirming the writes
+// made so far are seen by every client of the ensemble.
+func (f *FuseFile) sync(ctx context.Context) fuse.Status {
+	if _, err := f.zh.Sync(ctx, f.path); err != nil {
+		log.WithFields(log.Fields{
+			"path": f.path,
+			"err":  err,
+		}).Error("unable to Sync znode with the leader")
+		if f.errors != nil {
+			f.errors.record("Sync", f.path, err)
+		}
+		return zkErrToStatus(err)
 	}
+	return fuse.OK
+}
+
+// present returns the file data presented for the znode data `znode`, the reverse of payload: the prefix is stripped
+// and the data base64 encoded as needed.
+func (f *FuseFile) present(znode []byte) []byte {
+	if len(f.prefix) > 0 {
+		znode = bytes.TrimPrefix(znode, f.prefix)
+	}
+	if f.base64 {
+		return []byte(base64.StdEncoding.EncodeToString(znode))
+	}
+	return znode
+}
 
-	f.attr.Size = uint64(stat.DataLength)
-	return uint32(stat.DataLength), fuse.OK
+// payload returns the znode data for the file `data`, base64 decoded and with the prefix re-added as needed.
+func (f *FuseFile) payload(data []byte) ([]byte, error) {
+	payload := data
+	if f.base64 {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil {
+			return nil, err
+		}
+		payload = decoded
+	}
+
+	if len(f.prefix) > 0 {
+		payload = append(append([]byte{}, f.prefix...), payload...)
+	}
+	return payload, nil
+}
+
+// rollbackCreate deletes the znode created alongside this handle when its first write fails, so a failed file
+// creation does not leave an orphaned empty znode behind. The delete is checked against the initial version, a
+// znode written to by someone else in the meantime is left alone. Once deleted, the bookkeeping of the create is
+// released and the handle no longer counts as open, so a retried create of the path starts afresh.
+func (f *FuseFile) rollbackCreate(ctx context.Context) {
+	if err := f.zh.Delete(ctx, f.path, 0); err != nil {
+		log.WithFields(log.Fields{
+			"path": f.path,
+			"err":  err,
+		}).Warn("unable to roll back znode after failed write")
+		return
+	}
+	log.WithFields(log.Fields{
+		"path": f.path,
+	}).Info("rolled back znode after failed write")
+	if f.rolledBack != nil {
+		f.rolledBack()
+		f.rolledBack = nil
+	}
+	if f.release != nil {
+		f.release()
+		f.release = nil
+	}
+}
+
+// retrySet re-fetches the latest znode data and version and retries the Set of the file up to `retryBadVersion`
+// times, smoothing over benign concurrent updates. The write is re-applied to the latest data rather than overwriting
+// the concurrent change: `content` is spliced in at `off`, or added to the end of the data for an append. A flush of
+// a pending truncate, without `content`, resizes the latest data to the size of the file. The data written is
+// returned alongside the stat. Once the retries are exhausted the ErrBadVersion is handed back to the
+// caller.
+func (f *FuseFile) retrySet(ctx context.Context, data, content []byte, off int64) (*zk.Stat, []byte, error) {
+	for retry := 0; retry < f.retryBadVersion; retry++ {
+		current, latest, err := f.zh.Get(ctx, f.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		current = f.present(current)
+		switch {
+		case content == nil:
+			// a pending truncate is re-applied to the latest data.
+			data = resize(current, len(data))
+		case f.append:
+			data = append(append([]byte{}, current...), content...)
+		default:
+			data = splice(current, content, off)
+		}
+		payload, err := f.payload(data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.WithFields(log.Fields{
+			"path":    f.path,
+			"version": latest.Version,
+			"retry":   retry + 1,
+		}).Debug("retrying write against refreshed znode version")
+		stat, err := f.zh.Set(ctx, f.path, payload, latest.Version)
+		if err != zk.ErrBadVersion {
+			return stat, data, err
+		}
+	}
+	return nil, nil, zk.ErrBadVersion
+}
+
+// Release is called once the kernel forgets the file handle. The buffered data is dropped along with it.
+func (f *FuseFile) Release() {
+	f.data = nil
+	if f.release != nil {
+		f.release()
+		f.release = nil
+	}
 }
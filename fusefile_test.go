@@ -1,6 +1,7 @@
 package main
 
 import (
+	"syscall"
 	"testing"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -16,15 +17,22 @@ func TestRead(t *testing.T) {
 	bytes := make([]byte, 3)
 	ff := NewFuseFile(bytes, 0, "mock/path", mockZooKeeper)
 
-	// assert that we can read from the Nth byte (n=3).
-	buf := []byte{}
-	_, b := ff.Read(buf, 3)
+	// assert that we can read from the Nth byte (n=3), which is EOF and yields no data.
+	buf := make([]byte, 4)
+	res, b := ff.Read(buf, 3)
 	assert.Equal(t, fuse.Status(0), b, "return status was not 0")
-	// assert that we panic when we attempt to read beyond the buffer length
-	// TODO: is this a bug in go-fuse https://github.com/hanwen/go-fuse/blob/master/fuse/nodefs/files.go#L46
-	// there is no upper boundry protection around the offset (off), so it allows to read beyond the buffer.
-	// Though I am not sure if this would be hit in a normal situation...
-	assert.Panics(t, func() { ff.Read(buf, int64(len(bytes)+1)) }, "did not panic when attempting to read beyond buffer")
+	data, _ := res.Bytes(buf)
+	assert.Empty(t, data)
+
+	// assert that reading from an offset beyond the buffer length is EOF rather than panicking.
+	assert.NotPanics(t, func() { res, b = ff.Read(buf, int64(len(bytes)+1)) })
+	assert.Equal(t, fuse.OK, b)
+	data, _ = res.Bytes(buf)
+	assert.Empty(t, data)
+
+	// assert that a negative offset is rejected.
+	assert.NotPanics(t, func() { _, b = ff.Read(buf, -1) })
+	assert.Equal(t, fuse.EINVAL, b)
 
 }
 
@@ -44,3 +52,347 @@ func TestWrite(t *testing.T) {
 	assert.Equal(t, uint32(3), size)
 	assert.Equal(t, fuse.OK, stat)
 }
+
+// TestWriteNilStat verifies a Set returning neither a stat nor an error fails the write with EIO, rather than
+// panicking.
+func TestWriteNilStat(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+
+	bytes := []byte("new")
+	ff := NewFuseFile([]byte("old"), 0, "mock/path", mockZooKeeper)
+
+	mockZooKeeper.zk.On("Set", "mock/path", bytes, int32(-1)).Return((*zk.Stat)(nil), nil)
+
+	size, stat := ff.Write(bytes, 0)
+	assert.Equal(t, uint32(0), size)
+	assert.Equal(t, fuse.EIO, stat)
+	assert.Equal(t, []byte("old"), ff.data)
+}
+
+// TestWriteBadVersion verifies a write against a stale version fails with EIO when retries are disabled.
+func TestWriteBadVersion(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+
+	bytes := []byte("new")
+	ff := NewFuseFile([]byte("old"), 0, "mock/path", mockZooKeeper)
+	ff.version = 3
+
+	mockZooKeeper.zk.On("Set", "mock/path", bytes, int32(3)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+
+	size, stat := ff.Write(bytes, 0)
+	assert.Equal(t, uint32(0), size)
+	assert.Equal(t, fuse.EIO, stat)
+}
+
+// TestWriteRetryBadVersion verifies a bad-version failure is retried with the refreshed znode version.
+func TestWriteRetryBadVersion(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+
+	bytes := []byte("new")
+	ff := NewFuseFile([]byte("old"), 0, "mock/path", mockZooKeeper)
+	ff.version = 3
+	ff.retryBadVersion = 2
+
+	mockZooKeeper.zk.On("Set", "mock/path", bytes, int32(3)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Get", "mock/path").Return([]byte("other"), &zk.Stat{Version: 5}, nil)
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("newer"), int32(5)).Return(&zk.Stat{Version: 6, DataLength: 5}, nil)
+
+	size, stat := ff.Write(bytes, 0)
+	assert.Equal(t, uint32(3), size)
+	assert.Equal(t, fuse.OK, stat)
+	assert.Equal(t, int32(6), ff.version)
+	assert.Equal(t, []byte("newer"), ff.data)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 2)
+}
+
+// TestWriteRetryKeepsConcurrentChange verifies a retried write is spliced into the latest data, so a concurrent change
+// to a different byte range survives rather than being overwritten by the stale buffer of the handle.
+func TestWriteRetryKeepsConcurrentChange(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+
+	ff := NewFuseFile([]byte("aaaa-bbbb"), 0, "mock/path", mockZooKeeper)
+	ff.version = 3
+	ff.retryBadVersion = MaxWriteRetries
+
+	// the handle rewrites the tail while someone else rewrote the head.
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("aaaa-BBBB"), int32(3)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Get", "mock/path").Return([]byte("AAAA-bbbb"), &zk.Stat{Version: 4}, nil)
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("AAAA-BBBB"), int32(4)).Return(&zk.Stat{Version: 5}, nil)
+
+	size, stat := ff.Write([]byte("BBBB"), 5)
+	assert.Equal(t, uint32(4), size)
+	assert.Equal(t, fuse.OK, stat)
+	assert.Equal(t, []byte("AAAA-BBBB"), ff.data)
+	mockZooKeeper.zk.AssertExpectations(t)
+}
+
+// TestWriteOffset verifies writes are spliced into the file data at their offset, and the full data is Set.
+func TestWriteOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		off      int64
+		expected []byte
+	}{
+		{"append at EOF", "456", 3, []byte("abc456")},
+		{"overwrite in the middle", "X", 1, []byte("aXc")},
+		{"write past the end", "Z", 5, []byte("abc\x00\x00Z")},
+	}
+
+	for _, tc := range tests {
+		mockZooKeeper := &MockZooHandle{
+			zk: mock.Mock{},
+		}
+		ff := NewFuseFile([]byte("abc"), 0, "mock/path", mockZooKeeper)
+		mockZooKeeper.zk.On("Set", "mock/path", tc.expected, int32(-1)).Return(&zk.Stat{DataLength: int32(len(tc.expected))}, nil)
+
+		size, stat := ff.Write([]byte(tc.content), tc.off)
+		assert.Equal(t, fuse.OK, stat, tc.name)
+		assert.Equal(t, uint32(len(tc.content)), size, tc.name)
+		assert.Equal(t, tc.expected, ff.data, tc.name)
+		assert.Equal(t, uint64(len(tc.expected)), ff.attr.Size, tc.name)
+	}
+}
+
+// TestWriteAfterTruncate verifies a file truncated on open is replaced by the data written after.
+func TestWriteAfterTruncate(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	ff := NewFuseFile([]byte("a long value"), 0, "mock/path", mockZooKeeper)
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("short"), int32(-1)).Return(&zk.Stat{DataLength: 5}, nil)
+
+	assert.Equal(t, fuse.OK, ff.Truncate(0))
+	size, stat := ff.Write([]byte("short"), 0)
+	assert.Equal(t, fuse.OK, stat)
+	assert.Equal(t, uint32(5), size)
+
+	// a failed write leaves the file data untouched.
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("shorter"), int32(0)).Return((*zk.Stat)(nil), zk.ErrNoAuth)
+	ff.version = 0
+	_, stat = ff.Write([]byte("er"), 5)
+	assert.Equal(t, fuse.EACCES, stat)
+	assert.Equal(t, []byte("short"), ff.data)
+}
+
+// TestWriteTooLarge verifies a write growing the znode data past MaxZnodeData is refused with EFBIG before reaching
+// Zookeeper.
+func TestWriteTooLarge(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	ff := NewFuseFile(nil, 0, "mock/path", mockZooKeeper)
+
+	_, stat := ff.Write(make([]byte, MaxZnodeData+1), 0)
+	assert.Equal(t, fuse.Status(syscall.EFBIG), stat)
+	assert.Empty(t, ff.data)
+	mockZooKeeper.zk.AssertNotCalled(t, "Set", "mock/path", mock.Anything, mock.Anything)
+
+	// the limit follows the configured -maxznode.
+	ff.maxData = 4
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("data"), int32(-1)).Return(&zk.Stat{DataLength: 4}, nil)
+	_, stat = ff.Write([]byte("data"), 0)
+	assert.Equal(t, fuse.OK, stat)
+	_, stat = ff.Write([]byte("!"), 4)
+	assert.Equal(t, fuse.Status(syscall.EFBIG), stat)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 1)
+}
+
+// TestWriteRetriesExhausted verifies a write still conflicting after MaxWriteRetries re-Gets fails with EIO.
+func TestWriteRetriesExhausted(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+
+	bytes := []byte("new")
+	ff := NewFuseFile([]byte("old"), 0, "mock/path", mockZooKeeper)
+	ff.version = 3
+	ff.retryBadVersion = MaxWriteRetries
+
+	mockZooKeeper.zk.On("Set", "mock/path", mock.Anything, mock.Anything).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Get", "mock/path").Return([]byte("other"), &zk.Stat{Version: 5}, nil)
+
+	_, stat := ff.Write(bytes, 0)
+	assert.Equal(t, fuse.EIO, stat)
+	assert.Equal(t, []byte("old"), ff.data)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", MaxWriteRetries)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", MaxWriteRetries+1)
+	mockZooKeeper.zk.AssertNotCalled(t, "Set", "mock/path", bytes, int32(-1))
+}
+
+// TestWriteAppend verifies appends are added to the buffer held by the handle without re-reading the znode.
+func TestWriteAppend(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/log").Return([]byte("one\n"), &zk.Stat{Version: 1}, nil).Once()
+	mockZooKeeper.zk.On("Set", "app/log", []byte("one\ntwo\n"), int32(1)).Return(&zk.Stat{Version: 2}, nil)
+	mockZooKeeper.zk.On("Set", "app/log", []byte("one\ntwo\nthree\n"), int32(2)).Return(&zk.Stat{Version: 3}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	file, status := fs.Open("app/log", uint32(syscall.O_WRONLY|syscall.O_APPEND), nil)
+	assert.Equal(t, fuse.OK, status)
+
+	// the offset handed in is ignored, appends always go to the end of the known data.
+	_, status = file.Write([]byte("two\n"), 0)
+	assert.Equal(t, fuse.OK, status)
+	written, status := file.Write([]byte("three\n"), 4)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(6), written)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", 1)
+}
+
+// TestWriteAppendConflict verifies an append conflicting with a concurrent change is re-applied to the latest data.
+func TestWriteAppendConflict(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	ff := NewFuseFile([]byte("one\n"), 0, "app/log", mockZooKeeper)
+	ff.version = 1
+	ff.retryBadVersion = MaxWriteRetries
+	ff.append = true
+
+	mockZooKeeper.zk.On("Set", "app/log", []byte("one\ntwo\n"), int32(1)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Get", "app/log").Return([]byte("one\nother\n"), &zk.Stat{Version: 2}, nil)
+	mockZooKeeper.zk.On("Set", "app/log", []byte("one\nother\ntwo\n"), int32(2)).Return(&zk.Stat{Version: 3}, nil)
+
+	_, status := ff.Write([]byte("two\n"), 4)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, []byte("one\nother\ntwo\n"), ff.data)
+	assert.Equal(t, int32(3), ff.version)
+}
+
+// TestWriteAppendConflictBase64 verifies a conflicting append through a base64 view is re-applied to the encoded
+// latest data, so the retried payload still decodes.
+func TestWriteAppendConflictBase64(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	ff := NewFuseFile([]byte("b25l"), 0, "app/bin", mockZooKeeper)
+	ff.version = 1
+	ff.retryBadVersion = MaxWriteRetries
+	ff.append = true
+	ff.base64 = true
+
+	mockZooKeeper.zk.On("Set", "app/bin", []byte("onetwo"), int32(1)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Get", "app/bin").Return([]byte("six"), &zk.Stat{Version: 2}, nil)
+	mockZooKeeper.zk.On("Set", "app/bin", []byte("sixtwo"), int32(2)).Return(&zk.Stat{Version: 3}, nil)
+
+	_, status := ff.Write([]byte("dHdv"), 4)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, []byte("c2l4dHdv"), ff.data)
+}
+
+// TestFlushConflictAppend verifies a conflicting flush of a pending truncate on an O_APPEND handle re-applies the
+// truncate to the latest data, rather than dropping it.
+func TestFlushConflictAppend(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	ff := NewFuseFile([]byte("one\n"), 0, "app/log", mockZooKeeper)
+	ff.version = 1
+	ff.retryBadVersion = MaxWriteRetries
+	ff.append = true
+
+	mockZooKeeper.zk.On("Set", "app/log", []byte{}, int32(1)).Return((*zk.Stat)(nil), zk.ErrBadVersion)
+	mockZooKeeper.zk.On("Get", "app/log").Return([]byte("one\nother\n"), &zk.Stat{Version: 2}, nil)
+	mockZooKeeper.zk.On("Set", "app/log", []byte{}, int32(2)).Return(&zk.Stat{Version: 3}, nil)
+
+	assert.Equal(t, fuse.OK, ff.Truncate(0))
+	assert.Equal(t, fuse.OK, ff.Flush())
+	assert.Empty(t, ff.data)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 2)
+}
+
+// TestFsync verifies Fsync syncs the znode with the leader, pushing a truncate held in memory first.
+func TestFsync(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Sync", "mock/path").Return("/mock/path", nil)
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("da"), int32(-1)).Return(&zk.Stat{Version: 1}, nil)
+
+	ff := NewFuseFile([]byte("data"), 0, "mock/path", mockZooKeeper)
+	assert.Equal(t, fuse.OK, ff.Fsync(0))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Sync", 1)
+	mockZooKeeper.zk.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+
+	assert.Equal(t, fuse.OK, ff.Truncate(2))
+	assert.Equal(t, fuse.OK, ff.Fsync(0))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 1)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Sync", 2)
+	assert.Equal(t, int32(1), ff.version)
+
+	// the truncate was pushed once.
+	assert.Equal(t, fuse.OK, ff.Fsync(0))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 1)
+}
+
+// TestFlush verifies close pushes a truncate held in memory once, and reports the failure of its Set as EIO.
+func TestFlush(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("da"), int32(-1)).Return((*zk.Stat)(nil), zk.ErrNoAuth).Once()
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("da"), int32(-1)).Return(&zk.Stat{Version: 1}, nil)
+
+	ff := NewFuseFile([]byte("data"), 0, "mock/path", mockZooKeeper)
+	assert.Equal(t, fuse.OK, ff.Flush())
+	mockZooKeeper.zk.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+
+	assert.Equal(t, fuse.OK, ff.Truncate(2))
+	assert.Equal(t, fuse.EACCES, ff.Flush())
+	assert.Equal(t, fuse.OK, ff.Flush())
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 2)
+
+	// the truncate was pushed, a further flush is a no-op.
+	assert.Equal(t, fuse.OK, ff.Flush())
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 2)
+}
+
+// TestFsyncFailure verifies a failed sync is reported as EIO.
+func TestFsyncFailure(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Sync", "mock/path").Return("", zk.ErrConnectionClosed)
+
+	ff := NewFuseFile([]byte("data"), 0, "mock/path", mockZooKeeper)
+	assert.Equal(t, fuse.EIO, ff.Fsync(0))
+}
+
+// TestSyncWrites verifies a write in sync mode issues a Sync once the Set succeeded, and a failed Sync fails the
+// write.
+func TestSyncWrites(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	var calls []string
+	mockZooKeeper.zk.On("Set", "mock/path", []byte("data"), int32(-1)).Return(&zk.Stat{Version: 1}, nil).Run(func(mock.Arguments) {
+		calls = append(calls, "Set")
+	})
+	mockZooKeeper.zk.On("Sync", "mock/path").Return("/mock/path", nil).Once().Run(func(mock.Arguments) {
+		calls = append(calls, "Sync")
+	})
+	mockZooKeeper.zk.On("Sync", "mock/path").Return("", zk.ErrConnectionClosed)
+
+	ff := NewFuseFile(nil, 0, "mock/path", mockZooKeeper)
+	ff.syncWrites = true
+	n, status := ff.Write([]byte("data"), 0)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(4), n)
+	assert.Equal(t, []string{"Set", "Sync"}, calls)
+
+	ff = NewFuseFile(nil, 0, "mock/path", mockZooKeeper)
+	ff.syncWrites = true
+	_, status = ff.Write([]byte("data"), 0)
+	assert.Equal(t, fuse.EIO, status)
+}
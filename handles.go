@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// UnmountWait waits for open file handles to be closed before unmounting.
+	UnmountWait = "wait"
+	// UnmountForce unmounts regardless of open file handles.
+	UnmountForce = "force"
+	// UnmountFail refuses to unmount (EBUSY) while file handles are open.
+	UnmountFail = "fail"
+)
+
+// validUnmountPolicy reports whether `policy` names one of the unmount policies.
+func validUnmountPolicy(policy string) bool {
+	switch policy {
+	case UnmountWait, UnmountForce, UnmountFail:
+		return true
+	}
+	return false
+}
+
+// handleTracker counts the file handles open on the mount. The zero value is ready for use.
+type handleTracker struct {
+	sync.Mutex
+	handles int
+	idle    *sync.Cond
+}
+
+// open registers a newly opened handle, the returned func releases it.
+func (h *handleTracker) open() func() {
+	h.Lock()
+	defer h.Unlock()
+	h.handles++
+
+	var once sync.Once
+	return func() {
+		once.Do(h.close)
+	}
+}
+
+func (h *handleTracker) close() {
+	h.Lock()
+	defer h.Unlock()
+	h.handles--
+	if h.handles == 0 && h.idle != nil {
+		h.idle.Broadcast()
+	}
+}
+
+// count returns the number of handles currently open.
+func (h *handleTracker) count() int {
+	h.Lock()
+	defer h.Unlock()
+	return h.handles
+}
+
+// waitIdle blocks until every handle is released, or the timeout expires. It reports whether all handles were
+// released.
+func (h *handleTracker) waitIdle(timeout time.Duration) bool {
+	h.Lock()
+	defer h.Unlock()
+	if h.idle == nil {
+		h.idle = sync.NewCond(&h.Mutex)
+	}
+
+	expired := false
+	timer := time.AfterFunc(timeout, func() {
+		h.Lock()
+		defer h.Unlock()
+		expired = true
+		h.idle.Broadcast()
+	})
+	defer timer.Stop()
+
+	for h.handles > 0 && !expired {
+		h.idle.Wait()
+	}
+	return h.handles == 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// openHandle opens a file on the filesystem, returning the handle holding the mount busy.
+func openHandle(t *testing.T, fs *FuseFS) *FuseFile {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app").Return([]byte("data"), &zk.Stat{}, nil)
+	fs.zh = mockZooKeeper
+
+	file, _ := fs.Open("app", uint32(0), nil)
+	assert.Equal(t, 1, fs.handles.count())
+	return file.(*FuseFile)
+}
+
+func TestUnmountFail(t *testing.T) {
+	fs := &FuseFS{OnBusyUnmount: UnmountFail}
+	file := openHandle(t, fs)
+	assert.Equal(t, syscall.EBUSY, fs.Unmount())
+
+	file.Release()
+	assert.Equal(t, 0, fs.handles.count())
+	assert.Nil(t, fs.Unmount())
+}
+
+func TestUnmountForce(t *testing.T) {
+	fs := &FuseFS{OnBusyUnmount: UnmountForce}
+	openHandle(t, fs)
+	assert.Nil(t, fs.Unmount())
+}
+
+func TestUnmountWait(t *testing.T) {
+	fs := &FuseFS{OnBusyUnmount: UnmountWait, UnmountTimeout: 5 * time.Second}
+	file := openHandle(t, fs)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		file.Release()
+	}()
+	assert.Nil(t, fs.Unmount())
+	assert.Equal(t, 0, fs.handles.count())
+}
+
+func TestUnmountWaitTimeout(t *testing.T) {
+	fs := &FuseFS{OnBusyUnmount: UnmountWait, UnmountTimeout: 10 * time.Millisecond}
+	openHandle(t, fs)
+	assert.Equal(t, syscall.EBUSY, fs.Unmount())
+}
+
+// TestReleaseOnce verifies a handle released more than once is only counted once, and drops its buffered data.
+func TestReleaseOnce(t *testing.T) {
+	fs := &FuseFS{}
+	file := openHandle(t, fs)
+
+	file.Release()
+	file.Release()
+	assert.Equal(t, 0, fs.handles.count())
+	assert.Nil(t, file.data)
+}
+
+// TestUnmountLazy verifies a mount the kernel reports busy is detached lazily, unless the policy is to fail.
+func TestUnmountLazy(t *testing.T) {
+	var detached []string
+	orig := lazyUnmount
+	lazyUnmount = func(mountpoint string) error {
+		detached = append(detached, mountpoint)
+		return nil
+	}
+	defer func() { lazyUnmount = orig }()
+
+	busy := errors.New("fusermount: failed to unmount /mnt/zk: Device or resource busy\n (code exit status 1)")
+	fs := &FuseFS{FuseRoot: "/mnt/zk", OnBusyUnmount: UnmountForce}
+	assert.Nil(t, fs.lazyFallback(nil))
+	assert.Nil(t, fs.lazyFallback(busy))
+	assert.Equal(t, []string{"/mnt/zk"}, detached)
+
+	// other failures are handed back as is.
+	other := errors.New("fusermount: entry for /mnt/zk not found in /etc/mtab")
+	assert.Equal(t, other, fs.lazyFallback(other))
+
+	fs.OnBusyUnmount = UnmountFail
+	assert.Equal(t, busy, fs.lazyFallback(busy))
+	assert.Len(t, detached, 1)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// hotPathSlack is the number of paths counted for each of the hot paths reported, the slack making the report
+// reliable when many paths are used about as often.
+const hotPathSlack = 10
+
+// hotPath is an entry of the `hotpaths` control file.
+type hotPath struct {
+	Path  string `json:"path"`
+	Count int64  `json:"count"`
+}
+
+// hotPathSource reports the paths which saw the most ZK operations.
+type hotPathSource interface {
+	HotPaths() []hotPath
+}
+
+// HotPathZooHandler is a Zoohandler counting the calls made for each path, so operators can tell which znodes are
+// read or written the most. Only the counters of the `n` busiest paths (times hotPathSlack) are kept: once full, the
+// least used path is replaced by the new one, which inherits its count (the Space-Saving algorithm). A count is thus
+// overestimated by at most the count it inherited, while the busiest paths are never evicted.
+type HotPathZooHandler struct {
+	wrappedZooHandler
+	mu     sync.Mutex
+	n      int
+	counts map[string]int64
+}
+
+// NewHotPathZooHandler wraps `zh`, counting the calls made for each path to report the `n` busiest ones.
+func NewHotPathZooHandler(zh Zoohandler, n int) *HotPathZooHandler {
+	return &HotPathZooHandler{wrappedZooHandler: wrappedZooHandler{zh}, n: n, counts: make(map[string]int64)}
+}
+
+// hit counts an operation on `path`.
+func (h *HotPathZooHandler) hit(path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.counts[path]; ok || len(h.counts) < h.n*hotPathSlack {
+		h.counts[path]++
+		return
+	}
+
+	var least string
+	min := int64(-1)
+	for p, count := range h.counts {
+		if min < 0 || count < min {
+			least, min = p, count
+		}
+	}
+	delete(h.counts, least)
+	h.counts[path] = min + 1
+}
+
+// HotPaths returns the `n` busiest paths, busiest first.
+func (h *HotPathZooHandler) HotPaths() []hotPath {
+	h.mu.Lock()
+	paths := make([]hotPath, 0, len(h.counts))
+	for path, count := range h.counts {
+		paths = append(paths, hotPath{Path: "/" + path, Count: count})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].Count != paths[j].Count {
+			return paths[i].Count > paths[j].Count
+		}
+		return paths[i].Path < paths[j].Path
+	})
+	if len(paths) > h.n {
+		paths = paths[:h.n]
+	}
+	return paths
+}
+
+// Children implements Zoohandler.Children
+func (h *HotPathZooHandler) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
+	h.hit(path)
+	return h.Zoohandler.Children(ctx, path)
+}
+
+// Create implements Zoohandler.Create
+func (h *HotPathZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	h.hit(path)
+	return h.Zoohandler.Create(ctx, path, data, flags, acl)
+}
+
+// Delete implements Zoohandler.Delete
+func (h *HotPathZooHandler) Delete(ctx context.Context, path string, version int32) error {
+	h.hit(path)
+	return h.Zoohandler.Delete(ctx, path, version)
+}
+
+// Exists implements Zoohandler.Exists
+func (h *HotPathZooHandler) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	h.hit(path)
+	return h.Zoohandler.Exists(ctx, path)
+}
+
+// Get implements Zoohandler.Get
+func (h *HotPathZooHandler) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
+	h.hit(path)
+	return h.Zoohandler.Get(ctx, path)
+}
+
+// Set implements Zoohandler.Set
+func (h *HotPathZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	h.hit(path)
+	return h.Zoohandler.Set(ctx, path, data, version)
+}
+
+// GetACL implements Zoohandler.GetACL
+func (h *HotPathZooHandler) GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error) {
+	h.hit(path)
+	return h.Zoohandler.GetACL(ctx, path)
+}
+
+// SetACL implements Zoohandler.SetACL
+func (h *HotPathZooHandler) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	h.hit(path)
+	return h.Zoohandler.SetACL(ctx, path, acl, version)
+}
+
+// GetW implements Zoohandler.GetW
+func (h *HotPathZooHandler) GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	h.hit(path)
+	return h.Zoohandler.GetW(ctx, path)
+}
+
+// ChildrenW implements Zoohandler.ChildrenW
+func (h *HotPathZooHandler) ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	h.hit(path)
+	return h.Zoohandler.ChildrenW(ctx, path)
+}
+
+// Sync implements Zoohandler.Sync
+func (h *HotPathZooHandler) Sync(ctx context.Context, path string) (string, error) {
+	h.hit(path)
+	return h.Zoohandler.Sync(ctx, path)
+}
+
+// renderHotPaths returns the busiest paths of the mount as JSON.
+func (f *FuseFS) renderHotPaths(ctx context.Context) ([]byte, error) {
+	data, err := json.MarshalIndent(f.HotPaths.HotPaths(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestHotPaths verifies the operations on each path are counted, and the busiest paths reported busiest first.
+func TestHotPaths(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", mock.Anything).Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", mock.Anything).Return([]byte("data"), &zk.Stat{}, nil)
+
+	zh := NewHotPathZooHandler(mockZooKeeper, 2)
+	fs := &FuseFS{zh: zh, HotPaths: zh}
+	for i := 0; i < 3; i++ {
+		fs.GetAttr("app/config", nil)
+	}
+	fs.GetAttr("app/hosts", nil)
+	fs.Open("app/hosts", uint32(0), nil)
+	fs.GetAttr("app/other", nil)
+
+	assert.Equal(t, []hotPath{{Path: "/app/config", Count: 3}, {Path: "/app/hosts", Count: 2}}, zh.HotPaths())
+
+	file, status := fs.Open(ControlDir+"/hotpaths", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, 1024)
+	res, _ := file.Read(buf, 0)
+	data, _ := res.Bytes(buf)
+	assert.Contains(t, string(data), `"path": "/app/config"`)
+	assert.NotContains(t, string(data), "/app/other")
+}
+
+// TestHotPathsBounded verifies the number of paths counted is bounded, while a busy path is kept as rarely used paths
+// come and go.
+func TestHotPathsBounded(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", mock.Anything).Return(true, &zk.Stat{}, nil)
+
+	zh := NewHotPathZooHandler(mockZooKeeper, 1)
+	for i := 0; i < 100; i++ {
+		zh.Exists(ctx, "app/config")
+		zh.Exists(ctx, "app/config")
+		zh.Exists(ctx, fmt.Sprintf("app/rare-%d", i))
+	}
+	assert.Len(t, zh.counts, hotPathSlack)
+	assert.Equal(t, []hotPath{{Path: "/app/config", Count: 200}}, zh.HotPaths())
+}
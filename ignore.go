@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ParseIgnorePattern validates a glob pattern given to the `-ignore` flag, returning it in the form of the fuse paths
+// it is matched against.
+func ParseIgnorePattern(pattern string) (string, error) {
+	cleaned := cleanPath(pattern)
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid ignore pattern %q, the root cannot be ignored", pattern)
+	}
+	if _, err := filepath.Match(cleaned, ""); err != nil {
+		return "", fmt.Errorf("invalid ignore pattern %q: %v", pattern, err)
+	}
+	return cleaned, nil
+}
+
+// ignored reports whether `path`, or one of its ancestors, matches an Ignore pattern. Such paths are masked from the
+// mount as if the znodes did not exist.
+func (f *FuseFS) ignored(path string) bool {
+	patterns := f.ignorePatterns()
+	if len(patterns) == 0 {
+		return false
+	}
+	parts := strings.Split(path, "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, prefix); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ignorePatterns returns the Ignore patterns currently in effect, which reloadConfig swaps.
+func (f *FuseFS) ignorePatterns() []string {
+	f.configMu.RLock()
+	defer f.configMu.RUnlock()
+	return f.Ignore
+}
+
+// hideIgnored removes the ignored paths from the `children` of the znode at `path`.
+func (f *FuseFS) hideIgnored(path string, children []string) []string {
+	if len(f.ignorePatterns()) == 0 {
+		return children
+	}
+	visible := children[:0:0]
+	for _, child := range children {
+		if !f.ignored(filepath.Join(path, child)) {
+			visible = append(visible, child)
+		}
+	}
+	return visible
+}
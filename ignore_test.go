@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseIgnorePattern(t *testing.T) {
+	pattern, err := ParseIgnorePattern("/locks/")
+	assert.Nil(t, err)
+	assert.Equal(t, "locks", pattern)
+
+	_, err = ParseIgnorePattern("/")
+	assert.NotNil(t, err)
+	_, err = ParseIgnorePattern("[")
+	assert.NotNil(t, err)
+}
+
+// TestIgnore verifies ignored paths, and their subtrees, are hidden from listings and stat as ENOENT.
+func TestIgnore(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "").Return([]string{"zookeeper", "app", "locks"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Children", "app").Return([]string{"config", "tmp-1"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{NumChildren: 2}, nil)
+	mockZooKeeper.zk.On("Exists", "/app").Return(true, &zk.Stat{NumChildren: 2}, nil)
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, Ignore: []string{"zookeeper", "locks", "app/tmp-*"}}
+	entries, status := fs.OpenDir("", nil)
+	assert.Equal(t, fuse.OK, status)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	assert.Equal(t, []string{ZNodeMarker, "app", ControlDir}, names)
+
+	entries, status = fs.OpenDir("app", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, []fuse.DirEntry{{Name: ZNodeMarker, Mode: fuse.S_IFREG}, {Name: "config", Mode: fuse.S_IFREG}}, entries)
+
+	for _, path := range []string{"zookeeper", "zookeeper/quota", "locks/lock-1", "app/tmp-1"} {
+		_, status = fs.GetAttr(path, nil)
+		assert.Equal(t, fuse.ENOENT, status, path)
+	}
+	_, status = fs.OpenDir("zookeeper", nil)
+	assert.Equal(t, fuse.ENOENT, status)
+	mockZooKeeper.zk.AssertNotCalled(t, "Exists", "zookeeper")
+	mockZooKeeper.zk.AssertNotCalled(t, "Exists", "/zookeeper")
+	mockZooKeeper.zk.AssertNotCalled(t, "Children", "zookeeper")
+
+	_, status = fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// XAttrLastLatency is the extended attribute reporting the duration of the most recent ZK operation on a znode.
+const XAttrLastLatency = "user.zk.lastlatency"
+
+// MaxLatencyPaths is the number of paths whose latency is kept, bounding the memory used on mounts touching many
+// znodes.
+const MaxLatencyPaths = 4096
+
+// latency is the duration of the most recent operation on a path, `seq` ordering the operations of all paths.
+type latency struct {
+	d   time.Duration
+	seq uint64
+}
+
+// latencySource reports the duration of the most recent ZK operation on a path.
+type latencySource interface {
+	LastLatency(path string) (time.Duration, bool)
+}
+
+// LatencyZooHandler is a Zoohandler timing every call, keeping the duration of the most recent operation on each
+// path. It helps track down slow znodes interactively, through the XAttrLastLatency extended attribute. Only the
+// latencies of the MaxLatencyPaths most recently used paths are kept: once full, the path operated on the longest
+// ago is forgotten.
+type LatencyZooHandler struct {
+	wrappedZooHandler
+	mu   sync.Mutex
+	seq  uint64
+	last map[string]latency
+}
+
+// NewLatencyZooHandler wraps `zh`, timing each of its calls.
+func NewLatencyZooHandler(zh Zoohandler) *LatencyZooHandler {
+	return &LatencyZooHandler{wrappedZooHandler: wrappedZooHandler{zh}, last: make(map[string]latency)}
+}
+
+// LastLatency returns the duration of the most recent operation on `path`, if any.
+func (l *LatencyZooHandler) LastLatency(path string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.last[path]
+	return entry.d, ok
+}
+
+// record keeps the time elapsed since `start` as the latency of `path`.
+func (l *LatencyZooHandler) record(path string, start time.Time) {
+	d := time.Since(start)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	if _, ok := l.last[path]; !ok && len(l.last) >= MaxLatencyPaths {
+		var oldest string
+		min := uint64(0)
+		for p, entry := range l.last {
+			if min == 0 || entry.seq < min {
+				oldest, min = p, entry.seq
+			}
+		}
+		delete(l.last, oldest)
+	}
+	l.last[path] = latency{d: d, seq: l.seq}
+}
+
+// Children implements Zoohandler.Children
+func (l *LatencyZooHandler) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.Children(ctx, path)
+}
+
+// Create implements Zoohandler.Create
+func (l *LatencyZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.Create(ctx, path, data, flags, acl)
+}
+
+// Delete implements Zoohandler.Delete
+func (l *LatencyZooHandler) Delete(ctx context.Context, path string, version int32) error {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.Delete(ctx, path, version)
+}
+
+// Exists implements Zoohandler.Exists
+func (l *LatencyZooHandler) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.Exists(ctx, path)
+}
+
+// Get implements Zoohandler.Get
+func (l *LatencyZooHandler) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.Get(ctx, path)
+}
+
+// Set implements Zoohandler.Set
+func (l *LatencyZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.Set(ctx, path, data, version)
+}
+
+// GetACL implements Zoohandler.GetACL
+func (l *LatencyZooHandler) GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.GetACL(ctx, path)
+}
+
+// SetACL implements Zoohandler.SetACL
+func (l *LatencyZooHandler) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.SetACL(ctx, path, acl, version)
+}
+
+// GetW implements Zoohandler.GetW
+func (l *LatencyZooHandler) GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.GetW(ctx, path)
+}
+
+// ChildrenW implements Zoohandler.ChildrenW
+func (l *LatencyZooHandler) ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.ChildrenW(ctx, path)
+}
+
+// Sync implements Zoohandler.Sync
+func (l *LatencyZooHandler) Sync(ctx context.Context, path string) (string, error) {
+	defer l.record(path, time.Now())
+	return l.Zoohandler.Sync(ctx, path)
+}
+
+// getLatencyAttr renders the duration of the most recent operation on `path`.
+func (f *FuseFS) getLatencyAttr(ctx context.Context, path string) ([]byte, error) {
+	d, ok := f.Latencies.LastLatency(path)
+	if !ok {
+		return nil, errNoAttr
+	}
+	return []byte(d.String()), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestLastLatencyXAttr verifies the latency xattr reports the duration of the most recent operation on the path.
+func TestLastLatencyXAttr(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{}, nil).After(10 * time.Millisecond)
+
+	zh := NewLatencyZooHandler(mockZooKeeper)
+	fs := &FuseFS{zh: zh, Latencies: zh}
+
+	// nothing was timed for the path yet.
+	_, status := fs.GetXAttr("app/config", XAttrLastLatency, nil)
+	assert.Equal(t, fuse.ENOATTR, status)
+
+	_, status = fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	data, status := fs.GetXAttr("app/config", XAttrLastLatency, nil)
+	assert.Equal(t, fuse.OK, status)
+
+	latency, err := time.ParseDuration(string(data))
+	assert.Nil(t, err)
+	assert.True(t, latency >= 10*time.Millisecond, latency)
+	assert.True(t, latency < 5*time.Second, latency)
+
+	attrs, _ := fs.ListXAttr("app/config", nil)
+	assert.Contains(t, attrs, XAttrLastLatency)
+}
+
+// TestLastLatencyBounded verifies only the latencies of the MaxLatencyPaths most recently used paths are kept.
+func TestLastLatencyBounded(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", mock.Anything).Return(true, &zk.Stat{}, nil)
+
+	ctx := context.Background()
+	zh := NewLatencyZooHandler(mockZooKeeper)
+	for i := 0; i < MaxLatencyPaths; i++ {
+		zh.Exists(ctx, fmt.Sprintf("app/%d", i))
+	}
+	// touching the first path again keeps it over the second one.
+	zh.Exists(ctx, "app/0")
+	zh.Exists(ctx, "app/new")
+
+	assert.Len(t, zh.last, MaxLatencyPaths)
+	_, ok := zh.LastLatency("app/0")
+	assert.True(t, ok)
+	_, ok = zh.LastLatency("app/1")
+	assert.False(t, ok)
+	_, ok = zh.LastLatency("app/new")
+	assert.True(t, ok)
+}
+
+// TestLastLatencyXAttrDisabled verifies the latency xattr is only presented when operations are timed.
+func TestLastLatencyXAttrDisabled(t *testing.T) {
+	fs := &FuseFS{zh: &MockZooHandle{}}
+	attrs, _ := fs.ListXAttr("app/config", nil)
+	assert.NotContains(t, attrs, XAttrLastLatency)
+	_, status := fs.GetXAttr("app/config", XAttrLastLatency, nil)
+	assert.Equal(t, fuse.ENOATTR, status)
+}
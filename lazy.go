@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNotReady is returned by a LazyZooHandler whose connection has not been established yet.
+var ErrNotReady = errors.New("zookeeper connection is not established yet")
+
+// readiness is implemented by Zoohandlers which may be mounted before they are able to serve requests.
+type readiness interface {
+	Ready() bool
+}
+
+// LazyZooHandler is a Zoohandler whose connection is established in the background (see the `lazymount` flag). Until
+// the connection is handed over by SetHandler every call fails with ErrNotReady.
+type LazyZooHandler struct {
+	sync.RWMutex
+	zh Zoohandler
+}
+
+// SetHandler hands over the established connection, from here on all calls are passed through to `zh`.
+func (l *LazyZooHandler) SetHandler(zh Zoohandler) {
+	l.Lock()
+	defer l.Unlock()
+	l.zh = zh
+}
+
+// connect hands over the connection returned by `dial` once an attempt succeeds. Failed attempts are logged and
+// retried with an exponential backoff capped at `maxBackoff` (MaxReconnectBackoff when zero): the mount is already
+// served, exiting would leave a stale mountpoint behind, so calls keep failing with ErrNotReady meanwhile.
+func (l *LazyZooHandler) connect(dial func() (Zoohandler, error), maxBackoff time.Duration) {
+	if maxBackoff <= 0 {
+		maxBackoff = MaxReconnectBackoff
+	}
+	backoff := reconnectBackoff
+	for {
+		zh, err := dial()
+		if err == nil {
+			l.SetHandler(zh)
+			log.Info("Zookeeper session established, lazy mount is ready")
+			return
+		}
+
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		log.WithFields(log.Fields{
+			"err":   err,
+			"retry": backoff,
+		}).Error("Failed to establish Zookeeper session, lazy mount is not ready")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Ready reports whether the connection has been established.
+func (l *LazyZooHandler) Ready() bool {
+	l.RLock()
+	defer l.RUnlock()
+	return l.zh != nil
+}
+
+func (l *LazyZooHandler) handler() (Zoohandler, error) {
+	l.RLock()
+	defer l.RUnlock()
+	if l.zh == nil {
+		return nil, ErrNotReady
+	}
+	return l.zh, nil
+}
+
+// Close releases the connection, if one was established.
+func (l *LazyZooHandler) Close() {
+	if zh, err := l.handler(); err == nil {
+		zh.Close()
+	}
+}
+
+// Children implements Zoohandler.Children
+func (l *LazyZooHandler) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return nil, nil, err
+	}
+	return zh.Children(ctx, path)
+}
+
+// Create implements Zoohandler.Create
+func (l *LazyZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return "", err
+	}
+	return zh.Create(ctx, path, data, flags, acl)
+}
+
+// Delete implements Zoohandler.Delete
+func (l *LazyZooHandler) Delete(ctx context.Context, path string, version int32) error {
+	zh, err := l.handler()
+	if err != nil {
+		return err
+	}
+	return zh.Delete(ctx, path, version)
+}
+
+// Exists implements Zoohandler.Exists
+func (l *LazyZooHandler) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return false, nil, err
+	}
+	return zh.Exists(ctx, path)
+}
+
+// Get implements Zoohandler.Get
+func (l *LazyZooHandler) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return nil, nil, err
+	}
+	return zh.Get(ctx, path)
+}
+
+// Set implements Zoohandler.Set
+func (l *LazyZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return nil, err
+	}
+	return zh.Set(ctx, path, data, version)
+}
+
+// GetACL implements Zoohandler.GetACL
+func (l *LazyZooHandler) GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return nil, nil, err
+	}
+	return zh.GetACL(ctx, path)
+}
+
+// SetACL implements Zoohandler.SetACL
+func (l *LazyZooHandler) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return nil, err
+	}
+	return zh.SetACL(ctx, path, acl, version)
+}
+
+// GetW implements Zoohandler.GetW
+func (l *LazyZooHandler) GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return zh.GetW(ctx, path)
+}
+
+// ChildrenW implements Zoohandler.ChildrenW
+func (l *LazyZooHandler) ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return zh.ChildrenW(ctx, path)
+}
+
+// Sync implements Zoohandler.Sync
+func (l *LazyZooHandler) Sync(ctx context.Context, path string) (string, error) {
+	zh, err := l.handler()
+	if err != nil {
+		return "", err
+	}
+	return zh.Sync(ctx, path)
+}
+
+// ready returns EAGAIN while the Zoohandler of the filesystem is still establishing its connection.
+func (f *FuseFS) ready() fuse.Status {
+	if r, ok := f.zh.(readiness); ok && !r.Ready() {
+		return fuse.EAGAIN
+	}
+	return fuse.OK
+}
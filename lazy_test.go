@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestLazyMount verifies operations return EAGAIN until the connection is established, and succeed afterwards.
+func TestLazyMount(t *testing.T) {
+	ctx := context.Background()
+	lazy := &LazyZooHandler{}
+	fs := &FuseFS{zh: lazy, IsReadWrite: true}
+
+	// the root of the mount is always available.
+	_, status := fs.GetAttr("", nil)
+	assert.Equal(t, fuse.OK, status)
+
+	_, status = fs.GetAttr("app", nil)
+	assert.Equal(t, fuse.EAGAIN, status)
+	_, status = fs.OpenDir("app", nil)
+	assert.Equal(t, fuse.EAGAIN, status)
+	_, status = fs.Open("app", uint32(0), nil)
+	assert.Equal(t, fuse.EAGAIN, status)
+	_, status = fs.Create("app/new", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.EAGAIN, status)
+	assert.Equal(t, fuse.EAGAIN, fs.Unlink("app", nil))
+	_, _, err := lazy.Get(ctx, "app")
+	assert.Equal(t, ErrNotReady, err)
+
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app").Return([]byte("data"), &zk.Stat{}, nil)
+	lazy.SetHandler(mockZooKeeper)
+
+	_, status = fs.GetAttr("app", nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = fs.Open("app", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+}
+
+// TestLazyConnectRetry verifies failed connection attempts of a lazy mount are retried, rather than ending the
+// process, with calls failing with ErrNotReady until an attempt succeeds.
+func TestLazyConnectRetry(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app").Return([]byte("data"), &zk.Stat{}, nil)
+
+	lazy := &LazyZooHandler{}
+	attempts := 0
+	lazy.connect(func() (Zoohandler, error) {
+		attempts++
+		_, _, err := lazy.Get(ctx, "app")
+		assert.Equal(t, ErrNotReady, err)
+		if attempts < 3 {
+			return nil, zk.ErrNoServer
+		}
+		return mockZooKeeper, nil
+	}, time.Millisecond)
+
+	assert.Equal(t, 3, attempts)
+	assert.True(t, lazy.Ready())
+	data, _, err := lazy.Get(ctx, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// Link is refused with EPERM, Zookeeper has no notion of a hard link. With LinkCopy the znode `newName` is created
+// holding a copy of the current data of `orig` instead. The copy is a snapshot: later writes to either znode are not
+// seen through the other.
+func (f *FuseFS) Link(orig string, newName string, context *fuse.Context) fuse.Status {
+	ctx := traceRequest(context, "Link", newName)
+	if !f.LinkCopy {
+		return fuse.EPERM
+	}
+	if !f.IsReadWrite || f.isVirtual(orig) || f.isVirtual(newName) {
+		return fuse.EROFS
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	orig, newName = f.unbucket(orig), f.unbucket(newName)
+	if status := f.checkName(newName); !status.Ok() {
+		return status
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+	if status := f.checkACL(ctx, orig, zk.PermRead); !status.Ok() {
+		return status
+	}
+	if status := f.checkACL(ctx, parentPath(newName), zk.PermCreate); !status.Ok() {
+		return status
+	}
+
+	data, _, err := f.zh.Get(ctx, orig)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": orig,
+			"err":  err,
+		}).Error("unable to Get the znode to link")
+		f.errors.record("Link", orig, err)
+		return zkErrToStatus(err)
+	}
+	if status := f.checkBudget(ctx, newName, int64(len(data))); !status.Ok() {
+		return status
+	}
+
+	if !f.reserveCreate() {
+		return fuse.Status(syscall.ENOSPC)
+	}
+	if _, err := f.zh.Create(ctx, newName, data, int32(0), zk.WorldACL(zk.PermAll)); err != nil {
+		f.releaseCreate()
+		log.WithFields(log.Fields{
+			"path": newName,
+			"err":  err,
+		}).Error("failed to create the copy of a linked znode.")
+		f.errors.record("Link", newName, err)
+		return zkErrToStatus(err)
+	}
+	return fuse.OK
+}
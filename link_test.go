@@ -0,0 +1,42 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestLinkRefused verifies hard links are refused with EPERM unless LinkCopy is set, without contacting Zookeeper.
+func TestLinkRefused(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.EPERM, fs.Link("app/config", "app/copy", nil))
+	assert.Empty(t, mockZooKeeper.zk.Calls)
+
+	fs = &FuseFS{zh: mockZooKeeper, LinkCopy: true}
+	assert.Equal(t, fuse.EROFS, fs.Link("app/config", "app/copy", nil))
+	assert.Empty(t, mockZooKeeper.zk.Calls)
+}
+
+// TestLinkCopy verifies that with LinkCopy a link creates a znode holding a copy of the data of the original.
+func TestLinkCopy(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{Version: 3}, nil)
+	mockZooKeeper.zk.On("Get", "app/missing").Return([]byte(nil), (*zk.Stat)(nil), zk.ErrNoNode)
+	mockZooKeeper.zk.On("Create", "app/copy", []byte("data"), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/copy", nil)
+	mockZooKeeper.zk.On("Create", "app/taken", []byte("data"), int32(0), zk.WorldACL(zk.PermAll)).Return("", zk.ErrNodeExists)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, LinkCopy: true}
+	assert.Equal(t, fuse.OK, fs.Link("app/config", "app/copy", nil))
+	assert.Equal(t, fuse.Status(syscall.EEXIST), fs.Link("app/config", "app/taken", nil))
+	assert.Equal(t, fuse.ENOENT, fs.Link("app/missing", "app/other", nil))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Create", 2)
+}
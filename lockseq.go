@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// XAttrIsLowestSeq is the extended attribute reporting whether a sequential ephemeral znode holds the lowest sequence
+// number among its sequential siblings, that is whether it holds the lock of the ZK lock recipe. It is only present
+// on sequential ephemeral znodes.
+const XAttrIsLowestSeq = "user.zk.islowestseq"
+
+// sequence returns the counter ZK appended to the name of a sequential znode.
+func sequence(name string) string {
+	return name[len(name)-sequenceSuffixLen:]
+}
+
+// getIsLowestSeqAttr reports `true` when the znode at `path` carries the lowest sequence among the sequential
+// children of its parent, `false` otherwise. Siblings are compared by sequence alone, whatever their name prefix, as
+// lock recipes prefix the counter with the session or a guid.
+func (f *FuseFS) getIsLowestSeqAttr(ctx context.Context, path string) ([]byte, error) {
+	name := filepath.Base(path)
+	if path == "" || !isSequential(name) {
+		return nil, errNoAttr
+	}
+	found, stat, err := f.zh.Exists(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, zk.ErrNoNode
+	}
+	if stat.EphemeralOwner == 0 {
+		return nil, errNoAttr
+	}
+
+	siblings, _, err := f.zh.Children(ctx, parentPath(path))
+	if err != nil {
+		return nil, err
+	}
+	for _, sibling := range siblings {
+		if isSequential(sibling) && sequence(sibling) < sequence(name) {
+			return []byte("false"), nil
+		}
+	}
+	return []byte("true"), nil
+}
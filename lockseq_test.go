@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestIsLowestSeqXAttr verifies the sequential ephemeral sibling with the lowest sequence reports holding the lock,
+// whatever its name prefix, and that the attribute is absent on other znodes.
+func TestIsLowestSeqXAttr(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	siblings := []string{"_c_b2-lock-0000000007", "_c_a1-lock-0000000003", "_c_c3-lock-0000000012", "config"}
+	mockZooKeeper.zk.On("Children", "locks").Return(siblings, &zk.Stat{}, nil)
+	for _, sibling := range siblings[:3] {
+		mockZooKeeper.zk.On("Exists", "locks/"+sibling).Return(true, &zk.Stat{EphemeralOwner: 0x1000a1b2c3d0000}, nil)
+	}
+	mockZooKeeper.zk.On("Exists", "jobs/job-0000000001").Return(true, &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	for sibling, holder := range map[string]string{
+		"_c_a1-lock-0000000003": "true",
+		"_c_b2-lock-0000000007": "false",
+		"_c_c3-lock-0000000012": "false",
+	} {
+		data, status := fs.GetXAttr("locks/"+sibling, XAttrIsLowestSeq, nil)
+		assert.Equal(t, fuse.OK, status)
+		assert.Equal(t, holder, string(data), sibling)
+	}
+
+	// persistent sequential and non-sequential znodes hold no lock.
+	_, status := fs.GetXAttr("jobs/job-0000000001", XAttrIsLowestSeq, nil)
+	assert.Equal(t, fuse.ENOATTR, status)
+	_, status = fs.GetXAttr("locks/config", XAttrIsLowestSeq, nil)
+	assert.Equal(t, fuse.ENOATTR, status)
+}
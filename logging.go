@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// syslogFacilities maps the facility names accepted by the `syslogfacility` flag onto syslog priorities.
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// syslogDialer creates the hook delivering log entries to syslog.
+type syslogDialer func(priority syslog.Priority, tag string) (log.Hook, error)
+
+// dialSyslog connects to the local syslog daemon.
+func dialSyslog(priority syslog.Priority, tag string) (log.Hook, error) {
+	return lsyslog.NewSyslogHook("", "", priority, tag)
+}
+
+// enableSyslog routes the output of the logger to syslog, in place of STDOUT or the log file.
+func enableSyslog(logger *log.Logger, facility, tag string, dial syslogDialer) error {
+	priority, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return fmt.Errorf("unknown syslog facility %q", facility)
+	}
+
+	hook, err := dial(priority|syslog.LOG_INFO, tag)
+	if err != nil {
+		return fmt.Errorf("unable to connect to syslog: %v", err)
+	}
+	logger.AddHook(hook)
+	logger.SetOutput(ioutil.Discard)
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"log/syslog"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubHook struct{}
+
+func (s *stubHook) Levels() []log.Level   { return log.AllLevels }
+func (s *stubHook) Fire(*log.Entry) error { return nil }
+
+// TestEnableSyslog verifies the syslog hook is installed, with the configured facility and tag, in place of STDOUT.
+func TestEnableSyslog(t *testing.T) {
+	logger := log.New()
+	hook := &stubHook{}
+
+	var priority syslog.Priority
+	var tag string
+	err := enableSyslog(logger, "local3", "zk-prod", func(p syslog.Priority, t string) (log.Hook, error) {
+		priority, tag = p, t
+		return hook, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, syslog.LOG_LOCAL3|syslog.LOG_INFO, priority)
+	assert.Equal(t, "zk-prod", tag)
+	assert.Contains(t, logger.Hooks[log.InfoLevel], hook)
+	assert.Equal(t, ioutil.Discard, logger.Out)
+
+	err = enableSyslog(log.New(), "nonsense", "zoofuse", func(syslog.Priority, string) (log.Hook, error) {
+		return hook, nil
+	})
+	assert.NotNil(t, err)
+}
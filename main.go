@@ -3,9 +3,13 @@ package main
 import (
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/hanwen/go-fuse/fuse/pathfs"
 	log "github.com/sirupsen/logrus"
@@ -22,6 +26,47 @@ func init() {
 
 }
 
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// connect creates the ZooHandler described by the config, exiting on failure.
+func connect(cfg *Config, acls *aclCache) *ZooHandle {
+	zooHandler, err := newZooHandle(cfg, acls)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Fatal("Failed to create ZooHandler")
+	}
+	return zooHandler
+}
+
+// newZooHandle connects to the ensemble of `cfg`, returning rather than exiting on failure. The ACLs are cached in
+// `acls`, when set.
+func newZooHandle(cfg *Config, acls *aclCache) (*ZooHandle, error) {
+	servers, err := ParseZKConn(cfg.ZKConn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zkconn: %v", err)
+	}
+	connections.maxBackoff = cfg.MaxBackoff
+	zooHandler, err := NewZooHandler(servers, cfg.ZKRoot, cfg.FuseRoot, cfg.Auth, cfg.Timeout, cfg.CreateRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	zooHandler.MaxData = cfg.MaxZnode
+	zooHandler.acls = acls
+	return zooHandler, nil
+}
+
 func banner(rootfs, zk, zkchroot, logFile string, rw bool) {
 	b := `
 	·▄▄▄▄•            ·▄▄▄▄• ▄▌.▄▄ · ▄▄▄ .
@@ -45,53 +90,434 @@ booted...
 
 func main() {
 
+	// subcommands are dispatched ahead of the mount flags.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate-dump":
+			os.Exit(validateDump(os.Stdin, os.Stdout))
+		case "bench":
+			os.Exit(runBench(os.Args[2:], os.Stdout))
+		case "cat":
+			os.Exit(runCat(os.Args[2:], os.Stdout))
+		case "mount-dump":
+			os.Exit(runMountDump(os.Args[2:], os.Stdout))
+		case "manifest":
+			os.Exit(runManifest(os.Args[2:], os.Stdout))
+		}
+	}
+
 	// the stretchr/testify/mock package introduces testing flags into the default
 	// flagset. Creation of this flagset is to workaround this, so the unwanted flags are
 	// not displayed..
 	cmd := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	var Usage = func() {
 		fmt.Fprintf(cmd.Output(), "Usage: %s [OPTION]... [MOUNTPOINT] \n", os.Args[0])
+		fmt.Fprintf(cmd.Output(), "       %s validate-dump < DUMP\n", os.Args[0])
+		fmt.Fprintf(cmd.Output(), "       %s bench [-zkconn HOST] [-zkroot PATH] [-auth USER:PASSWORD] [-ops N] [-path PATH]\n", os.Args[0])
+		fmt.Fprintf(cmd.Output(), "       %s cat [-zkconn HOST] [-zkroot PATH] [-auth USER:PASSWORD] [-R] PATH\n", os.Args[0])
+		fmt.Fprintf(cmd.Output(), "       %s mount-dump DUMP MOUNTPOINT\n", os.Args[0])
+		fmt.Fprintf(cmd.Output(), "       %s manifest [-zkconn HOST] [-zkroot PATH] [-auth USER:PASSWORD] PATH\n", os.Args[0])
 		cmd.PrintDefaults()
 	}
 	cmd.Usage = Usage
 
-	var zkChroot = cmd.String("zkroot", "/", "Alias the root Zookeeper tree to an alternate path")
-	var zkConn = cmd.String("zkconn", "127.0.0.1:2181", "Zookeeper connection string")
-	var isReadWrite = cmd.Bool("rw", false, "Enable a read/write ZooFuse filesystem (default is READONLY)")
-	var logFile = cmd.String("logfile", "", "Enable logging to a target file, otherwise STDOUT")
-	var debug = cmd.Bool("debug", false, "Enable verbose debug logging (default disabled)")
+	var cfg Config
+	showVersion := cmd.Bool("version", false, "Print the version, commit and build date of zoofuse and exit")
+	cmd.StringVar(&cfg.ConfigFile, "config", "", "Load settings from a JSON config file (as rendered by .zoofuse/config), flags take precedence. Reloaded on SIGHUP")
+	cmd.StringVar(&cfg.ZKRoot, "zkroot", "/", "Alias the root Zookeeper tree to an alternate path")
+	cmd.StringVar(&cfg.ZKConn, "zkconn", "127.0.0.1:2181", "Zookeeper connection string, a comma separated list of host:port servers")
+	cmd.Var((*stringList)(&cfg.Auth), "auth", "Authenticate the session with digest credentials, user:password (repeatable)")
+	cmd.BoolVar(&cfg.ReadWrite, "rw", false, "Enable a read/write ZooFuse filesystem (default is READONLY)")
+	cmd.StringVar(&cfg.LogFile, "logfile", "", "Enable logging to a target file, otherwise STDOUT")
+	cmd.BoolVar(&cfg.Debug, "debug", false, "Enable verbose debug logging (default disabled)")
+	cmd.BoolVar(&cfg.ModeBits, "modebits", false, "Flag ephemeral (sticky bit) and sequential (setgid bit) znodes in file modes")
+	cmd.IntVar(&cfg.RetryBadVersion, "retrybadversion", MaxWriteRetries, "Retry a write N times against the latest znode version when it was modified concurrently, then fail with EIO")
+	cmd.Var((*stringList)(&cfg.Merge), "merge", "Expose a read-only JSON deep-merge of znodes as a virtual file, out=base,override (repeatable)")
+	cmd.BoolVar(&cfg.ACLCheck, "aclcheck", false, "Refuse operations the znode ACL does not grant before contacting Zookeeper")
+	cmd.DurationVar(&cfg.ACLTTL, "aclttl", 5*time.Second, "Duration znode ACLs are cached for when -aclcheck is enabled")
+	cmd.BoolVar(&cfg.LazyMount, "lazymount", false, "Mount immediately and connect to Zookeeper in the background, operations return EAGAIN until connected, failed attempts are retried")
+	cmd.Var((*stringList)(&cfg.StripPrefix), "stripprefix", "Hide a prefix (header) from the data of matching znodes, re-added on write, pattern=prefix (repeatable)")
+	cmd.BoolVar(&cfg.Syslog, "syslog", false, "Send logging to the local syslog daemon, otherwise STDOUT or -logfile")
+	cmd.StringVar(&cfg.SyslogFacility, "syslogfacility", "daemon", "Syslog facility used with -syslog")
+	cmd.StringVar(&cfg.SyslogTag, "syslogtag", "zoofuse", "Syslog tag used with -syslog")
+	cmd.BoolVar(&cfg.Base64, "base64", false, "Accompany each znode file by a base64 encoded .b64 view, for binary safe shell piping")
+	cmd.StringVar(&cfg.OnBusyUnmount, "onbusyunmount", UnmountForce, "Unmount policy while files are open: wait (for -unmounttimeout), force or fail")
+	cmd.DurationVar(&cfg.UnmountTimeout, "unmounttimeout", 10*time.Second, "Duration the wait -onbusyunmount policy waits for open files to close")
+	cmd.StringVar(&cfg.NamePattern, "namepattern", "", "Regular expression the names of created files and directories must match, otherwise EINVAL (anchor with ^ and $ for a full match)")
+	cmd.Int64Var(&cfg.MaxCreates, "maxcreates", 0, "Limit the number of znodes created per session, further creates fail with ENOSPC (default 0, unlimited)")
+	cmd.Var((*stringList)(&cfg.Bucket), "bucket", "Present the children of matching directories in subdirectories named by their first N characters, pattern=prefixlen (repeatable)")
+	cmd.Var((*stringList)(&cfg.SizeBudget), "sizebudget", "Cap the total data size of matching subtrees, writes exceeding it fail with EDQUOT, pattern=bytes (repeatable)")
+	cmd.StringVar(&cfg.Atime, "atime", AtimeNow, "Access time reported for znodes: now, or mtime for consistency across restarts")
+	cmd.BoolVar(&cfg.SafeDelete, "safedelete", false, "Check deletes against the znode version, failing with EAGAIN when the znode was modified concurrently")
+	cmd.BoolVar(&cfg.Ephemeral, "ephemeral", false, "Create files as ephemeral znodes, removed by Zookeeper when the zoofuse session ends")
+	cmd.StringVar(&cfg.EphemeralSuffix, "ephemeralsuffix", "", "Create files whose name ends in this suffix (e.g. .ephemeral) as ephemeral znodes")
+	cmd.Var((*stringList)(&cfg.UTF8Only), "utf8only", "Refuse writes holding invalid UTF-8 with EINVAL, pattern=text, or exempt paths with pattern=binary (repeatable, first match applies)")
+	cmd.BoolVar(&cfg.Coalesce, "coalesce", false, "Share a single Zookeeper call between concurrent identical reads of a znode, cutting the load of hot znodes")
+	cmd.BoolVar(&cfg.CreateRoot, "create-root", false, "Create the -zkroot znode, along with its ancestors, when it does not exist rather than refusing to mount (requires -rw)")
+	cmd.BoolVar(&cfg.LinkCopy, "linkcopy", false, "Let ln create a znode holding a copy of the data of the original, which is not kept in sync (default hard links fail with EPERM)")
+	cmd.IntVar(&cfg.HotPaths, "hotpaths", 0, "Count the Zookeeper operations of each znode, reporting the N busiest in .zoofuse/hotpaths (default 0, disabled)")
+	cmd.BoolVar(&cfg.TLS, "tls", false, "Connect to the Zookeeper servers over TLS (the secureClientPort of the ensemble)")
+	cmd.StringVar(&cfg.TLSCert, "tls-cert", "", "Client certificate presented to the servers with -tls, a PEM file (requires -tls-key)")
+	cmd.StringVar(&cfg.TLSKey, "tls-key", "", "Private key of the -tls-cert client certificate, a PEM file")
+	cmd.StringVar(&cfg.TLSCA, "tls-ca", "", "CA bundle the servers are verified against with -tls, a PEM file (default the system roots)")
+	cmd.BoolVar(&cfg.TLSInsecure, "tls-insecure", false, "Skip the verification of the server certificates with -tls, for self-signed development ensembles only")
+	cmd.IntVar(&cfg.ReadCap, "readcap", 0, "Cut reads of znodes holding more data to this many bytes, flagged by the user.zk.truncated xattr (default 0, no cap)")
+	cmd.BoolVar(&cfg.DirCache, "dircache", false, "Cache the entries of listed directories until their children change (cversion), sparing a round trip per child on re-listing")
+	cmd.IntVar(&cfg.MaxZnode, "maxznode", MaxZnodeData, "Largest znode data in bytes, matching the jute.maxbuffer of the ensemble, larger writes fail with EFBIG (at most 64MB)")
+	cmd.StringVar(&cfg.WriteUIDs, "writeuids", "", "Restrict mutating operations to these users, a comma separated list of UIDs, others get EACCES (default any user)")
+	cmd.StringVar(&cfg.MetricsAddr, "metrics-addr", "", "Serve Prometheus metrics of the Zookeeper requests on this address under /metrics, e.g. :9141")
+	cmd.IntVar(&cfg.MaxBackground, "maxbackground", maxBackground, "Number of requests the kernel keeps in flight to zoofuse, raise for highly concurrent workloads")
+	cmd.IntVar(&cfg.Congestion, "congestionthreshold", 0, "Background requests past which the kernel throttles the mount, set through fusectl which requires root (default 3/4 of maxbackground)")
+	cmd.BoolVar(&cfg.AllowOther, "allow-other", false, "Allow every user to access the mount (requires user_allow_other in /etc/fuse.conf)")
+	cmd.BoolVar(&cfg.AllowRoot, "allow-root", false, "Allow root to access the mount alongside the mounting user (requires user_allow_other in /etc/fuse.conf)")
+	cmd.StringVar(&cfg.MarkerFormat, "markerformat", MarkerFormatText, "Format of the __znode_stat__ file: text (zkCli style) or json")
+	cmd.StringVar(&cfg.Bootstrap, "bootstrap", "", "Create the znodes of a JSON dump beneath the root on mount, only when the root has no children (requires -rw)")
+	cmd.BoolVar(&cfg.SyncWrites, "syncwrites", false, "Sync the connected server with the leader after each write, before reporting it successful (adds latency)")
+	cmd.BoolVar(&cfg.WatchCountXAttr, "watchcountxattr", false, "Report the watches registered on each znode across the ensemble in the user.zk.watchcount xattr (requires the wchp four letter word)")
+	cmd.IntVar(&cfg.ChildRetries, "childretries", ChildRetries, "Retry a failed stat of a listed child N times (backing off from 50ms) before leaving it out of the listing")
+	cmd.DurationVar(&cfg.AttrCache, "attrcache", DefaultAttrCacheTTL, "Duration znode stats are cached for, sparing a round trip per stat of a recently listed file (0 disables)")
+	cmd.IntVar(&cfg.MaxConcurrency, "maxconcurrency", MaxConcurrentRequests, "Parallel Zookeeper requests sent to stat the children of a listed directory")
+	cmd.Var((*stringList)(&cfg.Ignore), "ignore", "Hide the paths matching a glob pattern, along with their subtrees, e.g. zookeeper (repeatable)")
+	cmd.BoolVar(&cfg.LazyModes, "lazymodes", false, "List directories without a round trip per child, file types are learned on lookup (faster listings of huge directories)")
+	cmd.IntVar(&cfg.ReadyFD, "readyfd", 0, "Write a newline to this inherited file descriptor once the mount is serving, for supervisors (default 0, disabled)")
+	cmd.StringVar(&cfg.ReadyFile, "readyfile", "", "Write this file once the mount is serving, for supervisors")
+	cmd.DurationVar(&cfg.Timeout, "timeout", DefaultSessionTimeout, "Zookeeper session timeout requested from the ensemble, which may clamp it (2 to 20 times its tickTime)")
+	cmd.StringVar(&cfg.DirTemplate, "dirtemplate", "", "Data directories created by mkdir are seeded with, e.g. '{}' (default empty)")
+	cmd.DurationVar(&cfg.MaxBackoff, "maxbackoff", MaxReconnectBackoff, "Longest delay between attempts to reconnect once the Zookeeper session expired, doubling from 250ms")
+	cmd.BoolVar(&cfg.Recursive, "recursive", false, "Let rmdir remove a directory along with all of its descendants, rather than failing with ENOTEMPTY")
+	cmd.BoolVar(&cfg.LatencyXAttr, "latencyxattr", false, "Time each Zookeeper operation, reporting the most recent duration per znode in the user.zk.lastlatency xattr")
+	cmd.BoolVar(&cfg.Sync, "sync", false, "Sync the connected server with the leader before a file is opened, so reads observe every prior write (adds latency)")
+	cmd.BoolVar(&cfg.Watch, "watch", false, "Watch opened files and directories, invalidating the kernel cache as soon as they change in Zookeeper")
+	cmd.BoolVar(&cfg.URLEncode, "urlencode", false, "Present znode names percent-encoded, e.g. 'a b:c' as a%20b%3Ac, decoding the names given to lookups")
+	cmd.StringVar(&cfg.MtimeStore, "mtimestore", "", "Znode, relative to zkroot, keeping the modification times set by touch (hidden from listings)")
+	cmd.StringVar(&cfg.Identity, "identity", "", "Name reported alongside zkconn and zkroot by the .zoofuse/identity control file")
+	cmd.StringVar(&cfg.Snapshot, "snapshot", "", "Dump file the live tree is compared against by the .zoofuse/diff control file")
+
+	// the config file overlays the flag defaults, the command line is parsed last so flags take precedence.
+	if path := configFileArg(os.Args[1:]); path != "" {
+		if err := loadConfigFile(&cfg, path); err != nil {
+			log.WithFields(log.Fields{
+				"config": path,
+				"err":    err,
+			}).Fatal("Failed to load config file")
+		}
+	}
 	cmd.Parse(os.Args[1:])
 
+	if *showVersion {
+		fmt.Println(versionString(Version, Commit, BuildDate))
+		os.Exit(0)
+	}
+
 	if len(cmd.Args()) < 1 {
 		Usage()
 		os.Exit(1)
 	}
+	cfg.FuseRoot = cmd.Arg(0)
 
-	if *logFile != "" {
-		logH, err := os.OpenFile(*logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if cfg.LogFile != "" {
+		logH, err := os.OpenFile(cfg.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 		if err == nil {
 			log.SetOutput(logH)
 		}
 		defer logH.Close()
 	}
 
-	if *debug {
-		log.SetLevel(log.DebugLevel)
+	if !validUnmountPolicy(cfg.OnBusyUnmount) {
+		log.WithFields(log.Fields{
+			"policy": cfg.OnBusyUnmount,
+		}).Fatal("Invalid onbusyunmount policy, expected wait, force or fail")
+	}
+
+	if cfg.Atime != AtimeNow && cfg.Atime != AtimeMtime {
+		log.WithFields(log.Fields{
+			"atime": cfg.Atime,
+		}).Fatal("Invalid atime, expected now or mtime")
+	}
+
+	if cfg.MarkerFormat != MarkerFormatText && cfg.MarkerFormat != MarkerFormatJSON {
+		log.WithFields(log.Fields{
+			"markerformat": cfg.MarkerFormat,
+		}).Fatal("Invalid markerformat, expected text or json")
+	}
+
+	if cfg.AllowOther && cfg.AllowRoot {
+		log.Fatal("allow-other and allow-root are mutually exclusive")
+	}
+
+	if cfg.Syslog {
+		if err := enableSyslog(log.StandardLogger(), cfg.SyslogFacility, cfg.SyslogTag, dialSyslog); err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Fatal("Failed to enable syslog")
+		}
+	}
+
+	log.SetLevel(logLevel(cfg.Debug))
+
+	var merges []MergeRule
+	for _, r := range cfg.Merge {
+		rule, err := ParseMergeRule(r)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Fatal("Invalid merge rule")
+		}
+		merges = append(merges, rule)
 	}
 
-	zooHandler, err := NewZooHandler([]string{*zkConn}, *zkChroot, cmd.Arg(0))
+	rules, err := parseConfigRules(&cfg)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
-		}).Fatal("Failed to create ZooHandler")
+		}).Fatal("Invalid path rule")
+	}
+
+	var namePattern *regexp.Regexp
+	if cfg.NamePattern != "" {
+		pattern, err := regexp.Compile(cfg.NamePattern)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Fatal("Invalid namepattern")
+		}
+		namePattern = pattern
+	}
+
+	if cfg.MaxConcurrency < 1 {
+		log.WithFields(log.Fields{
+			"maxconcurrency": cfg.MaxConcurrency,
+		}).Fatal("Invalid maxconcurrency, expected at least 1")
+	}
+
+	writeUIDs, err := ParseUIDs(cfg.WriteUIDs)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"writeuids": cfg.WriteUIDs,
+			"err":       err,
+		}).Fatal("Invalid writeuids")
+	}
+
+	if cfg.TLS {
+		config, err := newTLSConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSCA, cfg.TLSInsecure)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Fatal("Invalid TLS configuration")
+		}
+		if cfg.TLSInsecure {
+			log.Warn("server certificates are not verified, the connection to Zookeeper is open to interception")
+		}
+		connections.tls = config
+	} else if cfg.TLSCert != "" || cfg.TLSKey != "" || cfg.TLSCA != "" || cfg.TLSInsecure {
+		log.Fatal("Invalid TLS configuration, tls-cert, tls-key, tls-ca and tls-insecure require -tls")
+	}
+	// both write to the tree ahead of the read-only wrapping of the connection.
+	if !cfg.ReadWrite && (cfg.Bootstrap != "" || cfg.CreateRoot) {
+		log.Fatal("Invalid configuration, bootstrap and create-root write to the tree and require -rw")
+	}
+	if cfg.HotPaths < 0 {
+		log.WithFields(log.Fields{
+			"hotpaths": cfg.HotPaths,
+		}).Fatal("Invalid hotpaths, expected a number of paths or 0")
+	}
+	if cfg.ReadCap < 0 {
+		log.WithFields(log.Fields{
+			"readcap": cfg.ReadCap,
+		}).Fatal("Invalid readcap, expected a number of bytes or 0")
+	}
+	if cfg.MaxZnode < 1 || cfg.MaxZnode > MaxZnodeCeiling {
+		log.WithFields(log.Fields{
+			"maxznode": cfg.MaxZnode,
+		}).Fatal("Invalid maxznode, expected between 1 and 64MB")
+	}
+	if cfg.MaxBackground < 1 || cfg.MaxBackground > math.MaxUint16 {
+		log.WithFields(log.Fields{
+			"maxbackground": cfg.MaxBackground,
+		}).Fatal("Invalid maxbackground, expected between 1 and 65535")
+	}
+	if cfg.Congestion < 0 || cfg.Congestion > cfg.MaxBackground {
+		log.WithFields(log.Fields{
+			"congestionthreshold": cfg.Congestion,
+			"maxbackground":       cfg.MaxBackground,
+		}).Fatal("Invalid congestionthreshold, expected at most maxbackground")
+	}
+
+	var watchCounts watchCounter
+	if cfg.WatchCountXAttr {
+		servers, err := ParseZKConn(cfg.ZKConn)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Fatal("Invalid zkconn")
+		}
+		watchCounts = newWchpWatchCounter(servers, cfg.ZKRoot, cfg.URLEncode)
+	}
+
+	var dirTemplate []byte
+	if cfg.DirTemplate != "" {
+		if len(cfg.DirTemplate) > cfg.MaxZnode {
+			log.WithFields(log.Fields{
+				"size": len(cfg.DirTemplate),
+			}).Fatal("Invalid dirtemplate, exceeds the znode data limit")
+		}
+		dirTemplate = []byte(cfg.DirTemplate)
+	}
+
+	var snapshot *Dump
+	if cfg.Snapshot != "" {
+		dump, err := LoadDump(cfg.Snapshot)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"snapshot": cfg.Snapshot,
+				"err":      err,
+			}).Fatal("Failed to load snapshot")
+		}
+		snapshot = dump
+	}
+
+	var template *Dump
+	if cfg.Bootstrap != "" {
+		dump, err := LoadDump(cfg.Bootstrap)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"bootstrap": cfg.Bootstrap,
+				"err":       err,
+			}).Fatal("Failed to load bootstrap template")
+		}
+		if errs := dump.Validate(); len(errs) > 0 {
+			log.WithFields(log.Fields{
+				"bootstrap": cfg.Bootstrap,
+				"errs":      errs,
+			}).Fatal("Bootstrap template is invalid")
+		}
+		template = dump
+	}
+
+	// with a lazy mount the filesystem is served straight away, operations return EAGAIN until a session with
+	// Zookeeper has been established in the background.
+	var zooHandler Zoohandler
+	// the ACL cache outlives the connection attempts, its TTL being changed on reload.
+	var acls *aclCache
+	if cfg.ACLCheck {
+		acls = newACLCache(cfg.ACLTTL)
+	}
+	if cfg.LazyMount {
+		// a malformed zkconn cannot be fixed by retrying, it is refused ahead of the mount.
+		if _, err := ParseZKConn(cfg.ZKConn); err != nil {
+			log.WithFields(log.Fields{
+				"err": err,
+			}).Fatal("Invalid zkconn")
+		}
+		lazy := &LazyZooHandler{}
+		go lazy.connect(func() (Zoohandler, error) {
+			zh, err := newZooHandle(&cfg, acls)
+			if err != nil {
+				return nil, err
+			}
+			if err := zh.WaitForSession(); err != nil {
+				zh.Close()
+				return nil, err
+			}
+			if template != nil {
+				applyBootstrap(zh, template)
+			}
+			return zh, nil
+		}, cfg.MaxBackoff)
+		zooHandler = lazy
+	} else {
+		zh := connect(&cfg, acls)
+		if template != nil {
+			applyBootstrap(zh, template)
+		}
+		zooHandler = zh
+	}
+	// mutations are refused ahead of the ensemble on read-only mounts, whichever handler attempts them.
+	if !cfg.ReadWrite {
+		zooHandler = NewReadOnlyZooHandler(zooHandler)
+	}
+	if cfg.URLEncode {
+		zooHandler = NewURLEncodingZooHandler(zooHandler)
+	}
+	var latencies latencySource
+	if cfg.LatencyXAttr {
+		timed := NewLatencyZooHandler(zooHandler)
+		latencies, zooHandler = timed, timed
+	}
+	var hotPaths hotPathSource
+	if cfg.HotPaths > 0 {
+		counted := NewHotPathZooHandler(zooHandler, cfg.HotPaths)
+		hotPaths, zooHandler = counted, counted
+	}
+	if cfg.MetricsAddr != "" {
+		metrics := NewMetricsZooHandler(zooHandler)
+		go serveMetrics(cfg.MetricsAddr, metrics)
+		zooHandler = metrics
+	}
+	var statCache ttlCache
+	if cfg.AttrCache > 0 {
+		cached := NewStatCachingZooHandler(zooHandler, cfg.AttrCache)
+		statCache = cached
+		zooHandler = cached
+	}
+	if cfg.Coalesce {
+		zooHandler = NewCoalescingZooHandler(zooHandler)
 	}
 
 	fuseFS := FuseFS{
-		FileSystem:  pathfs.NewDefaultFileSystem(),
-		zh:          zooHandler,
-		FuseRoot:    cmd.Arg(0),
-		FSServer:    nil,
-		IsReadWrite: *isReadWrite,
+		FileSystem:      pathfs.NewDefaultFileSystem(),
+		zh:              zooHandler,
+		FuseRoot:        cfg.FuseRoot,
+		FSServer:        nil,
+		IsReadWrite:     cfg.ReadWrite,
+		MergeRules:      merges,
+		ShowCreateMode:  cfg.ModeBits,
+		RetryBadVersion: cfg.RetryBadVersion,
+		Config:          &cfg,
+		ACLCheck:        cfg.ACLCheck,
+		StripPrefixes:   rules.stripPrefixes,
+		Base64:          cfg.Base64,
+		OnBusyUnmount:   cfg.OnBusyUnmount,
+		UnmountTimeout:  cfg.UnmountTimeout,
+		NamePattern:     namePattern,
+		MaxCreates:      cfg.MaxCreates,
+		Buckets:         rules.buckets,
+		SizeBudgets:     rules.sizeBudgets,
+		AtimeMode:       cfg.Atime,
+		SafeDelete:      cfg.SafeDelete,
+		Ephemeral:       cfg.Ephemeral,
+		EphemeralSuffix: cfg.EphemeralSuffix,
+		Snapshot:        snapshot,
+		UTF8Rules:       rules.utf8,
+		MtimeStore:      cleanPath(cfg.MtimeStore),
+		Watch:           cfg.Watch,
+		SyncReads:       cfg.Sync,
+		Latencies:       latencies,
+		RecursiveRmdir:  cfg.Recursive,
+		DirTemplate:     dirTemplate,
+		OnServing:       readySignal(cfg.ReadyFD, cfg.ReadyFile),
+		LazyModes:       cfg.LazyModes,
+		Ignore:          rules.ignore,
+		MaxConcurrency:  cfg.MaxConcurrency,
+		ChildRetries:    cfg.ChildRetries,
+		WatchCounts:     watchCounts,
+		SyncWrites:      cfg.SyncWrites,
+		ZKRoot:          cfg.ZKRoot,
+		MarkerFormat:    cfg.MarkerFormat,
+		AllowOther:      cfg.AllowOther,
+		AllowRoot:       cfg.AllowRoot,
+		MaxBackground:   cfg.MaxBackground,
+		Congestion:      cfg.Congestion,
+		WriteUIDs:       writeUIDs,
+		MaxZnode:        cfg.MaxZnode,
+		DirCache:        cfg.DirCache,
+		ReadCap:         cfg.ReadCap,
+		HotPaths:        hotPaths,
+		LinkCopy:        cfg.LinkCopy,
+		StatCache:       statCache,
+	}
+	if acls != nil {
+		fuseFS.ACLs = acls
 	}
 
 	err = fuseFS.Mount(nil)
@@ -102,15 +528,34 @@ func main() {
 	}
 	defer fuseFS.Unmount()
 
-	// attempt self healing logic batch capturing sig int/term.
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	// attempt self healing logic batch capturing sig int/term. SIGHUP reloads the config file.
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
-		<-c
-		fuseFS.Unmount()
-		os.Exit(1)
+		for sig := range c {
+			if sig == syscall.SIGHUP {
+				if cfg.ConfigFile == "" {
+					log.Warn("SIGHUP received without a config file to reload")
+					continue
+				}
+				if err := fuseFS.reloadConfig(); err != nil {
+					log.WithFields(log.Fields{
+						"config": cfg.ConfigFile,
+						"err":    err,
+					}).Error("Failed to reload config file")
+				}
+				continue
+			}
+			if err := fuseFS.Unmount(); err != nil {
+				log.WithFields(log.Fields{
+					"err": err,
+				}).Error("Failed to unmount FUSE")
+				continue
+			}
+			os.Exit(1)
+		}
 	}()
 
-	banner(fuseFS.FuseRoot, *zkConn, *zkChroot, *logFile, *isReadWrite)
+	banner(fuseFS.FuseRoot, cfg.ZKConn, cfg.ZKRoot, cfg.LogFile, cfg.ReadWrite)
 	fuseFS.Serve()
 }
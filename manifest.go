@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// manifestTree writes a `path: sha256` line for the znode at `path` and each of its descendants to `out`, sorted by
+// path, so the manifests of two environments can be compared with `diff`.
+func manifestTree(ctx context.Context, zh Zoohandler, path string, out io.Writer) error {
+	sums := make(map[string][sha256.Size]byte)
+	var paths []string
+	err := walkTree(ctx, zh, path, func(path string) error {
+		data, _, err := zh.Get(ctx, path)
+		if err != nil {
+			return fmt.Errorf("unable to Get %s: %v", path, err)
+		}
+		sums[path] = sha256.Sum256(data)
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(out, "%s: %x\n", path, sums[path])
+	}
+	return nil
+}
+
+// runManifest implements the `manifest` subcommand, printing the checksum manifest of a subtree without mounting.
+// The return value is the process exit code.
+func runManifest(args []string, out io.Writer) int {
+	cmd := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	cmd.SetOutput(out)
+	zkConn := cmd.String("zkconn", "127.0.0.1:2181", "Zookeeper connection string, a comma separated list of host:port servers")
+	zkRoot := cmd.String("zkroot", "/", "Alias the root Zookeeper tree to an alternate path")
+	var auth stringList
+	cmd.Var(&auth, "auth", "Authenticate the session with digest credentials, user:password (repeatable)")
+	if err := cmd.Parse(args); err != nil {
+		return 2
+	}
+	if cmd.NArg() != 1 {
+		fmt.Fprintln(out, "manifest expects a single znode path")
+		return 2
+	}
+
+	servers, err := ParseZKConn(*zkConn)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	zh, err := NewZooHandler(servers, *zkRoot, "/", auth, DefaultSessionTimeout, false)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	defer zh.Close()
+
+	if err := manifestTree(context.Background(), zh, filepath.Join("/", cmd.Arg(0)), out); err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestManifestTree verifies the manifest lists the checksum of every znode of the subtree, sorted by path whatever
+// the order children are listed in, and is identical across runs.
+func TestManifestTree(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	tree := map[string]struct {
+		data     string
+		children []string
+	}{
+		"/app":            {"", []string{"db", "db-old"}},
+		"/app/db":         {"host=db1", []string{"replica"}},
+		"/app/db-old":     {"host=db0", []string{}},
+		"/app/db/replica": {"host=db2", []string{}},
+	}
+	for path, node := range tree {
+		mockZooKeeper.zk.On("Get", path).Return([]byte(node.data), &zk.Stat{}, nil)
+		mockZooKeeper.zk.On("Children", path).Return(node.children, &zk.Stat{}, nil)
+	}
+
+	var out bytes.Buffer
+	assert.Nil(t, manifestTree(ctx, mockZooKeeper, "/app", &out))
+	assert.Equal(t, `/app: e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
+/app/db: 19e012295851b8d5898a5d1341473a6b154ebe69a835019cf5868247f198e360
+/app/db-old: ca90eab7ab1ee51abb4ac70defd2d6976146c8cff509a60af310b143831e72b3
+/app/db/replica: e1f528575caba81fbbe245e4e7df3e46d352fa01c6c07774ca443594c10734e1
+`, out.String())
+
+	var again bytes.Buffer
+	assert.Nil(t, manifestTree(ctx, mockZooKeeper, "/app", &again))
+	assert.Equal(t, out.String(), again.String())
+
+	mockZooKeeper.zk.On("Get", "/missing").Return([]byte{}, (*zk.Stat)(nil), zk.ErrNoNode)
+	assert.NotNil(t, manifestTree(ctx, mockZooKeeper, "/missing", &out))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MergeRule describes a virtual, read-only file whose content is the JSON deep-merge of several source znodes. Sources
+// are applied in order, so values found in later znodes override those found in earlier ones (base + overrides).
+type MergeRule struct {
+	Path    string   // fuse path of the virtual file
+	Sources []string // fuse paths of the znodes to merge, lowest precedence first
+}
+
+// ParseMergeRule builds a MergeRule from the `out=base,override[,...]` form accepted by the `-merge` flag.
+func ParseMergeRule(rule string) (MergeRule, error) {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 || cleanPath(parts[0]) == "" {
+		return MergeRule{}, fmt.Errorf("invalid merge rule %q, expected out=base,override", rule)
+	}
+
+	var sources []string
+	for _, source := range strings.Split(parts[1], ",") {
+		if source = cleanPath(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 0 {
+		return MergeRule{}, fmt.Errorf("merge rule %q has no source znodes", rule)
+	}
+	return MergeRule{Path: cleanPath(parts[0]), Sources: sources}, nil
+}
+
+// cleanPath normalizes a fuse path to the form handed to us by pathfs (no leading or trailing separator).
+func cleanPath(path string) string {
+	return strings.Trim(filepath.Clean("/"+strings.TrimSpace(path)), "/")
+}
+
+// deepMerge recursively merges src into dst. Nested objects are merged key by key, any other value in src replaces
+// the value held by dst.
+func deepMerge(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{})
+	}
+	for key, srcVal := range src {
+		srcMap, srcIsMap := srcVal.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			dst[key] = deepMerge(dstMap, srcMap)
+			continue
+		}
+		dst[key] = srcVal
+	}
+	return dst
+}
+
+// mergeRule returns the MergeRule presenting `path`, if any.
+func (f *FuseFS) mergeRule(path string) (MergeRule, bool) {
+	for _, rule := range f.MergeRules {
+		if rule.Path == path {
+			return rule, true
+		}
+	}
+	return MergeRule{}, false
+}
+
+// renderMerge fetches each source znode of the rule and returns the deep-merged JSON document.
+func (f *FuseFS) renderMerge(ctx context.Context, rule MergeRule) ([]byte, error) {
+	var merged map[string]interface{}
+	for _, source := range rule.Sources {
+		data, _, err := f.zh.Get(ctx, source)
+		if err != nil {
+			return nil, fmt.Errorf("unable to Get merge source %s: %v", source, err)
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("merge source %s is not a JSON object: %v", source, err)
+		}
+		merged = deepMerge(merged, doc)
+	}
+
+	out, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseMergeRule(t *testing.T) {
+	rule, err := ParseMergeRule("/app/config.json=/app/base, /app/override")
+	assert.Nil(t, err)
+	assert.Equal(t, "app/config.json", rule.Path)
+	assert.Equal(t, []string{"app/base", "app/override"}, rule.Sources)
+
+	_, err = ParseMergeRule("/app/config.json")
+	assert.NotNil(t, err)
+	_, err = ParseMergeRule("/app/config.json=")
+	assert.NotNil(t, err)
+}
+
+// TestMergeFile deep-merges two source znodes into a virtual file and verifies the file is read-only.
+func TestMergeFile(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	base := []byte(`{"db": {"host": "localhost", "port": 5432}, "debug": false}`)
+	override := []byte(`{"db": {"host": "db.prod"}, "debug": true}`)
+	mockZooKeeper.zk.On("Get", "app/base").Return(base, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app/override").Return(override, &zk.Stat{}, nil)
+
+	rule, err := ParseMergeRule("app/config.json=app/base,app/override")
+	assert.Nil(t, err)
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, MergeRules: []MergeRule{rule}}
+
+	attr, status := fs.GetAttr("app/config.json", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.S_IFREG|IfRegRO, attr.Mode)
+
+	file, status := fs.Open("app/config.json", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+
+	buf := make([]byte, attr.Size)
+	res, status := file.Read(buf, 0)
+	assert.Equal(t, fuse.OK, status)
+	data, _ := res.Bytes(buf)
+
+	var merged map[string]interface{}
+	assert.Nil(t, json.Unmarshal(data, &merged))
+	assert.Equal(t, map[string]interface{}{
+		"db":    map[string]interface{}{"host": "db.prod", "port": float64(5432)},
+		"debug": true,
+	}, merged)
+
+	// the merged view is never writable, regardless of the -rw flag.
+	_, status = fs.Open("app/config.json", uint32(fuse.O_ANYWRITE), nil)
+	assert.Equal(t, fuse.EROFS, status)
+	_, status = file.Write([]byte("{}"), 0)
+	assert.Equal(t, fuse.EROFS, status)
+	assert.Equal(t, fuse.EROFS, fs.Unlink("app/config.json", nil))
+}
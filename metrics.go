@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// metricsBuckets are the upper bounds, in seconds, of the buckets of the ZK request duration histogram.
+var metricsBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// opMetrics holds the counters of a single ZK operation.
+type opMetrics struct {
+	success uint64
+	failure uint64
+	buckets []uint64 // observations per bucket of metricsBuckets, not cumulative
+	sum     float64  // total duration of the observations, in seconds
+}
+
+// MetricsZooHandler is a Zoohandler counting and timing every call, by operation and outcome. The metrics are served
+// in the Prometheus text format, so operators can alert on the ZK error rate and latency seen by the mount.
+type MetricsZooHandler struct {
+	wrappedZooHandler
+	mu  sync.Mutex
+	ops map[string]*opMetrics
+}
+
+// NewMetricsZooHandler wraps `zh`, counting and timing each of its calls.
+func NewMetricsZooHandler(zh Zoohandler) *MetricsZooHandler {
+	return &MetricsZooHandler{wrappedZooHandler: wrappedZooHandler{zh}, ops: make(map[string]*opMetrics)}
+}
+
+// observe accounts for a call to `op` started at `start`, which failed when `err` is set.
+func (m *MetricsZooHandler) observe(op string, start time.Time, err error) {
+	elapsed := time.Since(start).Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metrics, ok := m.ops[op]
+	if !ok {
+		metrics = &opMetrics{buckets: make([]uint64, len(metricsBuckets))}
+		m.ops[op] = metrics
+	}
+	if err != nil {
+		metrics.failure++
+	} else {
+		metrics.success++
+	}
+	metrics.sum += elapsed
+	if i := sort.SearchFloat64s(metricsBuckets, elapsed); i < len(metricsBuckets) {
+		metrics.buckets[i]++
+	}
+}
+
+// WriteMetrics renders the metrics in the Prometheus text exposition format.
+func (m *MetricsZooHandler) WriteMetrics(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ops []string
+	for op := range m.ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	fmt.Fprintln(w, "# HELP zoofuse_zk_requests_total Zookeeper requests issued by the mount, by operation and result.")
+	fmt.Fprintln(w, "# TYPE zoofuse_zk_requests_total counter")
+	for _, op := range ops {
+		fmt.Fprintf(w, "zoofuse_zk_requests_total{op=%q,result=\"success\"} %d\n", op, m.ops[op].success)
+		fmt.Fprintf(w, "zoofuse_zk_requests_total{op=%q,result=\"error\"} %d\n", op, m.ops[op].failure)
+	}
+
+	fmt.Fprintln(w, "# HELP zoofuse_zk_request_duration_seconds Duration of the Zookeeper requests issued by the mount.")
+	fmt.Fprintln(w, "# TYPE zoofuse_zk_request_duration_seconds histogram")
+	for _, op := range ops {
+		metrics := m.ops[op]
+		var cumulative uint64
+		for i, bound := range metricsBuckets {
+			cumulative += metrics.buckets[i]
+			fmt.Fprintf(w, "zoofuse_zk_request_duration_seconds_bucket{op=%q,le=\"%g\"} %d\n", op, bound, cumulative)
+		}
+		count := metrics.success + metrics.failure
+		fmt.Fprintf(w, "zoofuse_zk_request_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", op, count)
+		fmt.Fprintf(w, "zoofuse_zk_request_duration_seconds_sum{op=%q} %g\n", op, metrics.sum)
+		fmt.Fprintf(w, "zoofuse_zk_request_duration_seconds_count{op=%q} %d\n", op, count)
+	}
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape.
+func (m *MetricsZooHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteMetrics(w)
+}
+
+// serveMetrics serves the metrics of `m` on `addr` under /metrics. It blocks, a listener failing is logged.
+func serveMetrics(addr string, m *MetricsZooHandler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	log.WithFields(log.Fields{
+		"addr": addr,
+	}).Info("serving metrics")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.WithFields(log.Fields{
+			"addr": addr,
+			"err":  err,
+		}).Error("metrics listener failed")
+	}
+}
+
+// Children implements Zoohandler.Children
+func (m *MetricsZooHandler) Children(ctx context.Context, path string) (children []string, stat *zk.Stat, err error) {
+	defer func(start time.Time) { m.observe("children", start, err) }(time.Now())
+	return m.Zoohandler.Children(ctx, path)
+}
+
+// Create implements Zoohandler.Create
+func (m *MetricsZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (created string, err error) {
+	defer func(start time.Time) { m.observe("create", start, err) }(time.Now())
+	return m.Zoohandler.Create(ctx, path, data, flags, acl)
+}
+
+// Delete implements Zoohandler.Delete
+func (m *MetricsZooHandler) Delete(ctx context.Context, path string, version int32) (err error) {
+	defer func(start time.Time) { m.observe("delete", start, err) }(time.Now())
+	return m.Zoohandler.Delete(ctx, path, version)
+}
+
+// Exists implements Zoohandler.Exists
+func (m *MetricsZooHandler) Exists(ctx context.Context, path string) (found bool, stat *zk.Stat, err error) {
+	defer func(start time.Time) { m.observe("exists", start, err) }(time.Now())
+	return m.Zoohandler.Exists(ctx, path)
+}
+
+// Get implements Zoohandler.Get
+func (m *MetricsZooHandler) Get(ctx context.Context, path string) (data []byte, stat *zk.Stat, err error) {
+	defer func(start time.Time) { m.observe("get", start, err) }(time.Now())
+	return m.Zoohandler.Get(ctx, path)
+}
+
+// Set implements Zoohandler.Set
+func (m *MetricsZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (stat *zk.Stat, err error) {
+	defer func(start time.Time) { m.observe("set", start, err) }(time.Now())
+	return m.Zoohandler.Set(ctx, path, data, version)
+}
+
+// GetACL implements Zoohandler.GetACL
+func (m *MetricsZooHandler) GetACL(ctx context.Context, path string) (acl []zk.ACL, stat *zk.Stat, err error) {
+	defer func(start time.Time) { m.observe("getacl", start, err) }(time.Now())
+	return m.Zoohandler.GetACL(ctx, path)
+}
+
+// SetACL implements Zoohandler.SetACL
+func (m *MetricsZooHandler) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (stat *zk.Stat, err error) {
+	defer func(start time.Time) { m.observe("setacl", start, err) }(time.Now())
+	return m.Zoohandler.SetACL(ctx, path, acl, version)
+}
+
+// GetW implements Zoohandler.GetW
+func (m *MetricsZooHandler) GetW(ctx context.Context, path string) (data []byte, stat *zk.Stat, watch <-chan zk.Event, err error) {
+	defer func(start time.Time) { m.observe("getw", start, err) }(time.Now())
+	return m.Zoohandler.GetW(ctx, path)
+}
+
+// ChildrenW implements Zoohandler.ChildrenW
+func (m *MetricsZooHandler) ChildrenW(ctx context.Context, path string) (children []string, stat *zk.Stat, watch <-chan zk.Event, err error) {
+	defer func(start time.Time) { m.observe("childrenw", start, err) }(time.Now())
+	return m.Zoohandler.ChildrenW(ctx, path)
+}
+
+// Sync implements Zoohandler.Sync
+func (m *MetricsZooHandler) Sync(ctx context.Context, path string) (synced string, err error) {
+	defer func(start time.Time) { m.observe("sync", start, err) }(time.Now())
+	return m.Zoohandler.Sync(ctx, path)
+}
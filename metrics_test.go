@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestMetricsZooHandler verifies each call is counted by operation and result, and timed.
+func TestMetricsZooHandler(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app/missing").Return([]byte(nil), (*zk.Stat)(nil), zk.ErrNoNode)
+
+	metrics := NewMetricsZooHandler(mockZooKeeper)
+	metrics.Get(ctx, "app/config")
+	metrics.Get(ctx, "app/config")
+	_, _, err := metrics.Get(ctx, "app/missing")
+	assert.Equal(t, zk.ErrNoNode, err)
+
+	var buf bytes.Buffer
+	metrics.WriteMetrics(&buf)
+	out := buf.String()
+	assert.Contains(t, out, `zoofuse_zk_requests_total{op="get",result="success"} 2`)
+	assert.Contains(t, out, `zoofuse_zk_requests_total{op="get",result="error"} 1`)
+	assert.Contains(t, out, `zoofuse_zk_request_duration_seconds_bucket{op="get",le="+Inf"} 3`)
+	assert.Contains(t, out, `zoofuse_zk_request_duration_seconds_count{op="get"} 3`)
+	assert.NotContains(t, out, `op="set"`)
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, out, rec.Body.String())
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// modeOverlay holds the permission bits set by chmod, keyed by path. Zookeeper has no notion of Unix permissions, so
+// the modes live in memory only and are lost when the filesystem is unmounted. The zero value is ready for use.
+type modeOverlay struct {
+	sync.Mutex
+	modes map[string]uint32
+}
+
+func (m *modeOverlay) set(path string, mode uint32) {
+	m.Lock()
+	defer m.Unlock()
+	if m.modes == nil {
+		m.modes = make(map[string]uint32)
+	}
+	m.modes[path] = mode & 0777
+}
+
+func (m *modeOverlay) get(path string) (uint32, bool) {
+	m.Lock()
+	defer m.Unlock()
+	mode, ok := m.modes[path]
+	return mode, ok
+}
+
+func (m *modeOverlay) clear(path string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.modes, path)
+}
+
+// apply replaces the permission bits of `mode` with those set by chmod on `path`, if any.
+func (m *modeOverlay) apply(path string, mode uint32) uint32 {
+	if perm, ok := m.get(path); ok {
+		return mode&^0777 | perm
+	}
+	return mode
+}
+
+// Chmod records the permission bits of a znode, reflected by GetAttr from then on. The mode is not stored in
+// Zookeeper, see modeOverlay.
+func (f *FuseFS) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
+	ctx := traceRequest(context, "Chmod", name)
+	if !f.IsReadWrite || f.isVirtual(name) {
+		return fuse.EROFS
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	if strings.HasSuffix(name, ZNodeMarker) {
+		return fuse.EACCES
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+	name = f.unbucket(name)
+
+	found, _, err := f.zh.Exists(ctx, name)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": name,
+			"err":  err,
+		}).Error("unable to check znode for chmod")
+		f.errors.record("Chmod", name, err)
+		return zkErrToStatus(err)
+	}
+	if !found {
+		return fuse.ENOENT
+	}
+	f.modes.set(name, mode)
+	return fuse.OK
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestChmod verifies a chmod is reflected by GetAttr, and forgotten once the znode is unlinked.
+func TestChmod(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app/script").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "app/dir").Return(true, &zk.Stat{NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Exists", "app/missing").Return(false, (*zk.Stat)(nil), nil)
+	mockZooKeeper.zk.On("Delete", "app/script").Return(nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+
+	assert.Equal(t, fuse.OK, fs.Chmod("app/script", 0755, nil))
+	attr, status := fs.GetAttr("app/script", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.S_IFREG|uint32(0755), attr.Mode)
+
+	assert.Equal(t, fuse.OK, fs.Chmod("app/dir", 0700, nil))
+	attr, _ = fs.GetAttr("app/dir", nil)
+	assert.Equal(t, fuse.S_IFDIR|uint32(0700), attr.Mode)
+
+	assert.Equal(t, fuse.ENOENT, fs.Chmod("app/missing", 0755, nil))
+
+	assert.Equal(t, fuse.OK, fs.Unlink("app/script", nil))
+	attr, _ = fs.GetAttr("app/script", nil)
+	assert.Equal(t, fuse.S_IFREG|IfRegRW, attr.Mode)
+}
+
+// TestChmodReadOnly verifies chmod is refused on read-only mounts and virtual files.
+func TestChmodReadOnly(t *testing.T) {
+	fs := &FuseFS{zh: &MockZooHandle{zk: mock.Mock{}}}
+	assert.Equal(t, fuse.EROFS, fs.Chmod("app/script", 0755, nil))
+
+	fs.IsReadWrite = true
+	assert.Equal(t, fuse.EROFS, fs.Chmod(ControlDir+"/config", 0755, nil))
+	assert.Equal(t, fuse.EACCES, fs.Chmod("app/"+ZNodeMarker, 0755, nil))
+}
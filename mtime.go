@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// timeOverlay holds the access and modification times set by Utimens, keyed by path. Without an MtimeStore both are
+// kept in memory only, like the modeOverlay, and are lost when the filesystem is unmounted. The zero value is ready
+// for use.
+type timeOverlay struct {
+	sync.Mutex
+	times map[string]fileTimes
+}
+
+// fileTimes holds the times set on a path, in seconds, zero when not set.
+type fileTimes struct {
+	atime uint64
+	mtime uint64
+}
+
+// set records the times of `path`, a nil time leaves the one recorded before untouched.
+func (o *timeOverlay) set(path string, atime, mtime *time.Time) {
+	o.Lock()
+	defer o.Unlock()
+	if o.times == nil {
+		o.times = make(map[string]fileTimes)
+	}
+	times := o.times[path]
+	if atime != nil {
+		times.atime = uint64(atime.Unix())
+	}
+	if mtime != nil {
+		times.mtime = uint64(mtime.Unix())
+	}
+	o.times[path] = times
+}
+
+func (o *timeOverlay) clear(path string) {
+	o.Lock()
+	defer o.Unlock()
+	delete(o.times, path)
+}
+
+// apply replaces the times of `attr` with those set on `path`, if any.
+func (o *timeOverlay) apply(path string, attr *fuse.Attr) {
+	o.Lock()
+	defer o.Unlock()
+	times := o.times[path]
+	if times.atime != 0 {
+		attr.Atime = times.atime
+	}
+	if times.mtime != 0 {
+		attr.Mtime = times.mtime
+	}
+}
+
+// mtimeKey returns the path of the znode within the MtimeStore holding the modification time of `path`. The store
+// is flat, the path is escaped into a single znode name.
+func (f *FuseFS) mtimeKey(path string) string {
+	return filepath.Join(f.MtimeStore, url.PathEscape(path))
+}
+
+// storedMtime returns the modification time stored for `path` by Utimens, in seconds, if any.
+func (f *FuseFS) storedMtime(ctx context.Context, path string) (uint64, bool) {
+	if f.MtimeStore == "" || strings.HasSuffix(path, ZNodeMarker) {
+		return 0, false
+	}
+	data, _, err := f.zh.Get(ctx, f.mtimeKey(path))
+	if err != nil {
+		if err != zk.ErrNoNode {
+			log.WithFields(log.Fields{
+				"path": path,
+				"err":  err,
+			}).Warn("unable to fetch stored mtime, using the znode mtime")
+		}
+		return 0, false
+	}
+	mtime, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return mtime, true
+}
+
+// storeMtime records the modification time of `path` within the MtimeStore, creating the store on first use.
+func (f *FuseFS) storeMtime(ctx context.Context, path string, mtime time.Time) error {
+	key := f.mtimeKey(path)
+	data := []byte(strconv.FormatInt(mtime.Unix(), 10))
+
+	_, err := f.zh.Set(ctx, key, data, -1)
+	if err != zk.ErrNoNode {
+		return err
+	}
+	_, err = f.zh.Create(ctx, key, data, 0, zk.WorldACL(zk.PermAll))
+	if err == zk.ErrNoNode {
+		if _, err = f.zh.Create(ctx, f.MtimeStore, nil, 0, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+		_, err = f.zh.Create(ctx, key, data, 0, zk.WorldACL(zk.PermAll))
+	}
+	return err
+}
+
+// clearMtime forgets the modification time stored for a removed `path`, on a best effort basis.
+func (f *FuseFS) clearMtime(ctx context.Context, path string) {
+	if f.MtimeStore == "" {
+		return
+	}
+	if err := f.zh.Delete(ctx, f.mtimeKey(path), -1); err != nil && err != zk.ErrNoNode {
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Warn("unable to remove stored mtime")
+	}
+}
+
+// hideMtimeStore removes the MtimeStore from the `children` of the znode at `path`.
+func (f *FuseFS) hideMtimeStore(path string, children []string) []string {
+	if f.MtimeStore == "" || parentPath(f.MtimeStore) != path {
+		return children
+	}
+	visible := children[:0:0]
+	for _, child := range children {
+		if child != filepath.Base(f.MtimeStore) {
+			visible = append(visible, child)
+		}
+	}
+	return visible
+}
+
+// Utimens sets the access and modification times of a znode, as `touch` does. ZK controls the mtime of a znode, so
+// the times are held in the timeOverlay, the modification time being kept in the MtimeStore instead when one is
+// configured. A nil time is left unchanged, go-fuse resolves the times set to "now" before the call.
+func (f *FuseFS) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) (code fuse.Status) {
+	ctx := traceRequest(context, "Utimens", name)
+	if (Atime == nil && Mtime == nil) || !f.IsReadWrite || f.isVirtual(name) || strings.HasSuffix(name, ZNodeMarker) {
+		return fuse.OK
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+	if target, ok := f.base64Target(name); ok {
+		name = target
+	}
+	name = f.unbucket(name)
+
+	found, _, err := f.zh.Exists(ctx, name)
+	if err != nil {
+		return zkErrToStatus(err)
+	}
+	if !found {
+		return fuse.ENOENT
+	}
+	if f.MtimeStore == "" {
+		f.times.set(name, Atime, Mtime)
+		return fuse.OK
+	}
+	f.times.set(name, Atime, nil)
+	if Mtime == nil {
+		return fuse.OK
+	}
+	if err := f.storeMtime(ctx, name, *Mtime); err != nil {
+		log.WithFields(log.Fields{
+			"path": name,
+			"err":  err,
+		}).Error("unable to store mtime")
+		f.errors.record("Utimens", name, err)
+		return zkErrToStatus(err)
+	}
+	return fuse.OK
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestUtimensStore verifies a touched mtime is stored, creating the store on first use, and reported by GetAttr.
+func TestUtimensStore(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	touched := time.Unix(1500000000, 0)
+	data := []byte("1500000000")
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{Mtime: 1600000000000}, nil)
+	mockZooKeeper.zk.On("Set", ".mtime/app%2Fconfig", data, int32(-1)).Return((*zk.Stat)(nil), zk.ErrNoNode)
+	mockZooKeeper.zk.On("Create", ".mtime/app%2Fconfig", data, int32(0), zk.WorldACL(zk.PermAll)).Return("", zk.ErrNoNode).Once()
+	mockZooKeeper.zk.On("Create", ".mtime", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/.mtime", nil)
+	mockZooKeeper.zk.On("Create", ".mtime/app%2Fconfig", data, int32(0), zk.WorldACL(zk.PermAll)).Return("/.mtime/app%2Fconfig", nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, MtimeStore: ".mtime"}
+	assert.Equal(t, fuse.OK, fs.Utimens("app/config", nil, &touched, nil))
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Create", 3)
+
+	mockZooKeeper.zk.On("Get", ".mtime/app%2Fconfig").Return(data, &zk.Stat{}, nil)
+	attr, status := fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint64(1500000000), attr.Mtime)
+}
+
+// TestUtimensOverlay verifies the times touched without a store are held in memory and reported by GetAttr in place
+// of the znode times, a nil time leaving the one set before untouched.
+func TestUtimensOverlay(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	touched := time.Unix(1500000000, 0)
+	accessed := time.Unix(1400000000, 0)
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{Mtime: 1600000000000}, nil)
+	mockZooKeeper.zk.On("Exists", "app/other").Return(true, &zk.Stat{Mtime: 1600000000000}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, AtimeMode: AtimeMtime}
+	assert.Equal(t, fuse.OK, fs.Utimens("app/config", nil, &touched, nil))
+	attr, status := fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint64(1500000000), attr.Mtime)
+	assert.Equal(t, uint64(1600000000), attr.Atime)
+
+	assert.Equal(t, fuse.OK, fs.Utimens("app/config", &accessed, nil, nil))
+	attr, _ = fs.GetAttr("app/config", nil)
+	assert.Equal(t, uint64(1500000000), attr.Mtime)
+	assert.Equal(t, uint64(1400000000), attr.Atime)
+
+	// untouched znodes report their own times.
+	attr, _ = fs.GetAttr("app/other", nil)
+	assert.Equal(t, uint64(1600000000), attr.Mtime)
+	mockZooKeeper.zk.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+	mockZooKeeper.zk.AssertNotCalled(t, "Get", mock.Anything)
+}
+
+func TestHideMtimeStore(t *testing.T) {
+	fs := &FuseFS{MtimeStore: ".mtime"}
+	assert.Equal(t, []string{"app"}, fs.hideMtimeStore("", []string{".mtime", "app"}))
+	assert.Equal(t, []string{".mtime"}, fs.hideMtimeStore("app", []string{".mtime"}))
+}
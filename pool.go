@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxReconnectBackoff is the default longest delay between attempts to replace an expired session.
+	MaxReconnectBackoff = 30 * time.Second
+
+	// reconnectBackoff is the delay following the first failed attempt to replace an expired session, doubled with
+	// each further failure.
+	reconnectBackoff = 250 * time.Millisecond
+)
+
+// sharedConn is a connection to an ensemble, shared by every ZooHandle connecting to the same servers with the same
+// credentials. Each ZooHandle applies its own chroot, so mounts of different subtrees share one session. Once the
+// session expires the connection is replaced by a new one, swapped in under the lock.
+type sharedConn struct {
+	sync.RWMutex
+	conn       zkConn
+	key        string
+	servers    []string
+	auth       []string
+	timeout    time.Duration
+	tls        *tls.Config
+	refs       int
+	maxBackoff time.Duration
+	session    chan struct{} // closed once a session has been established
+	closed     chan struct{} // closed once the connection is gone for good
+	done       chan struct{} // closed once released by the last ZooHandle, ending reconnect attempts
+}
+
+// connPool hands out sharedConns, limiting the connections a process holds to one per ensemble (and credentials and
+// session timeout).
+// The zero value is ready for use.
+type connPool struct {
+	sync.Mutex
+	conns      map[string]*sharedConn
+	maxBackoff time.Duration // longest delay between reconnect attempts, MaxReconnectBackoff when zero
+	tls        *tls.Config   // TLS configuration of the connections, plain TCP when nil
+}
+
+// connections is the pool shared by every ZooHandle of the process.
+var connections connPool
+
+// poolKey identifies the connections which may be shared, the order of the servers is irrelevant.
+func poolKey(servers, auth []string, timeout time.Duration) string {
+	sorted := append([]string{}, servers...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",") + "|" + strings.Join(auth, ",") + "|" + timeout.String()
+}
+
+// acquire returns the connection to `servers` authenticated with `auth`, requesting sessions of `timeout`,
+// connecting when none is held yet. Each acquire is paired with a release.
+func (p *connPool) acquire(servers, auth []string, timeout time.Duration) (*sharedConn, error) {
+	key := poolKey(servers, auth, timeout)
+	p.Lock()
+	defer p.Unlock()
+	if shared, ok := p.conns[key]; ok {
+		shared.refs++
+		return shared, nil
+	}
+
+	c, events, err := dial(servers, auth, timeout, p.tls)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := &sharedConn{
+		conn:       c,
+		key:        key,
+		servers:    servers,
+		auth:       auth,
+		timeout:    timeout,
+		tls:        p.tls,
+		refs:       1,
+		maxBackoff: p.maxBackoff,
+		session:    make(chan struct{}),
+		closed:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if shared.maxBackoff <= 0 {
+		shared.maxBackoff = MaxReconnectBackoff
+	}
+	go shared.track(events)
+	if p.conns == nil {
+		p.conns = make(map[string]*sharedConn)
+	}
+	p.conns[key] = shared
+	return shared, nil
+}
+
+// release hands back a connection, closing it once no ZooHandle uses it anymore.
+func (p *connPool) release(shared *sharedConn) {
+	p.Lock()
+	defer p.Unlock()
+	if shared.refs--; shared.refs > 0 {
+		return
+	}
+	delete(p.conns, shared.key)
+
+	shared.Lock()
+	defer shared.Unlock()
+	close(shared.done)
+	shared.conn.Close()
+}
+
+// dial connects to `servers`, authenticating the session with each of the `auth` credentials.
+func dial(servers, auth []string, timeout time.Duration, tlsConfig *tls.Config) (zkConn, <-chan zk.Event, error) {
+	c, events, err := zkConnect(servers, timeout, tlsConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, cred := range auth {
+		if err := c.AddAuth("digest", []byte(cred)); err != nil {
+			c.Close()
+			return nil, nil, fmt.Errorf("unable to authenticate as %s: %v", authUser(cred), err)
+		}
+	}
+	return c, events, nil
+}
+
+// current returns the connection requests are sent over.
+func (s *sharedConn) current() zkConn {
+	s.RLock()
+	defer s.RUnlock()
+	return s.conn
+}
+
+// track follows the session events of the connection, so any number of ZooHandles may wait for the session. An
+// expired session is replaced by a new connection. A mere disconnect is left to the client, which resumes the
+// session (along with its ephemeral znodes and watches) once a server is reachable again.
+func (s *sharedConn) track(events <-chan zk.Event) {
+	defer close(s.closed)
+	established := false
+	for {
+		event, ok := <-events
+		if !ok {
+			return
+		}
+		switch event.State {
+		case zk.StateHasSession:
+			if !established {
+				established = true
+				close(s.session)
+			}
+		case zk.StateExpired:
+			log.WithFields(log.Fields{
+				"servers": s.servers,
+			}).Warn("Zookeeper session expired, reconnecting")
+			if events = s.reconnect(); events == nil {
+				return
+			}
+		}
+	}
+}
+
+// reconnect establishes a new connection, retrying with an exponential backoff capped at maxBackoff, and swaps it in
+// for the expired one. The events of the new connection are returned, or nil once the connection was released.
+func (s *sharedConn) reconnect() <-chan zk.Event {
+	backoff := reconnectBackoff
+	for {
+		c, events, err := dial(s.servers, s.auth, s.timeout, s.tls)
+		if err == nil {
+			s.Lock()
+			defer s.Unlock()
+			select {
+			case <-s.done:
+				c.Close()
+				return nil
+			default:
+			}
+			s.conn.Close()
+			s.conn = c
+			log.WithFields(log.Fields{
+				"servers": s.servers,
+			}).Info("replaced expired Zookeeper session")
+			return events
+		}
+
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+		log.WithFields(log.Fields{
+			"servers": s.servers,
+			"err":     err,
+			"retry":   backoff,
+		}).Warn("unable to reconnect to Zookeeper")
+		select {
+		case <-s.done:
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
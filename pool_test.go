@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestConnPoolShared verifies two mounts of the same ensemble share one connection, each with its own chroot, and
+// the connection is closed along with the last of them.
+func TestConnPoolShared(t *testing.T) {
+	conn := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	conn.zk.On("Close").Return()
+	conn.zk.On("Exists", "/app-a").Return(true, &zk.Stat{}, nil)
+	conn.zk.On("Exists", "/app-b").Return(true, &zk.Stat{}, nil)
+	events := make(chan zk.Event, 1)
+	connects := 0
+	orig := zkConnect
+	zkConnect = func(servers []string, timeout time.Duration, tlsConfig *tls.Config) (zkConn, <-chan zk.Event, error) {
+		connects++
+		return conn, events, nil
+	}
+	defer func() { zkConnect = orig }()
+
+	a, err := NewZooHandler([]string{"zk1:2181", "zk2:2181"}, "/app-a", "/mnt/a", nil, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	b, err := NewZooHandler([]string{"zk2:2181", "zk1:2181"}, "/app-b", "/mnt/b", nil, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, connects)
+	assert.Equal(t, a.zk, b.zk)
+	assert.Equal(t, "/app-a/config", a.ZKPath("config"))
+	assert.Equal(t, "/app-b/config", b.ZKPath("config"))
+
+	// both handles observe the single session.
+	events <- zk.Event{State: zk.StateHasSession}
+	assert.Nil(t, a.WaitForSession())
+	assert.Nil(t, b.WaitForSession())
+
+	a.Close()
+	conn.zk.AssertNotCalled(t, "Close")
+	b.Close()
+	conn.zk.AssertNumberOfCalls(t, "Close", 1)
+
+	// once closed, the next mount connects afresh.
+	c, err := NewZooHandler([]string{"zk1:2181", "zk2:2181"}, "/", "/mnt/c", nil, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, connects)
+	c.Close()
+}
+
+// TestConnPoolCredentials verifies sessions authenticated with different credentials are not shared.
+func TestConnPoolCredentials(t *testing.T) {
+	conn := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	conn.zk.On("AddAuth", "digest", mock.Anything).Return(nil)
+	conn.zk.On("Close").Return()
+	connects := 0
+	orig := zkConnect
+	zkConnect = func(servers []string, timeout time.Duration, tlsConfig *tls.Config) (zkConn, <-chan zk.Event, error) {
+		connects++
+		return conn, make(chan zk.Event), nil
+	}
+	defer func() { zkConnect = orig }()
+
+	a, err := NewZooHandler([]string{"zk1:2181"}, "/", "/mnt/a", []string{"alice:secret"}, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	b, err := NewZooHandler([]string{"zk1:2181"}, "/", "/mnt/b", []string{"bob:hunter2"}, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, connects)
+	a.Close()
+	b.Close()
+}
+
+// TestConnPoolReconnect verifies an expired session is replaced by a new connection, retrying with backoff until
+// the ensemble accepts it, and that subsequent calls go through the new connection.
+func TestConnPoolReconnect(t *testing.T) {
+	ctx := context.Background()
+	expired := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	expired.zk.On("Close").Return()
+	expired.zk.On("Exists", "/app").Return(true, &zk.Stat{}, nil)
+	replacement := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	replacement.zk.On("Close").Return()
+	replacement.zk.On("Get", "/app/config").Return([]byte("new"), &zk.Stat{}, nil)
+
+	events := make(chan zk.Event, 1)
+	connects := 0
+	orig, origBackoff := zkConnect, connections.maxBackoff
+	zkConnect = func(servers []string, timeout time.Duration, tlsConfig *tls.Config) (zkConn, <-chan zk.Event, error) {
+		connects++
+		switch connects {
+		case 1:
+			return expired, events, nil
+		case 2:
+			return nil, nil, zk.ErrNoServer
+		}
+		return replacement, make(chan zk.Event), nil
+	}
+	connections.maxBackoff = time.Millisecond
+	defer func() { zkConnect, connections.maxBackoff = orig, origBackoff }()
+
+	zh, err := NewZooHandler([]string{"zk1:2181"}, "/app", "/mnt/app", nil, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	events <- zk.Event{State: zk.StateHasSession}
+	assert.Nil(t, zh.WaitForSession())
+
+	events <- zk.Event{State: zk.StateExpired}
+	for deadline := time.Now().Add(time.Second); zh.shared.current() != replacement; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("expired session was not replaced")
+		}
+	}
+	assert.Equal(t, 3, connects)
+	expired.zk.AssertNumberOfCalls(t, "Close", 1)
+
+	data, _, err := zh.Get(ctx, "config")
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(data))
+	expired.zk.AssertNotCalled(t, "Get", mock.Anything)
+
+	zh.Close()
+	replacement.zk.AssertNumberOfCalls(t, "Close", 1)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// XAttrTruncated is the extended attribute reporting whether reads of a znode are cut short by the `readcap` flag,
+// `1` when its data exceeds the cap and `0` otherwise. It is only present when a cap is set.
+const XAttrTruncated = "user.zk.truncated"
+
+// capRead cuts the `data` read from the znode at `path` to ReadCap bytes, reporting whether it was cut.
+func (f *FuseFS) capRead(path string, data []byte) ([]byte, bool) {
+	if f.ReadCap <= 0 || len(data) <= f.ReadCap {
+		return data, false
+	}
+	log.WithFields(log.Fields{
+		"path": path,
+		"size": len(data),
+		"cap":  f.ReadCap,
+	}).Warn("znode data exceeds the read cap, presenting it truncated")
+	return data[:f.ReadCap], true
+}
+
+// capSize returns the file size reported for a znode holding `size` bytes of data.
+func (f *FuseFS) capSize(size uint64) uint64 {
+	if f.ReadCap > 0 && size > uint64(f.ReadCap) {
+		return uint64(f.ReadCap)
+	}
+	return size
+}
+
+// getTruncatedAttr reports whether the data of the znode at `path` exceeds the ReadCap.
+func (f *FuseFS) getTruncatedAttr(ctx context.Context, path string) ([]byte, error) {
+	found, stat, err := f.zh.Exists(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, zk.ErrNoNode
+	}
+	if int(stat.DataLength) > f.ReadCap {
+		return []byte("1"), nil
+	}
+	return []byte("0"), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestReadCap verifies reads of a znode holding more data than the cap are truncated and flagged by the
+// user.zk.truncated xattr, and that such a znode may not be opened for write.
+func TestReadCap(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/large").Return([]byte("0123456789"), &zk.Stat{DataLength: 10}, nil)
+	mockZooKeeper.zk.On("Exists", "app/large").Return(true, &zk.Stat{DataLength: 10}, nil)
+	mockZooKeeper.zk.On("Get", "app/small").Return([]byte("0123"), &zk.Stat{DataLength: 4}, nil)
+	mockZooKeeper.zk.On("Exists", "app/small").Return(true, &zk.Stat{DataLength: 4}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, ReadCap: 4}
+	file, status := fs.Open("app/large", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, 16)
+	res, _ := file.Read(buf, 0)
+	data, _ := res.Bytes(buf)
+	assert.Equal(t, []byte("0123"), data)
+
+	attr, _ := fs.GetAttr("app/large", nil)
+	assert.Equal(t, uint64(4), attr.Size)
+	value, status := fs.GetXAttr("app/large", XAttrTruncated, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "1", string(value))
+
+	_, status = fs.Open("app/large", fuse.O_ANYWRITE, nil)
+	assert.Equal(t, fuse.Status(syscall.EFBIG), status)
+
+	// znodes within the cap are left whole.
+	value, _ = fs.GetXAttr("app/small", XAttrTruncated, nil)
+	assert.Equal(t, "0", string(value))
+	_, status = fs.Open("app/small", fuse.O_ANYWRITE, nil)
+	assert.Equal(t, fuse.OK, status)
+
+	// the attribute is only present with a cap.
+	fs = &FuseFS{zh: mockZooKeeper}
+	_, status = fs.GetXAttr("app/large", XAttrTruncated, nil)
+	assert.Equal(t, fuse.ENOATTR, status)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrReadOnlyMount is returned by a ReadOnlyZooHandler for every call modifying the tree.
+var ErrReadOnlyMount = errors.New("mount is read-only")
+
+// ReadOnlyZooHandler is a Zoohandler refusing every call modifying the tree with ErrReadOnlyMount, before it reaches
+// the ensemble. It wraps the connection of read-only mounts, guaranteeing no mutation gets through whatever the
+// checks made by the filesystem handlers. Each refused call is logged.
+type ReadOnlyZooHandler struct {
+	wrappedZooHandler
+}
+
+// NewReadOnlyZooHandler wraps `zh`, refusing the calls modifying the tree.
+func NewReadOnlyZooHandler(zh Zoohandler) *ReadOnlyZooHandler {
+	return &ReadOnlyZooHandler{wrappedZooHandler{zh}}
+}
+
+// refuse logs the attempted mutation `op` of `path`.
+func (r *ReadOnlyZooHandler) refuse(op, path string) error {
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+	}).Warn("refused a znode modification on a read-only mount")
+	return ErrReadOnlyMount
+}
+
+// Create implements Zoohandler.Create, refused on a read-only mount.
+func (r *ReadOnlyZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	return "", r.refuse("Create", path)
+}
+
+// Delete implements Zoohandler.Delete, refused on a read-only mount.
+func (r *ReadOnlyZooHandler) Delete(ctx context.Context, path string, version int32) error {
+	return r.refuse("Delete", path)
+}
+
+// Set implements Zoohandler.Set, refused on a read-only mount.
+func (r *ReadOnlyZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	return nil, r.refuse("Set", path)
+}
+
+// SetACL implements Zoohandler.SetACL, refused on a read-only mount.
+func (r *ReadOnlyZooHandler) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	return nil, r.refuse("SetACL", path)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestReadOnlyZooHandler verifies each call modifying the tree is refused by the wrapper without reaching the
+// wrapped Zoohandler, while reads are forwarded.
+func TestReadOnlyZooHandler(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Children", "app").Return([]string{"config"}, &zk.Stat{}, nil)
+
+	ctx := context.Background()
+	zh := NewReadOnlyZooHandler(mockZooKeeper)
+	_, err := zh.Create(ctx, "app/new", []byte("data"), 0, zk.WorldACL(zk.PermAll))
+	assert.Equal(t, ErrReadOnlyMount, err)
+	assert.Equal(t, ErrReadOnlyMount, zh.Delete(ctx, "app/config", -1))
+	_, err = zh.Set(ctx, "app/config", []byte("fresh"), -1)
+	assert.Equal(t, ErrReadOnlyMount, err)
+	_, err = zh.SetACL(ctx, "app/config", zk.WorldACL(zk.PermRead), -1)
+	assert.Equal(t, ErrReadOnlyMount, err)
+
+	data, _, err := zh.Get(ctx, "app/config")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+	children, _, err := zh.Children(ctx, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"config"}, children)
+
+	for _, method := range []string{"Create", "Delete", "Set", "SetACL"} {
+		mockZooKeeper.zk.AssertNotCalled(t, method)
+	}
+	assert.True(t, zh.Ready())
+}
+
+// TestReadOnlyMutations verifies the operations changing the tree are refused with EROFS on a read-only mount,
+// ahead of any Zookeeper call.
+func TestReadOnlyMutations(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	fs := &FuseFS{zh: NewReadOnlyZooHandler(mockZooKeeper)}
+
+	_, status := fs.Create("app/new", 0, 0644, nil)
+	assert.Equal(t, fuse.EROFS, status)
+	assert.Equal(t, fuse.EROFS, fs.Mkdir("app/dir", 0755, nil))
+	assert.Equal(t, fuse.EROFS, fs.Unlink("app/config", nil))
+	assert.Equal(t, fuse.EROFS, fs.Rmdir("app", nil))
+	_, status = fs.Open("app/config", syscall.O_WRONLY, nil)
+	assert.Equal(t, fuse.EROFS, status)
+	assert.Equal(t, fuse.EROFS, fs.Truncate("app/config", 0, nil))
+	assert.Empty(t, mockZooKeeper.zk.Calls)
+}
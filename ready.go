@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// readyMessage is written to signal the mount is serving, a single newline as expected by supervisors such as s6.
+var readyMessage = []byte("\n")
+
+// readySignal returns the function signalling a supervisor that the mount is serving: a newline written to the
+// inherited file descriptor `fd` (closed afterwards, 0 when disabled) and/or the file at `path` (empty when disabled).
+// Nil is returned when neither is configured.
+func readySignal(fd int, path string) func() error {
+	if fd <= 0 && path == "" {
+		return nil
+	}
+	return func() error {
+		if fd > 0 {
+			out := os.NewFile(uintptr(fd), "readyfd")
+			_, err := out.Write(readyMessage)
+			out.Close()
+			if err != nil {
+				return fmt.Errorf("unable to write to readyfd %d: %v", fd, err)
+			}
+		}
+		if path != "" {
+			if err := ioutil.WriteFile(path, readyMessage, 0644); err != nil {
+				return fmt.Errorf("unable to write readyfile: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// signalServing calls OnServing once `waitMount` reports the kernel completed the mount and requests are served.
+func (f *FuseFS) signalServing(waitMount func() error) {
+	if err := waitMount(); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("mount did not become ready, not signalling readiness")
+		return
+	}
+	if err := f.OnServing(); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("failed to signal readiness")
+		return
+	}
+	log.WithFields(log.Fields{
+		"mountpoint": f.FuseRoot,
+	}).Info("mount is serving, readiness signalled")
+}
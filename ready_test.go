@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReadySignal verifies readiness is signalled on the file descriptor and the file configured.
+func TestReadySignal(t *testing.T) {
+	assert.Nil(t, readySignal(0, ""))
+
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	defer r.Close()
+	dir, err := ioutil.TempDir("", "zoofuse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ready")
+
+	// the signal closes the descriptor it is handed, hand it a copy of the write end.
+	fd, err := syscall.Dup(int(w.Fd()))
+	assert.Nil(t, err)
+	w.Close()
+
+	assert.Nil(t, readySignal(fd, path)())
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "\n", string(data))
+	data, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "\n", string(data))
+}
+
+// TestSignalServing verifies readiness is only signalled once the mount is established, and not at all when the
+// mount fails.
+func TestSignalServing(t *testing.T) {
+	signalled := make(chan struct{}, 1)
+	fs := &FuseFS{OnServing: func() error {
+		signalled <- struct{}{}
+		return nil
+	}}
+
+	mounted := make(chan error)
+	done := make(chan struct{})
+	go func() {
+		fs.signalServing(func() error { return <-mounted })
+		close(done)
+	}()
+	select {
+	case <-signalled:
+		t.Fatal("readiness signalled before the mount was established")
+	default:
+	}
+	mounted <- nil
+	<-done
+	assert.Len(t, signalled, 1)
+
+	<-signalled
+	go func() { mounted <- os.ErrNotExist }()
+	fs.signalServing(func() error { return <-mounted })
+	assert.Len(t, signalled, 0)
+}
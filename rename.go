@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// Rename moves a znode, along with its subtree, to a new path. Zookeeper has no native rename, so the subtree is
+// copied (data and ACL) to the destination before the source is deleted. The move is not atomic: other clients may
+// observe both trees while it is in progress. Renaming onto an existing znode fails with EEXIST, renaming a znode
+// into its own subtree with EINVAL, as rename(2) does.
+func (f *FuseFS) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
+	ctx := traceRequest(context, "Rename", oldName)
+	if !f.IsReadWrite {
+		return fuse.EROFS
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	for _, path := range []string{oldName, newName} {
+		if strings.HasSuffix(path, ZNodeMarker) {
+			return fuse.EACCES
+		}
+		if _, ok := f.base64Target(path); ok {
+			return fuse.EACCES
+		}
+		if f.isVirtual(path) {
+			return fuse.EROFS
+		}
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+
+	oldName, newName = f.unbucket(oldName), f.unbucket(newName)
+	// the copy would otherwise recurse into the znodes it creates.
+	if newName == oldName || strings.HasPrefix(newName, oldName+"/") {
+		return fuse.EINVAL
+	}
+	if status := f.checkName(newName); !status.Ok() {
+		return status
+	}
+	if status := f.checkACL(ctx, parentPath(oldName), zk.PermDelete); !status.Ok() {
+		return status
+	}
+	if status := f.checkACL(ctx, parentPath(newName), zk.PermCreate); !status.Ok() {
+		return status
+	}
+
+	found, _, err := f.zh.Exists(ctx, newName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": newName,
+			"err":  err,
+		}).Error("unable to check rename destination")
+		f.errors.record("Rename", newName, err)
+		return zkErrToStatus(err)
+	}
+	if found {
+		return fuse.Status(syscall.EEXIST)
+	}
+
+	// the copy creates a znode per node of the subtree, held to MaxCreates and the size budgets of the destination.
+	var count int64
+	if f.MaxCreates > 0 || len(f.pathRules(&f.SizeBudgets)) > 0 {
+		var size int64
+		if size, count, err = f.subtreeStat(ctx, oldName); err != nil {
+			log.WithFields(log.Fields{
+				"path": oldName,
+				"err":  err,
+			}).Error("unable to measure znode tree to rename")
+			f.errors.record("Rename", oldName, err)
+			return zkErrToStatus(err)
+		}
+		if status := f.checkMoveBudget(ctx, oldName, newName, size); !status.Ok() {
+			return status
+		}
+	}
+	if !f.reserveCreates(count) {
+		return fuse.Status(syscall.ENOSPC)
+	}
+
+	if created, err := f.copyTree(ctx, oldName, newName); err != nil {
+		f.releaseCreates(count)
+		log.WithFields(log.Fields{
+			"from": oldName,
+			"to":   newName,
+			"err":  err,
+		}).Error("unable to copy znode tree")
+		f.errors.record("Rename", oldName, err)
+		// a destination created by another client since it was checked is not ours to remove.
+		if !created {
+			return zkErrToStatus(err)
+		}
+		// the partial copy is removed, leaving the source as it was.
+		if cleanupErr := f.deleteTree(ctx, newName); cleanupErr != nil && cleanupErr != zk.ErrNoNode {
+			log.WithFields(log.Fields{
+				"path": newName,
+				"err":  cleanupErr,
+			}).Warn("unable to remove partially copied znode tree")
+		}
+		return zkErrToStatus(err)
+	}
+
+	if err := f.deleteTree(ctx, oldName); err != nil {
+		log.WithFields(log.Fields{
+			"path": oldName,
+			"err":  err,
+		}).Error("unable to delete renamed znode tree")
+		f.errors.record("Rename", oldName, err)
+		return zkErrToStatus(err)
+	}
+	f.modes.clear(oldName)
+	f.times.clear(oldName)
+	f.clearMtime(ctx, oldName)
+	return fuse.OK
+}
+
+// copyTree copies the data and ACL of the znode at `from`, and of all of its descendants, to `to`. It reports whether
+// the znode `to` was created, even when the copy of the subtree failed afterwards.
+func (f *FuseFS) copyTree(ctx context.Context, from, to string) (bool, error) {
+	data, _, err := f.zh.Get(ctx, from)
+	if err != nil {
+		return false, err
+	}
+	acl, _, err := f.zh.GetACL(ctx, from)
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.zh.Create(ctx, to, data, int32(0), acl); err != nil {
+		return false, err
+	}
+
+	children, _, err := f.zh.Children(ctx, from)
+	if err != nil {
+		return true, err
+	}
+	for _, child := range children {
+		if _, err := f.copyTree(ctx, filepath.Join(from, child), filepath.Join(to, child)); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// deleteTree deletes the znode at `path` along with all of its descendants, deepest first.
+func (f *FuseFS) deleteTree(ctx context.Context, path string) error {
+	children, _, err := f.zh.Children(ctx, path)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := f.deleteTree(ctx, filepath.Join(path, child)); err != nil {
+			return err
+		}
+	}
+	return f.zh.Delete(ctx, path, -1)
+}
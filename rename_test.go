@@ -0,0 +1,150 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestRenameLeaf verifies a leaf znode is copied, along with its ACL, before the source is deleted.
+func TestRenameLeaf(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	acl := zk.DigestACL(zk.PermAll, "user", "secret")
+	mockZooKeeper.zk.On("Exists", "app/new").Return(false, (*zk.Stat)(nil), nil)
+	mockZooKeeper.zk.On("Get", "app/old").Return([]byte("data"), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("GetACL", "app/old").Return(acl, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Create", "app/new", []byte("data"), int32(0), acl).Return("/app/new", nil)
+	mockZooKeeper.zk.On("Children", "app/old").Return([]string{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Delete", "app/old").Return(nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.OK, fs.Rename("app/old", "app/new", nil))
+	mockZooKeeper.zk.AssertCalled(t, "Create", "app/new", []byte("data"), int32(0), acl)
+	mockZooKeeper.zk.AssertCalled(t, "Delete", "app/old")
+}
+
+// TestRenameSubtree verifies a two level subtree is copied in full, and deleted deepest first.
+func TestRenameSubtree(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	acl := zk.WorldACL(zk.PermAll)
+	mockZooKeeper.zk.On("Exists", "moved").Return(false, (*zk.Stat)(nil), nil)
+	tree := map[string][]string{
+		"app":        {"a", "b"},
+		"app/a":      {"leaf"},
+		"app/a/leaf": {},
+		"app/b":      {},
+	}
+	for path, children := range tree {
+		mockZooKeeper.zk.On("Get", path).Return([]byte(path), &zk.Stat{}, nil)
+		mockZooKeeper.zk.On("GetACL", path).Return(acl, &zk.Stat{}, nil)
+		mockZooKeeper.zk.On("Children", path).Return(children, &zk.Stat{}, nil)
+	}
+	var deleted []string
+	mockZooKeeper.zk.On("Create", mock.Anything, mock.Anything, int32(0), acl).Return("", nil)
+	mockZooKeeper.zk.On("Delete", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		deleted = append(deleted, args.String(0))
+	})
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.OK, fs.Rename("app", "moved", nil))
+
+	mockZooKeeper.zk.AssertCalled(t, "Create", "moved", []byte("app"), int32(0), acl)
+	mockZooKeeper.zk.AssertCalled(t, "Create", "moved/a", []byte("app/a"), int32(0), acl)
+	mockZooKeeper.zk.AssertCalled(t, "Create", "moved/a/leaf", []byte("app/a/leaf"), int32(0), acl)
+	mockZooKeeper.zk.AssertCalled(t, "Create", "moved/b", []byte("app/b"), int32(0), acl)
+	assert.Equal(t, []string{"app/a/leaf", "app/a", "app/b", "app"}, deleted)
+}
+
+// TestRenameRefused verifies renames onto existing znodes, into their own subtree, of the ZNodeMarker and on read-only
+// mounts are refused.
+func TestRenameRefused(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app/taken").Return(true, &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.Status(syscall.EEXIST), fs.Rename("app/old", "app/taken", nil))
+	assert.Equal(t, fuse.EACCES, fs.Rename("app/"+ZNodeMarker, "app/new", nil))
+	assert.Equal(t, fuse.EACCES, fs.Rename("app/old", "app/"+ZNodeMarker, nil))
+	assert.Equal(t, fuse.EROFS, fs.Rename(ControlDir+"/config", "app/new", nil))
+
+	// a znode cannot be moved into its own subtree.
+	assert.Equal(t, fuse.EINVAL, fs.Rename("app/old", "app/old", nil))
+	assert.Equal(t, fuse.EINVAL, fs.Rename("app", "app/b", nil))
+	assert.Equal(t, fuse.EINVAL, fs.Rename("app", "app/b/c", nil))
+	mockZooKeeper.zk.AssertNotCalled(t, "Exists", "app/b")
+	mockZooKeeper.zk.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	fs.IsReadWrite = false
+	assert.Equal(t, fuse.EROFS, fs.Rename("app/old", "app/new", nil))
+	mockZooKeeper.zk.AssertNotCalled(t, "Get", mock.Anything)
+}
+
+// TestRenameDestinationRaced verifies a destination created by another client after it was checked fails the rename
+// with EEXIST, and is left alone, while a partial copy of the mount's own is removed.
+func TestRenameDestinationRaced(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	acl := zk.WorldACL(zk.PermAll)
+	mockZooKeeper.zk.On("Exists", mock.Anything).Return(false, (*zk.Stat)(nil), nil)
+	mockZooKeeper.zk.On("Get", "app/old").Return([]byte("data"), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("GetACL", "app/old").Return(acl, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Create", "app/taken", []byte("data"), int32(0), acl).Return("", zk.ErrNodeExists)
+	mockZooKeeper.zk.On("Create", "app/new", []byte("data"), int32(0), acl).Return("/app/new", nil)
+	mockZooKeeper.zk.On("Children", "app/old").Return([]string(nil), (*zk.Stat)(nil), zk.ErrConnectionClosed)
+	mockZooKeeper.zk.On("Children", "app/new").Return([]string{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Delete", "app/new").Return(nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.Status(syscall.EEXIST), fs.Rename("app/old", "app/taken", nil))
+	mockZooKeeper.zk.AssertNotCalled(t, "Children", "app/taken")
+	mockZooKeeper.zk.AssertNotCalled(t, "Delete", "app/taken")
+
+	assert.Equal(t, fuse.EIO, fs.Rename("app/old", "app/new", nil))
+	mockZooKeeper.zk.AssertCalled(t, "Delete", "app/new")
+	mockZooKeeper.zk.AssertNotCalled(t, "Delete", "app/old")
+}
+
+// TestRenameLimits verifies a rename is held to the size budget of its destination and to MaxCreates, counting every
+// znode of the copied subtree, while a move within a budgeted subtree leaves its size unchanged.
+func TestRenameLimits(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	acl := zk.WorldACL(zk.PermAll)
+	// app (2 bytes) holds a (3 bytes), quota (4 bytes) holds q (6 bytes).
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{DataLength: 2, NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Children", "app").Return([]string{"a"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "app/a").Return(true, &zk.Stat{DataLength: 3}, nil)
+	mockZooKeeper.zk.On("Exists", "quota").Return(true, &zk.Stat{DataLength: 4, NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Children", "quota").Return([]string{"q"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "quota/q").Return(true, &zk.Stat{DataLength: 6}, nil)
+	mockZooKeeper.zk.On("Exists", mock.Anything).Return(false, (*zk.Stat)(nil), nil)
+	mockZooKeeper.zk.On("Get", "quota/q").Return(make([]byte, 6), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("GetACL", "quota/q").Return(acl, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Create", "quota/r", make([]byte, 6), int32(0), acl).Return("/quota/r", nil)
+	mockZooKeeper.zk.On("Children", "quota/q").Return([]string{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Delete", "quota/q").Return(nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, SizeBudgets: []PathRule{{Pattern: "quota", Value: "12"}}}
+	// 10 + 5 bytes moved in, beyond the budget.
+	assert.Equal(t, fuse.Status(syscall.EDQUOT), fs.Rename("app", "quota/app", nil))
+	// a move within the budgeted subtree.
+	assert.Equal(t, fuse.OK, fs.Rename("quota/q", "quota/r", nil))
+
+	fs = &FuseFS{zh: mockZooKeeper, IsReadWrite: true, MaxCreates: 1}
+	assert.Equal(t, fuse.Status(syscall.ENOSPC), fs.Rename("app", "moved", nil))
+	assert.Zero(t, fs.creates)
+	mockZooKeeper.zk.AssertNotCalled(t, "Create", "quota/app", mock.Anything, mock.Anything, mock.Anything)
+	mockZooKeeper.zk.AssertNotCalled(t, "Create", "moved", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PathRule associates a value with the fuse paths matching a glob pattern (see filepath.Match). Rules are accepted on
+// the command line in the `pattern=value` form.
+type PathRule struct {
+	Pattern string
+	Value   string
+}
+
+// ParsePathRule builds a PathRule from its `pattern=value` form.
+func ParsePathRule(rule string) (PathRule, error) {
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 || cleanPath(parts[0]) == "" {
+		return PathRule{}, fmt.Errorf("invalid rule %q, expected pattern=value", rule)
+	}
+
+	pattern := cleanPath(parts[0])
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return PathRule{}, fmt.Errorf("invalid pattern in rule %q: %v", rule, err)
+	}
+	return PathRule{Pattern: pattern, Value: parts[1]}, nil
+}
+
+// Matches reports whether the fuse path is matched by the rule pattern.
+func (r PathRule) Matches(path string) bool {
+	matched, _ := filepath.Match(r.Pattern, path)
+	return matched
+}
+
+// parseRules parses each of the `values` of a rule flag with `parse`.
+func parseRules(values []string, parse func(string) (PathRule, error)) ([]PathRule, error) {
+	var rules []PathRule
+	for _, value := range values {
+		rule, err := parse(value)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// pathRules returns the `rules` of the mount currently in effect, one of its rule fields, which reloadConfig swaps.
+func (f *FuseFS) pathRules(rules *[]PathRule) []PathRule {
+	f.configMu.RLock()
+	defer f.configMu.RUnlock()
+	return *rules
+}
+
+// matchRule returns the first rule matching `path`.
+func matchRule(rules []PathRule, path string) (PathRule, bool) {
+	for _, rule := range rules {
+		if rule.Matches(path) {
+			return rule, true
+		}
+	}
+	return PathRule{}, false
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePathRule(t *testing.T) {
+	rule, err := ParsePathRule("/app/*=v1:")
+	assert.Nil(t, err)
+	assert.Equal(t, PathRule{Pattern: "app/*", Value: "v1:"}, rule)
+	assert.True(t, rule.Matches("app/config"))
+	assert.False(t, rule.Matches("app/config/nested"))
+	assert.False(t, rule.Matches("other/config"))
+
+	_, err = ParsePathRule("app/config")
+	assert.NotNil(t, err)
+	_, err = ParsePathRule("app/[=v1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// DefaultAttrCacheTTL is the default time znode stats are cached for, matching the attribute timeout of the kernel.
+const DefaultAttrCacheTTL = 1 * time.Second
+
+// StatCachingZooHandler is a Zoohandler caching the stats returned by Exists for a short time, so listing a directory
+// (which stats each child) followed by a GetAttr per entry costs a single round trip per znode. Creates, deletes and
+// updates made through the handler invalidate the stats they affect, changes made by other clients show through
+// once the cached stat expires. Only existing znodes are cached. All other calls are passed through.
+type StatCachingZooHandler struct {
+	wrappedZooHandler
+	sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]statCacheEntry
+}
+
+type statCacheEntry struct {
+	stat    *zk.Stat
+	expires time.Time
+}
+
+// NewStatCachingZooHandler wraps `zh`, caching the stats of existing znodes for `ttl`.
+func NewStatCachingZooHandler(zh Zoohandler, ttl time.Duration) *StatCachingZooHandler {
+	return &StatCachingZooHandler{
+		wrappedZooHandler: wrappedZooHandler{zh},
+		ttl:               ttl,
+		now:               time.Now,
+		entries:           make(map[string]statCacheEntry),
+	}
+}
+
+// SetTTL changes how long the stats cached from here on are kept.
+func (s *StatCachingZooHandler) SetTTL(ttl time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.ttl = ttl
+}
+
+// statKey returns the cache key of a fuse path. The ZNodeMarker is aliased to its parent, as are paths differing only
+// by their separators.
+func statKey(path string) string {
+	return strings.Trim(strings.TrimSuffix(path, ZNodeMarker), "/")
+}
+
+// invalidate drops the cached stats of `path` and of its parent, whose child count changes along with it.
+func (s *StatCachingZooHandler) invalidate(path string) {
+	key := statKey(path)
+	s.Lock()
+	defer s.Unlock()
+	delete(s.entries, key)
+	delete(s.entries, parentPath(key))
+}
+
+// Exists implements Zoohandler.Exists, answering from the cache while the stat of the znode has not expired. Each
+// caller receives its own copy of the stat.
+func (s *StatCachingZooHandler) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	key := statKey(path)
+	s.Lock()
+	entry, ok := s.entries[key]
+	if ok && s.now().After(entry.expires) {
+		delete(s.entries, key)
+		ok = false
+	}
+	s.Unlock()
+	if ok {
+		return true, copyStat(entry.stat), nil
+	}
+
+	found, stat, err := s.Zoohandler.Exists(ctx, path)
+	if err == nil && found && stat != nil {
+		s.Lock()
+		s.entries[key] = statCacheEntry{stat: copyStat(stat), expires: s.now().Add(s.ttl)}
+		s.Unlock()
+	}
+	return found, stat, err
+}
+
+// Create implements Zoohandler.Create, invalidating the stat of the parent.
+func (s *StatCachingZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	defer s.invalidate(path)
+	return s.Zoohandler.Create(ctx, path, data, flags, acl)
+}
+
+// Delete implements Zoohandler.Delete, invalidating the stats of the znode and its parent.
+func (s *StatCachingZooHandler) Delete(ctx context.Context, path string, version int32) error {
+	defer s.invalidate(path)
+	return s.Zoohandler.Delete(ctx, path, version)
+}
+
+// Set implements Zoohandler.Set, invalidating the stat of the znode.
+func (s *StatCachingZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	defer s.invalidate(path)
+	return s.Zoohandler.Set(ctx, path, data, version)
+}
+
+// SetACL implements Zoohandler.SetACL, invalidating the stat (and its ACL version) of the znode.
+func (s *StatCachingZooHandler) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	defer s.invalidate(path)
+	return s.Zoohandler.SetACL(ctx, path, acl, version)
+}
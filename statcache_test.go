@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestStatCache verifies a second GetAttr within the TTL is answered from the cache, and the stat is fetched again
+// once expired.
+func TestStatCache(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{DataLength: 4}, nil)
+
+	cache := NewStatCachingZooHandler(mockZooKeeper, time.Second)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	fs := &FuseFS{zh: cache}
+
+	for i := 0; i < 2; i++ {
+		attr, status := fs.GetAttr("app/config", nil)
+		assert.Equal(t, fuse.OK, status)
+		assert.Equal(t, uint64(4), attr.Size)
+	}
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 1)
+
+	now = now.Add(2 * time.Second)
+	fs.GetAttr("app/config", nil)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 2)
+}
+
+// TestStatCacheInvalidate verifies Unlink purges the cached stats of the znode and of its parent, and nonexistent
+// znodes are not cached.
+func TestStatCacheInvalidate(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{NumChildren: 1}, nil).Once()
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{}, nil).Once()
+	mockZooKeeper.zk.On("Exists", "app/config").Return(false, (*zk.Stat)(nil), nil)
+	mockZooKeeper.zk.On("Delete", "app/config").Return(nil)
+
+	fs := &FuseFS{zh: NewStatCachingZooHandler(mockZooKeeper, time.Minute), IsReadWrite: true}
+	attr, _ := fs.GetAttr("app", nil)
+	assert.True(t, attr.IsDir())
+	_, status := fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+
+	assert.Equal(t, fuse.OK, fs.Unlink("app/config", nil))
+	_, status = fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.ENOENT, status)
+	_, status = fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.ENOENT, status)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Exists", 4)
+
+	// the parent lost its only child.
+	attr, _ = fs.GetAttr("app", nil)
+	assert.True(t, attr.IsRegular())
+}
+
+// TestStatCacheConcurrent verifies the cache is safe under the concurrent lookups of an OpenDir.
+func TestStatCacheConcurrent(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", mock.Anything).Return(true, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(&zk.Stat{}, nil)
+	cache := NewStatCachingZooHandler(mockZooKeeper, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache.Exists(ctx, "app/config")
+			if i%5 == 0 {
+				cache.Set(ctx, "app/config", nil, -1)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
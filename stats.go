@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+)
+
+// Stats holds runtime counters of the mount, exposed through the ControlDir as `stats`. The zero value is ready for
+// use and all fields are updated atomically.
+type Stats struct {
+	LimiterSaturations int64 `json:"opendir_limiter_saturations"` // OpenDir workers that found the concurrency limiter full
+	LimiterWaiting     int64 `json:"opendir_limiter_waiting"`     // OpenDir workers currently waiting on the limiter
+}
+
+// limiterWait records a worker blocked on a saturated OpenDir concurrency limiter, the returned func is called once
+// the worker acquires its slot.
+func (s *Stats) limiterWait() func() {
+	atomic.AddInt64(&s.LimiterSaturations, 1)
+	atomic.AddInt64(&s.LimiterWaiting, 1)
+	return func() {
+		atomic.AddInt64(&s.LimiterWaiting, -1)
+	}
+}
+
+// snapshot returns a consistent copy of the counters.
+func (s *Stats) snapshot() Stats {
+	return Stats{
+		LimiterSaturations: atomic.LoadInt64(&s.LimiterSaturations),
+		LimiterWaiting:     atomic.LoadInt64(&s.LimiterWaiting),
+	}
+}
+
+// renderStats returns the counters of the mount as JSON.
+func (f *FuseFS) renderStats(ctx context.Context) ([]byte, error) {
+	data, err := json.MarshalIndent(f.stats.snapshot(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestOpenDirLimiterSaturation verifies saturation of the OpenDir concurrency limiter is recorded when a directory
+// holds more children than there are workers.
+func TestOpenDirLimiterSaturation(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+
+	extra := 5
+	var children []string
+	for i := 0; i < MaxConcurrentRequests+extra; i++ {
+		children = append(children, fmt.Sprintf("child-%d", i))
+	}
+	mockZooKeeper.zk.On("Children", "dir").Return(children, &zk.Stat{}, nil)
+
+	// hold every worker inside Exists until the waiting workers have been observed.
+	release := make(chan time.Time)
+	mockZooKeeper.zk.On("Exists", mock.Anything).Return(true, &zk.Stat{}, nil).WaitUntil(release)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	done := make(chan struct{})
+	go func() {
+		fs.OpenDir("dir", nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&fs.stats.LimiterWaiting) < int64(extra) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int64(extra), atomic.LoadInt64(&fs.stats.LimiterWaiting))
+	close(release)
+	<-done
+
+	stats := fs.stats.snapshot()
+	assert.Equal(t, int64(extra), stats.LimiterSaturations)
+	assert.Equal(t, int64(0), stats.LimiterWaiting)
+
+	_, status := fs.GetAttr(ControlDir+"/stats", nil)
+	assert.Equal(t, fuse.OK, status)
+}
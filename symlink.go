@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// SymlinkPrefix marks the data of a znode presented as a symbolic link, the link target follows it. Zookeeper has no
+// notion of a link, so any znode without children holding data with this prefix is reported as one.
+const SymlinkPrefix = "zoofuse:symlink:"
+
+// maxSymlinkSize bounds the data of a znode that may hold a link, larger znodes are not fetched by GetAttr to look
+// for the SymlinkPrefix.
+const maxSymlinkSize = len(SymlinkPrefix) + 4096
+
+// symlinkCache holds whether each znode is presented as a link, and its target, alongside the zxid of the data they
+// were read from, so GetAttr only fetches the data of a znode again once modified. The zero value is ready for use.
+type symlinkCache struct {
+	sync.Mutex
+	links map[string]symlinkEntry
+}
+
+type symlinkEntry struct {
+	mzxid  int64
+	target string
+	link   bool
+}
+
+func (s *symlinkCache) get(path string, mzxid int64) (symlinkEntry, bool) {
+	s.Lock()
+	defer s.Unlock()
+	entry, ok := s.links[path]
+	return entry, ok && entry.mzxid == mzxid
+}
+
+func (s *symlinkCache) set(path string, entry symlinkEntry) {
+	s.Lock()
+	defer s.Unlock()
+	if s.links == nil {
+		s.links = make(map[string]symlinkEntry)
+	}
+	s.links[path] = entry
+}
+
+// Symlink creates the znode `linkName` holding the SymlinkPrefix followed by the link target `value`.
+func (f *FuseFS) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
+	ctx := traceRequest(context, "Symlink", linkName)
+	if !f.IsReadWrite || f.isVirtual(linkName) {
+		return fuse.EROFS
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	linkName = f.unbucket(linkName)
+	if status := f.checkName(linkName); !status.Ok() {
+		return status
+	}
+	if status := f.ready(); !status.Ok() {
+		return status
+	}
+	if status := f.checkACL(ctx, parentPath(linkName), zk.PermCreate); !status.Ok() {
+		return status
+	}
+
+	if !f.reserveCreate() {
+		return fuse.Status(syscall.ENOSPC)
+	}
+	if _, err := f.zh.Create(ctx, linkName, []byte(SymlinkPrefix+value), int32(0), zk.WorldACL(zk.PermAll)); err != nil {
+		f.releaseCreate()
+		log.WithFields(log.Fields{
+			"path": linkName,
+			"err":  err,
+		}).Error("failed to create symlink znode.")
+		f.errors.record("Symlink", linkName, err)
+		return zkErrToStatus(err)
+	}
+	return fuse.OK
+}
+
+// Readlink returns the target of the link held by the znode `name`. A znode that is not a link is refused with
+// EINVAL, as readlink(2) does for regular files.
+func (f *FuseFS) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
+	ctx := traceRequest(context, "Readlink", name)
+	if f.isVirtual(name) {
+		return "", fuse.EINVAL
+	}
+	if status := f.ready(); !status.Ok() {
+		return "", status
+	}
+
+	data, _, err := f.zh.Get(ctx, f.unbucket(name))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": name,
+			"err":  err,
+		}).Error("unable to Get symlink znode")
+		f.errors.record("Readlink", name, err)
+		return "", zkErrToStatus(err)
+	}
+	if !bytes.HasPrefix(data, []byte(SymlinkPrefix)) {
+		return "", fuse.EINVAL
+	}
+	return string(bytes.TrimPrefix(data, []byte(SymlinkPrefix))), fuse.OK
+}
+
+// symlinkTarget returns the link target held by the znode at `path`, when it is presented as a link. Only znodes
+// without children whose data is large enough to hold the SymlinkPrefix, and small enough to be a link, are fetched,
+// and only once per modification of their data.
+func (f *FuseFS) symlinkTarget(ctx context.Context, path string, stat *zk.Stat) (string, bool) {
+	if stat.NumChildren != 0 || stat.DataLength < int32(len(SymlinkPrefix)) || stat.DataLength > int32(maxSymlinkSize) {
+		return "", false
+	}
+	if entry, ok := f.symlinks.get(path, stat.Mzxid); ok {
+		return entry.target, entry.link
+	}
+	data, stat, err := f.zh.Get(ctx, path)
+	if err != nil {
+		return "", false
+	}
+	entry := symlinkEntry{mzxid: stat.Mzxid, link: bytes.HasPrefix(data, []byte(SymlinkPrefix))}
+	if entry.link {
+		entry.target = string(bytes.TrimPrefix(data, []byte(SymlinkPrefix)))
+	}
+	f.symlinks.set(path, entry)
+	return entry.target, entry.link
+}
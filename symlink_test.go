@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestSymlink verifies a link is created as a znode holding its target behind the SymlinkPrefix, read back by
+// Readlink and reported as S_IFLNK by GetAttr.
+func TestSymlink(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	data := []byte(SymlinkPrefix + "../shared/db")
+	mockZooKeeper.zk.On("Create", "app/db", data, int32(0), zk.WorldACL(zk.PermAll)).Return("/app/db", nil)
+	mockZooKeeper.zk.On("Get", "app/db").Return(data, &zk.Stat{DataLength: int32(len(data))}, nil)
+	mockZooKeeper.zk.On("Exists", "app/db").Return(true, &zk.Stat{DataLength: int32(len(data))}, nil)
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("zoofuse:config"), &zk.Stat{DataLength: 14}, nil)
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{DataLength: 32}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.OK, fs.Symlink("../shared/db", "app/db", nil))
+
+	target, status := fs.Readlink("app/db", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "../shared/db", target)
+
+	attr, status := fs.GetAttr("app/db", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(fuse.S_IFLNK|0777), attr.Mode)
+	assert.Equal(t, uint64(len("../shared/db")), attr.Size)
+
+	// regular znodes are not links.
+	_, status = fs.Readlink("app/config", nil)
+	assert.Equal(t, fuse.EINVAL, status)
+	attr, status = fs.GetAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(fuse.S_IFREG|IfRegRW), attr.Mode)
+
+	fs = &FuseFS{zh: mockZooKeeper}
+	assert.Equal(t, fuse.EROFS, fs.Symlink("../shared/db", "app/other", nil))
+	mockZooKeeper.zk.AssertNotCalled(t, "Create", "app/other", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestSymlinkCached verifies GetAttr only fetches the data of a znode which may hold a link once per modification.
+func TestSymlinkCached(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	data := []byte(SymlinkPrefix + "../shared/db")
+	moved := []byte(SymlinkPrefix + "../shared/moved")
+	mockZooKeeper.zk.On("Exists", "app/db").Return(true, &zk.Stat{DataLength: int32(len(data)), Mzxid: 3}, nil).Twice()
+	mockZooKeeper.zk.On("Exists", "app/db").Return(true, &zk.Stat{DataLength: int32(len(moved)), Mzxid: 5}, nil)
+	mockZooKeeper.zk.On("Get", "app/db").Return(data, &zk.Stat{DataLength: int32(len(data)), Mzxid: 3}, nil).Once()
+	mockZooKeeper.zk.On("Get", "app/db").Return(moved, &zk.Stat{DataLength: int32(len(moved)), Mzxid: 5}, nil).Once()
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{DataLength: 32, Mzxid: 4}, nil)
+	mockZooKeeper.zk.On("Get", "app/config").Return(make([]byte, 32), &zk.Stat{DataLength: 32, Mzxid: 4}, nil).Once()
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	for i := 0; i < 2; i++ {
+		attr, status := fs.GetAttr("app/db", nil)
+		assert.Equal(t, fuse.OK, status)
+		assert.Equal(t, uint64(len("../shared/db")), attr.Size)
+		attr, status = fs.GetAttr("app/config", nil)
+		assert.Equal(t, fuse.OK, status)
+		assert.Equal(t, uint32(fuse.S_IFREG|IfRegRO), attr.Mode)
+	}
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", 2)
+
+	// a modified znode is fetched again.
+	attr, status := fs.GetAttr("app/db", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint64(len("../shared/moved")), attr.Size)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Get", 3)
+}
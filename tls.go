@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// newTLSConfig builds the TLS configuration of the connections to the ensemble. The client certificate (`certFile`
+// and `keyFile`) is only needed by ensembles authenticating their clients, the servers are verified against the CA
+// bundle `caFile`, or the system roots when none is given. With `insecure` the servers are not verified at all.
+func newTLSConfig(certFile, keyFile, caFile string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("tls-cert and tls-key must be given together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate %s (key %s): %v", certFile, keyFile, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the CA bundle: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificate found in the CA bundle %s", caFile)
+		}
+	}
+	return config, nil
+}
+
+// tlsDialer returns a dialer opening TLS connections to the servers of the ensemble, verified against `config`.
+func tlsDialer(config *tls.Config) zk.Dialer {
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, config)
+	}
+}
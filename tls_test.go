@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert writes a self-signed certificate and its key as PEM files within `dir`, returning their paths.
+func writeCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "zoofuse"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zoofuse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCert(t, dir)
+
+	// the self-signed certificate doubles as the CA bundle.
+	config, err := newTLSConfig(certFile, keyFile, certFile, false)
+	assert.Nil(t, err)
+	assert.Len(t, config.Certificates, 1)
+	assert.NotNil(t, config.RootCAs)
+	assert.False(t, config.InsecureSkipVerify)
+
+	// without a client certificate or CA bundle, the system roots verify the servers.
+	config, err = newTLSConfig("", "", "", true)
+	assert.Nil(t, err)
+	assert.Empty(t, config.Certificates)
+	assert.Nil(t, config.RootCAs)
+	assert.True(t, config.InsecureSkipVerify)
+
+	_, err = newTLSConfig(certFile, "", "", false)
+	assert.Error(t, err)
+	_, err = newTLSConfig(filepath.Join(dir, "missing.pem"), keyFile, "", false)
+	assert.Error(t, err)
+	_, err = newTLSConfig("", "", filepath.Join(dir, "missing.pem"), false)
+	assert.Error(t, err)
+	// a key is no CA bundle.
+	_, err = newTLSConfig("", "", keyFile, false)
+	assert.Error(t, err)
+}
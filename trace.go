@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDKey is the context key holding the ID of the FUSE request a Zookeeper call is made for.
+type requestIDKey struct{}
+
+// requestSeq numbers the FUSE requests served by the process, accessed atomically.
+var requestSeq uint64
+
+// withRequestID returns a copy of `ctx` carrying the request ID `id`.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the request ID carried by `ctx`, if any.
+func requestID(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// traceFields adds the request ID carried by `ctx` to the log `fields`, so the Zookeeper calls made for a FUSE
+// request can be correlated with it.
+func traceFields(ctx context.Context, fields log.Fields) log.Fields {
+	if id, ok := requestID(ctx); ok {
+		fields["request"] = id
+	}
+	return fields
+}
+
+// traceRequest starts the tracing of the FUSE request `op` on `path`, returning the context its Zookeeper calls are
+// made with. Each request is given a new ID, logged at debug level along with the calling process when known.
+func traceRequest(caller *fuse.Context, op, path string) context.Context {
+	id := strconv.FormatUint(atomic.AddUint64(&requestSeq, 1), 16)
+	if log.IsLevelEnabled(log.DebugLevel) {
+		fields := log.Fields{
+			"request": id,
+			"op":      op,
+			"path":    path,
+		}
+		if caller != nil {
+			fields["pid"] = caller.Pid
+		}
+		log.WithFields(fields).Debug("fuse request")
+	}
+	return withRequestID(context.Background(), id)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestRequestTracing verifies the Zookeeper calls made for a FUSE request are logged with the ID of the request,
+// and that each request is given its own ID.
+func TestRequestTracing(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(log.DebugLevel)
+	hook := test.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+
+	mockClient := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockClient.zk.On("Exists", "/app").Return(true, &zk.Stat{}, nil)
+	fs := &FuseFS{zh: &ZooHandle{zk: mockClient, ZKRoot: "/", FuseMount: "/mnt/fuse"}}
+
+	var requests []string
+	for range []int{1, 2} {
+		hook.Reset()
+		_, status := fs.GetAttr("app", &fuse.Context{Pid: 42})
+		assert.Equal(t, fuse.OK, status)
+
+		var id interface{}
+		calls := 0
+		for _, entry := range hook.AllEntries() {
+			switch entry.Message {
+			case "fuse request":
+				assert.Equal(t, "GetAttr", entry.Data["op"])
+				assert.Equal(t, uint32(42), entry.Data["pid"])
+				id = entry.Data["request"]
+			case "":
+				assert.Equal(t, "/app", entry.Data["path"])
+				assert.NotNil(t, id)
+				assert.Equal(t, id, entry.Data["request"])
+				calls++
+			}
+		}
+		assert.Equal(t, 1, calls)
+		if assert.IsType(t, "", id) {
+			requests = append(requests, id.(string))
+		}
+	}
+	assert.Len(t, requests, 2)
+	assert.NotEqual(t, requests[0], requests[1])
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// URLEncodingZooHandler is a Zoohandler presenting znode names percent-encoded, so names holding characters awkward
+// for shells (spaces, colons ...) can be navigated. Children are listed under their encoded names and the paths
+// handed in are decoded back to the real znode names. Only ASCII letters, digits and `-_.~` are left as is.
+type URLEncodingZooHandler struct {
+	wrappedZooHandler
+}
+
+// NewURLEncodingZooHandler wraps `zh`, percent-encoding the znode names it presents.
+func NewURLEncodingZooHandler(zh Zoohandler) *URLEncodingZooHandler {
+	return &URLEncodingZooHandler{wrappedZooHandler{zh}}
+}
+
+// encodeName percent-encodes every byte of a znode name outside of the unreserved URL characters.
+func encodeName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// decodeName returns the znode name presented as `name`. A name which is not validly encoded is taken literally.
+func decodeName(name string) string {
+	decoded, err := url.PathUnescape(name)
+	if err != nil {
+		return name
+	}
+	return decoded
+}
+
+// mapPath applies `fn` to each element of `path`.
+func mapPath(path string, fn func(string) string) string {
+	elements := strings.Split(path, "/")
+	for i, element := range elements {
+		elements[i] = fn(element)
+	}
+	return strings.Join(elements, "/")
+}
+
+// Children implements Zoohandler.Children, returning the encoded names of the children.
+func (u *URLEncodingZooHandler) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
+	children, stat, err := u.Zoohandler.Children(ctx, mapPath(path, decodeName))
+	for i, child := range children {
+		children[i] = encodeName(child)
+	}
+	return children, stat, err
+}
+
+// Create implements Zoohandler.Create, returning the encoded path of the created znode.
+func (u *URLEncodingZooHandler) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	created, err := u.Zoohandler.Create(ctx, mapPath(path, decodeName), data, flags, acl)
+	return mapPath(created, encodeName), err
+}
+
+// Delete implements Zoohandler.Delete.
+func (u *URLEncodingZooHandler) Delete(ctx context.Context, path string, version int32) error {
+	return u.Zoohandler.Delete(ctx, mapPath(path, decodeName), version)
+}
+
+// Exists implements Zoohandler.Exists.
+func (u *URLEncodingZooHandler) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	return u.Zoohandler.Exists(ctx, mapPath(path, decodeName))
+}
+
+// Get implements Zoohandler.Get.
+func (u *URLEncodingZooHandler) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
+	return u.Zoohandler.Get(ctx, mapPath(path, decodeName))
+}
+
+// Set implements Zoohandler.Set.
+func (u *URLEncodingZooHandler) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	return u.Zoohandler.Set(ctx, mapPath(path, decodeName), data, version)
+}
+
+// GetACL implements Zoohandler.GetACL.
+func (u *URLEncodingZooHandler) GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error) {
+	return u.Zoohandler.GetACL(ctx, mapPath(path, decodeName))
+}
+
+// SetACL implements Zoohandler.SetACL.
+func (u *URLEncodingZooHandler) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	return u.Zoohandler.SetACL(ctx, mapPath(path, decodeName), acl, version)
+}
+
+// GetW implements Zoohandler.GetW.
+func (u *URLEncodingZooHandler) GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	return u.Zoohandler.GetW(ctx, mapPath(path, decodeName))
+}
+
+// ChildrenW implements Zoohandler.ChildrenW, returning the encoded names of the children.
+func (u *URLEncodingZooHandler) ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	children, stat, events, err := u.Zoohandler.ChildrenW(ctx, mapPath(path, decodeName))
+	for i, child := range children {
+		children[i] = encodeName(child)
+	}
+	return children, stat, events, err
+}
+
+// Sync implements Zoohandler.Sync.
+func (u *URLEncodingZooHandler) Sync(ctx context.Context, path string) (string, error) {
+	return u.Zoohandler.Sync(ctx, mapPath(path, decodeName))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestEncodeName(t *testing.T) {
+	for name, encoded := range map[string]string{
+		"config":        "config",
+		"my config":     "my%20config",
+		"host:2181":     "host%3A2181",
+		"100%":          "100%25",
+		"v1.2_rc-1~old": "v1.2_rc-1~old",
+		"héllo":         "h%C3%A9llo",
+	} {
+		assert.Equal(t, encoded, encodeName(name))
+		assert.Equal(t, name, decodeName(encoded))
+	}
+	// names which are not validly encoded are taken literally.
+	assert.Equal(t, "100%", decodeName("100%"))
+}
+
+// TestURLEncodingZooHandler verifies children are listed encoded and encoded paths reach ZK decoded.
+func TestURLEncodingZooHandler(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Children", "app dir").Return([]string{"my config", "host:2181"}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Get", "app dir/host:2181").Return([]byte("data"), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Create", "app dir/job ", []byte(nil), int32(zk.FlagSequence), zk.WorldACL(zk.PermAll)).Return("/app dir/job 0000000001", nil)
+
+	zh := NewURLEncodingZooHandler(mockZooKeeper)
+	children, _, err := zh.Children(ctx, "app%20dir")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"my%20config", "host%3A2181"}, children)
+
+	data, _, err := zh.Get(ctx, "app%20dir/"+children[1])
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), data)
+
+	created, err := zh.Create(ctx, "app%20dir/job%20", nil, zk.FlagSequence, zk.WorldACL(zk.PermAll))
+	assert.Nil(t, err)
+	assert.Equal(t, "/app%20dir/job%200000000001", created)
+}
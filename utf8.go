@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	// UTF8Text marks the paths of a `-utf8only` rule as text, writes holding invalid UTF-8 are refused.
+	UTF8Text = "text"
+	// UTF8Binary marks the paths of a `-utf8only` rule as binary, exempting them from the UTF-8 check.
+	UTF8Binary = "binary"
+)
+
+// ParseUTF8Rule builds a PathRule from the `pattern=text` or `pattern=binary` form accepted by the `-utf8only` flag.
+// The first rule matching a path applies, so binary exemptions are listed ahead of broader text rules.
+func ParseUTF8Rule(rule string) (PathRule, error) {
+	r, err := ParsePathRule(rule)
+	if err != nil {
+		return PathRule{}, err
+	}
+	if r.Value != UTF8Text && r.Value != UTF8Binary {
+		return PathRule{}, fmt.Errorf("invalid utf8only rule %q, expected pattern=text or pattern=binary", rule)
+	}
+	return r, nil
+}
+
+// utf8Only reports whether writes to `path` must hold valid UTF-8.
+func (f *FuseFS) utf8Only(path string) bool {
+	rule, ok := matchRule(f.pathRules(&f.UTF8Rules), path)
+	return ok && rule.Value == UTF8Text
+}
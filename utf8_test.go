@@ -0,0 +1,51 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseUTF8Rule(t *testing.T) {
+	rule, err := ParseUTF8Rule("app/*=text")
+	assert.Nil(t, err)
+	assert.Equal(t, PathRule{Pattern: "app/*", Value: UTF8Text}, rule)
+
+	for _, invalid := range []string{"app", "app=", "app=utf8"} {
+		_, err := ParseUTF8Rule(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+// TestUTF8Only verifies invalid UTF-8 written to a text path is refused, while binary paths accept any data.
+func TestUTF8Only(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	invalid := []byte{'o', 'k', 0xff, 0xfe}
+	mockZooKeeper.zk.On("Get", mock.Anything).Return([]byte(nil), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("héllo"), int32(0)).Return(&zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Set", "app/blob.bin", invalid, int32(0)).Return(&zk.Stat{Version: 1}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, UTF8Rules: []PathRule{
+		{Pattern: "app/*.bin", Value: UTF8Binary},
+		{Pattern: "app/*", Value: UTF8Text},
+	}}
+
+	file, status := fs.Open("app/config", uint32(syscall.O_RDWR), nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write(invalid, 0)
+	assert.Equal(t, fuse.EINVAL, status)
+	_, status = file.Write([]byte("héllo"), 0)
+	assert.Equal(t, fuse.OK, status)
+
+	file, status = fs.Open("app/blob.bin", uint32(syscall.O_RDWR), nil)
+	assert.Equal(t, fuse.OK, status)
+	_, status = file.Write(invalid, 0)
+	assert.Equal(t, fuse.OK, status)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "Set", 2)
+}
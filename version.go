@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+// Build metadata, populated by the linker, e.g.
+// go build -ldflags "-X main.Version=v1.2.0 -X main.Commit=$(git rev-parse --short HEAD) -X main.BuildDate=$(date -u +%FT%TZ)"
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// versionString renders the build metadata, as printed by the `-version` flag.
+func versionString(version, commit, buildDate string) string {
+	return fmt.Sprintf("zoofuse %s (commit %s, built %s)", version, commit, buildDate)
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionString(t *testing.T) {
+	assert.Equal(t, "zoofuse v1.2.0 (commit 5bf2811, built 2019-03-01T12:00:00Z)", versionString("v1.2.0", "5bf2811", "2019-03-01T12:00:00Z"))
+	assert.Equal(t, "zoofuse dev (commit unknown, built unknown)", versionString(Version, Commit, BuildDate))
+}
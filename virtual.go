@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	log "github.com/sirupsen/logrus"
+)
+
+// ControlDir is a virtual, read-only directory placed at the root of the mount. The files within expose the state of
+// ZooFuse itself rather than data held in Zookeeper.
+const ControlDir = ".zoofuse"
+
+// renderFunc produces the content of a virtual file on demand.
+type renderFunc func(ctx context.Context) ([]byte, error)
+
+// controlFile is a file within the ControlDir. Files with a write function accept commands on read/write mounts,
+// the others are read-only.
+type controlFile struct {
+	render renderFunc
+	write  func(ctx context.Context, content []byte) error
+}
+
+// controlFiles returns the files presented within the ControlDir, keyed by name.
+func (f *FuseFS) controlFiles() map[string]controlFile {
+	files := map[string]controlFile{
+		"config":    {render: f.renderConfig},
+		"errors":    {render: f.renderErrors},
+		"identity":  {render: f.renderIdentity},
+		"increment": {render: emptyContent, write: f.incrementCommand},
+		"stats":     {render: f.renderStats},
+	}
+	if f.Snapshot != nil {
+		files["diff"] = controlFile{render: f.renderDiff}
+	}
+	if f.HotPaths != nil {
+		files["hotpaths"] = controlFile{render: f.renderHotPaths}
+	}
+	return files
+}
+
+// emptyContent renders a control file which has nothing to show.
+func emptyContent(ctx context.Context) ([]byte, error) {
+	return nil, nil
+}
+
+// controlWriter returns the write function of the control file at `path`, when it accepts writes on this mount.
+func (f *FuseFS) controlWriter(path string) (func(context.Context, []byte) error, bool) {
+	if !f.IsReadWrite || !strings.HasPrefix(path, ControlDir+"/") {
+		return nil, false
+	}
+	file, ok := f.controlFiles()[strings.TrimPrefix(path, ControlDir+"/")]
+	return file.write, ok && file.write != nil
+}
+
+// isVirtual reports whether `path` is synthesised by ZooFuse, or resides within the ControlDir. Such paths never
+// map onto a znode and are not writable.
+func (f *FuseFS) isVirtual(path string) bool {
+	if path == ControlDir || strings.HasPrefix(path, ControlDir+"/") {
+		return true
+	}
+	if _, ok := statMarkerTarget(path); ok {
+		return true
+	}
+	_, ok := f.mergeRule(path)
+	return ok
+}
+
+// virtualContent returns the render function of the virtual file presented at `path`, if any.
+func (f *FuseFS) virtualContent(path string) (renderFunc, bool) {
+	if strings.HasPrefix(path, ControlDir+"/") {
+		file, ok := f.controlFiles()[strings.TrimPrefix(path, ControlDir+"/")]
+		return file.render, ok
+	}
+	if rule, ok := f.mergeRule(path); ok {
+		return func(ctx context.Context) ([]byte, error) { return f.renderMerge(ctx, rule) }, true
+	}
+	if target, ok := statMarkerTarget(path); ok {
+		return func(ctx context.Context) ([]byte, error) { return f.renderZNodeStat(ctx, target) }, true
+	}
+	return nil, false
+}
+
+// virtualEntries returns the directory entries of the virtual files residing directly within `path`.
+func (f *FuseFS) virtualEntries(path string) []fuse.DirEntry {
+	var entries []fuse.DirEntry
+	if path == "" {
+		entries = append(entries, fuse.DirEntry{Name: ControlDir, Mode: fuse.S_IFDIR})
+	}
+	if path == ControlDir {
+		for name := range f.controlFiles() {
+			entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFREG})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	}
+
+	for _, rule := range f.MergeRules {
+		if parentPath(rule.Path) == path {
+			entries = append(entries, fuse.DirEntry{Name: filepath.Base(rule.Path), Mode: fuse.S_IFREG})
+		}
+	}
+	return entries
+}
+
+// virtualAttr returns the attributes of a virtual path. Virtual files are always read-only.
+func (f *FuseFS) virtualAttr(ctx context.Context, path string) (*fuse.Attr, fuse.Status) {
+	if path == ControlDir {
+		return &fuse.Attr{Mode: fuse.S_IFDIR | IfDirRO}, fuse.OK
+	}
+
+	render, ok := f.virtualContent(path)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	data, err := render(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Error("failed to render virtual file")
+		return nil, fuse.EIO
+	}
+	mode := IfRegRO
+	if _, ok := f.controlWriter(path); ok {
+		mode = IfRegRW
+	}
+	return &fuse.Attr{
+		Mode: fuse.S_IFREG | mode,
+		Size: uint64(len(data)),
+	}, fuse.OK
+}
+
+// openVirtual returns a virtualFile holding the rendered content of `path`. Opening for write is refused since there
+// is no single znode the data could be written back to.
+func (f *FuseFS) openVirtual(ctx context.Context, path string, flags uint32) (nodefs.File, fuse.Status) {
+	if flags&fuse.O_ANYWRITE != 0 {
+		if write, ok := f.controlWriter(path); ok {
+			return &commandFile{File: nodefs.NewDefaultFile(), path: path, write: write}, fuse.OK
+		}
+		return nil, fuse.EROFS
+	}
+
+	render, ok := f.virtualContent(path)
+	if !ok {
+		return nil, fuse.ENOENT
+	}
+	data, err := render(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Error("failed to render virtual file")
+		return nil, fuse.EIO
+	}
+	return newVirtualFile(data), fuse.OK
+}
+
+// virtualFile is an in-memory file holding content synthesised by ZooFuse rather than read from a single znode.
+// The source of such content is ambiguous, so all writes are refused with EROFS.
+type virtualFile struct {
+	nodefs.File
+}
+
+func newVirtualFile(data []byte) *virtualFile {
+	return &virtualFile{File: nodefs.NewDataFile(data)}
+}
+
+// Write is always refused on a virtual file.
+func (v *virtualFile) Write(content []byte, off int64) (uint32, fuse.Status) {
+	return 0, fuse.EROFS
+}
+
+// Truncate is always refused on a virtual file.
+func (v *virtualFile) Truncate(size uint64) fuse.Status {
+	return fuse.EROFS
+}
+
+// commandFile is a control file opened for write. Each write is handed to the command implemented by the control
+// file, errors parsing the command are reported as EINVAL.
+type commandFile struct {
+	nodefs.File
+	path  string
+	write func(ctx context.Context, content []byte) error
+}
+
+// Write executes the command held in `content`.
+func (c *commandFile) Write(content []byte, off int64) (uint32, fuse.Status) {
+	if err := c.write(traceRequest(nil, "Write", c.path), content); err != nil {
+		log.WithFields(log.Fields{
+			"path": c.path,
+			"err":  err,
+		}).Error("control command failed")
+		if _, ok := err.(commandError); ok {
+			return 0, fuse.EINVAL
+		}
+		return 0, zkErrToStatus(err)
+	}
+	return uint32(len(content)), fuse.OK
+}
+
+// Truncate is a no-op, allowing commands to be written with a plain shell redirect.
+func (c *commandFile) Truncate(size uint64) fuse.Status {
+	return fuse.OK
+}
+
+// commandError reports a control command that could not be parsed.
+type commandError struct {
+	msg string
+}
+
+func (e commandError) Error() string {
+	return e.msg
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// notifier invalidates the kernel cache of a path. It is implemented by pathfs.PathNodeFs once mounted.
+type notifier interface {
+	FileNotify(path string, off int64, length int64) fuse.Status
+	EntryNotify(dir string, name string) fuse.Status
+}
+
+// watchSet holds the watches pending on the ensemble, so a znode opened repeatedly is watched once. ZK watches fire
+// a single time, a watch is removed from the set once it fired. The zero value is ready for use.
+type watchSet struct {
+	sync.Mutex
+	pending map[string]bool
+}
+
+// add records a watch for `key`, reporting false when one is already pending.
+func (w *watchSet) add(key string) bool {
+	w.Lock()
+	defer w.Unlock()
+	if w.pending == nil {
+		w.pending = make(map[string]bool)
+	}
+	if w.pending[key] {
+		return false
+	}
+	w.pending[key] = true
+	return true
+}
+
+func (w *watchSet) remove(key string) {
+	w.Lock()
+	defer w.Unlock()
+	delete(w.pending, key)
+}
+
+// watchData leaves a watch on the data of the znode at `path`, presented at `name`. When it fires the kernel cache
+// of the file is invalidated, and its directory entry too when the znode was removed.
+func (f *FuseFS) watchData(ctx context.Context, name, path string) {
+	if !f.Watch || !f.watches.add("data:"+path) {
+		return
+	}
+	_, _, events, err := f.zh.GetW(ctx, path)
+	f.awaitWatch("data:"+path, events, err, func(event zk.Event) {
+		f.notify(name, event.Type == zk.EventNodeDeleted)
+	})
+}
+
+// watchChildren leaves a watch on the children of the znode at `path`, presented at `name`. When it fires the
+// kernel cache of the directory listing is invalidated.
+func (f *FuseFS) watchChildren(ctx context.Context, name, path string) {
+	if !f.Watch || !f.watches.add("children:"+path) {
+		return
+	}
+	_, _, events, err := f.zh.ChildrenW(ctx, path)
+	f.awaitWatch("children:"+path, events, err, func(event zk.Event) {
+		f.notify(name, event.Type == zk.EventNodeDeleted)
+	})
+}
+
+// awaitWatch calls `fired` once the watch registered as `key` fires. A watch which could not be registered, or is
+// dropped along with the session, is forgotten so the next open registers it again.
+func (f *FuseFS) awaitWatch(key string, events <-chan zk.Event, err error, fired func(zk.Event)) {
+	if err != nil {
+		f.watches.remove(key)
+		log.WithFields(log.Fields{
+			"watch": key,
+			"err":   err,
+		}).Debug("unable to register watch")
+		return
+	}
+	go func() {
+		event, ok := <-events
+		f.watches.remove(key)
+		if !ok || event.Type == zk.EventNotWatching {
+			return
+		}
+		log.WithFields(log.Fields{
+			"watch": key,
+			"event": event.Type.String(),
+		}).Debug("watch fired, invalidating kernel cache")
+		fired(event)
+	}()
+}
+
+// notify invalidates the kernel cache of the file or directory presented at `name`, and its directory entry when
+// `removed`.
+func (f *FuseFS) notify(name string, removed bool) {
+	if f.notifier == nil {
+		return
+	}
+	if removed && name != "" {
+		f.notifier.EntryNotify(parentPath(name), filepath.Base(name))
+		return
+	}
+	f.notifier.FileNotify(name, 0, 0)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeNotifier records the kernel cache invalidations requested by the filesystem.
+type fakeNotifier struct {
+	notified chan string
+}
+
+func (n *fakeNotifier) FileNotify(path string, off int64, length int64) fuse.Status {
+	n.notified <- "file:" + path
+	return fuse.OK
+}
+
+func (n *fakeNotifier) EntryNotify(dir string, name string) fuse.Status {
+	n.notified <- "entry:" + filepath.Join(dir, name)
+	return fuse.OK
+}
+
+// awaitNotify returns the next invalidation, or fails the test when none is requested in time.
+func (n *fakeNotifier) awaitNotify(t *testing.T) string {
+	select {
+	case notified := <-n.notified:
+		return notified
+	case <-time.After(5 * time.Second):
+		t.Fatal("no kernel cache invalidation requested")
+		return ""
+	}
+}
+
+// TestWatchData verifies a fired data watch invalidates the kernel cache of the opened file, and that the znode is
+// only watched once until the watch fires.
+func TestWatchData(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	events := make(chan zk.Event, 1)
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("GetW", "app/config").Return([]byte("data"), &zk.Stat{}, (<-chan zk.Event)(events), nil)
+
+	n := &fakeNotifier{notified: make(chan string, 1)}
+	fs := &FuseFS{zh: mockZooKeeper, Watch: true, notifier: n}
+	_, status := fs.Open("app/config", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	fs.Open("app/config", uint32(0), nil)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "GetW", 1)
+
+	events <- zk.Event{Type: zk.EventNodeDataChanged, Path: "/app/config"}
+	assert.Equal(t, "file:app/config", n.awaitNotify(t))
+}
+
+// TestWatchChildren verifies a fired children watch invalidates the listing, and the removal of the directory its
+// entry.
+func TestWatchChildren(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	events := make(chan zk.Event, 1)
+	mockZooKeeper.zk.On("Children", "app").Return([]string{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("ChildrenW", "app").Return([]string{}, &zk.Stat{}, (<-chan zk.Event)(events), nil)
+
+	n := &fakeNotifier{notified: make(chan string, 1)}
+	fs := &FuseFS{zh: mockZooKeeper, Watch: true, notifier: n}
+	_, status := fs.OpenDir("app", nil)
+	assert.Equal(t, fuse.OK, status)
+	events <- zk.Event{Type: zk.EventNodeChildrenChanged, Path: "/app"}
+	assert.Equal(t, "file:app", n.awaitNotify(t))
+
+	// the watch fired, so the next listing registers a new one.
+	events = make(chan zk.Event, 1)
+	mockZooKeeper.zk.ExpectedCalls = nil
+	mockZooKeeper.zk.On("Children", "app").Return([]string{}, &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("ChildrenW", "app").Return([]string{}, &zk.Stat{}, (<-chan zk.Event)(events), nil)
+	fs.OpenDir("app", nil)
+	events <- zk.Event{Type: zk.EventNodeDeleted, Path: "/app"}
+	assert.Equal(t, "entry:app", n.awaitNotify(t))
+}
+
+// TestWatchDisabled verifies no watches are left without the watch flag.
+func TestWatchDisabled(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	_, status := fs.Open("app/config", uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	mockZooKeeper.zk.AssertNotCalled(t, "GetW", mock.Anything)
+}
+
+// TestWriteNotify verifies a successful write invalidates the kernel cache of the written file, while a failed one
+// does not.
+func TestWriteNotify(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Get", "app/config").Return([]byte("data"), &zk.Stat{Version: 1}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("fresh"), int32(1)).Return(&zk.Stat{Version: 2}, nil)
+	mockZooKeeper.zk.On("Set", "app/config", []byte("freshfail"), int32(2)).Return((*zk.Stat)(nil), zk.ErrNoAuth)
+
+	n := &fakeNotifier{notified: make(chan string, 1)}
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, notifier: n}
+	file, status := fs.Open("app/config", syscall.O_WRONLY, nil)
+	assert.Equal(t, fuse.OK, status)
+
+	_, status = file.Write([]byte("fresh"), 0)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "file:app/config", n.awaitNotify(t))
+
+	_, status = file.Write([]byte("fail"), 5)
+	assert.Equal(t, fuse.EACCES, status)
+	select {
+	case notified := <-n.notified:
+		t.Fatalf("unexpected invalidation %s", notified)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
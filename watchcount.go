@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// XAttrWatchCount is the extended attribute reporting the number of watches registered on a znode across the
+	// ensemble, as listed by the `wchp` four letter word.
+	XAttrWatchCount = "user.zk.watchcount"
+
+	// fourLetterTimeout bounds the exchange of a four letter word with a server.
+	fourLetterTimeout = 5 * time.Second
+
+	// defaultZKPort is the client port of servers given as a bare host.
+	defaultZKPort = "2181"
+)
+
+// watchCounter reports the number of watches registered on a path.
+type watchCounter interface {
+	WatchCount(path string) (int, error)
+}
+
+// wchpWatchCounter counts the watches registered on a znode by querying each server of the ensemble with `wchp`,
+// which lists the sessions watching each path. Each server only knows of the watches of its own sessions, so the
+// counts of all servers are summed. The servers must allow the command (see 4lw.commands.whitelist).
+type wchpWatchCounter struct {
+	servers   []string
+	root      string                                   // zkroot the fuse paths are relative to
+	urlencode bool                                     // fuse paths are percent-encoded (see URLEncodingZooHandler)
+	query     func(server, cmd string) ([]byte, error) // sends a four letter word to a server, replaced by tests
+}
+
+// newWchpWatchCounter returns a watchCounter querying `servers`, for the fuse paths of a mount of `root`.
+func newWchpWatchCounter(servers []string, root string, urlencode bool) *wchpWatchCounter {
+	return &wchpWatchCounter{servers: servers, root: root, urlencode: urlencode, query: fourLetterWord}
+}
+
+// WatchCount returns the number of watches registered on the znode at the fuse `path`, across the ensemble.
+func (w *wchpWatchCounter) WatchCount(path string) (int, error) {
+	if w.urlencode {
+		path = mapPath(path, decodeName)
+	}
+	zkPath := filepath.Join("/", w.root, strings.TrimSuffix(path, ZNodeMarker))
+
+	total := 0
+	for _, server := range w.servers {
+		out, err := w.query(server, "wchp")
+		if err != nil {
+			return 0, err
+		}
+		counts, err := parseWchp(out)
+		if err != nil {
+			return 0, fmt.Errorf("server %s: %v", server, err)
+		}
+		total += counts[zkPath]
+	}
+	return total, nil
+}
+
+// parseWchp returns the number of sessions watching each path listed by the `wchp` four letter word. Each path is
+// given on a line of its own, followed by the indented ids of the sessions watching it.
+func parseWchp(out []byte) (map[string]int, error) {
+	counts := make(map[string]int)
+	path := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			continue
+		case strings.HasPrefix(line, "/"):
+			path = line
+		case (line[0] == ' ' || line[0] == '\t') && path != "":
+			counts[path]++
+		default:
+			// the server refused the command, e.g. "wchp is not executed because it is not in the whitelist."
+			return nil, fmt.Errorf("unexpected wchp output: %s", line)
+		}
+	}
+	return counts, scanner.Err()
+}
+
+// fourLetterWord sends `cmd` to `server` and returns its response. A server given without a port is reached on the
+// default client port.
+func fourLetterWord(server, cmd string) ([]byte, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, defaultZKPort)
+	}
+	conn, err := net.DialTimeout("tcp", server, fourLetterTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(fourLetterTimeout))
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(conn)
+}
+
+// getWatchCountAttr renders the number of watches registered on the znode at `path`.
+func (f *FuseFS) getWatchCountAttr(ctx context.Context, path string) ([]byte, error) {
+	n, err := f.WatchCounts.WatchCount(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Itoa(n)), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleWchp is the `wchp` output of a server holding watches from two sessions.
+const sampleWchp = `/app/config
+	0x1000a1b2c3d0000
+	0x1000a1b2c3d0001
+/app/locks
+	0x1000a1b2c3d0001
+`
+
+func TestParseWchp(t *testing.T) {
+	counts, err := parseWchp([]byte(sampleWchp))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"/app/config": 2, "/app/locks": 1}, counts)
+
+	counts, err = parseWchp(nil)
+	assert.Nil(t, err)
+	assert.Empty(t, counts)
+
+	_, err = parseWchp([]byte("wchp is not executed because it is not in the whitelist.\n"))
+	assert.NotNil(t, err)
+}
+
+// TestWatchCountXAttr verifies the watch count xattr sums the watches of every server on the znode, the fuse path
+// mapped under the zkroot.
+func TestWatchCountXAttr(t *testing.T) {
+	counter := newWchpWatchCounter([]string{"zk1:2181", "zk2"}, "/app", false)
+	var queried []string
+	counter.query = func(server, cmd string) ([]byte, error) {
+		assert.Equal(t, "wchp", cmd)
+		queried = append(queried, server)
+		if server == "zk2" {
+			return []byte("/app/config\n\t0x2000a1b2c3d0000\n"), nil
+		}
+		return []byte(sampleWchp), nil
+	}
+	fs := &FuseFS{WatchCounts: counter}
+
+	data, status := fs.GetXAttr("config", XAttrWatchCount, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "3", string(data))
+	assert.Equal(t, []string{"zk1:2181", "zk2"}, queried)
+
+	data, status = fs.GetXAttr("locks/"+ZNodeMarker, XAttrWatchCount, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "1", string(data))
+
+	data, status = fs.GetXAttr("unwatched", XAttrWatchCount, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "0", string(data))
+
+	counter.query = func(server, cmd string) ([]byte, error) {
+		return nil, errors.New("connection refused")
+	}
+	_, status = fs.GetXAttr("config", XAttrWatchCount, nil)
+	assert.Equal(t, fuse.EIO, status)
+
+	attrs, _ := fs.ListXAttr("config", nil)
+	assert.Contains(t, attrs, XAttrWatchCount)
+}
@@ -0,0 +1,15 @@
+package main
+
+// wrappedZooHandler is embedded by the Zoohandlers wrapping another one. Every call, Ready included, is passed through
+// to the wrapped Zoohandler, so a wrapper only implements the calls it changes.
+type wrappedZooHandler struct {
+	Zoohandler
+}
+
+// Ready reports whether the wrapped Zoohandler is able to serve requests.
+func (w wrappedZooHandler) Ready() bool {
+	if r, ok := w.Zoohandler.(readiness); ok {
+		return r.Ready()
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWrappedReady verifies every wrapping Zoohandler reports the readiness of the Zoohandler it wraps.
+func TestWrappedReady(t *testing.T) {
+	wrappers := map[string]func(Zoohandler) Zoohandler{
+		"coalesce":  func(zh Zoohandler) Zoohandler { return NewCoalescingZooHandler(zh) },
+		"hotpaths":  func(zh Zoohandler) Zoohandler { return NewHotPathZooHandler(zh, 1) },
+		"latency":   func(zh Zoohandler) Zoohandler { return NewLatencyZooHandler(zh) },
+		"metrics":   func(zh Zoohandler) Zoohandler { return NewMetricsZooHandler(zh) },
+		"readonly":  func(zh Zoohandler) Zoohandler { return NewReadOnlyZooHandler(zh) },
+		"statcache": func(zh Zoohandler) Zoohandler { return NewStatCachingZooHandler(zh, DefaultAttrCacheTTL) },
+		"urlencode": func(zh Zoohandler) Zoohandler { return NewURLEncodingZooHandler(zh) },
+	}
+	for name, wrap := range wrappers {
+		assert.True(t, wrap(&MockZooHandle{}).(readiness).Ready(), name)
+		assert.False(t, wrap(&LazyZooHandler{}).(readiness).Ready(), name)
+	}
+}
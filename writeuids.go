@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// ParseUIDs parses the comma separated list of numeric user IDs accepted by the `-writeuids` flag.
+func ParseUIDs(list string) ([]uint32, error) {
+	var uids []uint32
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		uid, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %q, expected a numeric user ID", field)
+		}
+		uids = append(uids, uint32(uid))
+	}
+	return uids, nil
+}
+
+// checkWriter refuses a mutating operation with EACCES unless the calling user is listed in WriteUIDs. Any user may
+// write when WriteUIDs is empty, the read/write mode of the mount still applies.
+func (f *FuseFS) checkWriter(context *fuse.Context) fuse.Status {
+	if len(f.WriteUIDs) == 0 {
+		return fuse.OK
+	}
+	if context != nil {
+		for _, uid := range f.WriteUIDs {
+			if uid == context.Uid {
+				return fuse.OK
+			}
+		}
+	}
+	fields := log.Fields{}
+	if context != nil {
+		fields["uid"] = context.Uid
+		fields["pid"] = context.Pid
+	}
+	log.WithFields(fields).Warn("write refused, caller is not listed in writeuids")
+	return fuse.EACCES
+}
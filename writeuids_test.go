@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseUIDs(t *testing.T) {
+	uids, err := ParseUIDs("1000, 1001,,0")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{1000, 1001, 0}, uids)
+
+	uids, err = ParseUIDs("")
+	assert.NoError(t, err)
+	assert.Empty(t, uids)
+
+	_, err = ParseUIDs("1000,jesse")
+	assert.Error(t, err)
+	_, err = ParseUIDs("-1")
+	assert.Error(t, err)
+}
+
+// TestWriteUIDs verifies a listed user may change the tree, while any other user is refused with EACCES before
+// reaching Zookeeper.
+func TestWriteUIDs(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Create", "app/new", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/new", nil)
+	mockZooKeeper.zk.On("Create", "app/dir", []byte(nil), int32(0), zk.WorldACL(zk.PermAll)).Return("/app/dir", nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true, WriteUIDs: []uint32{1000}}
+	allowed := &fuse.Context{Owner: fuse.Owner{Uid: 1000}}
+	denied := &fuse.Context{Owner: fuse.Owner{Uid: 1001}}
+
+	_, status := fs.Create("app/new", uint32(0), uint32(0), allowed)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, fuse.OK, fs.Mkdir("app/dir", uint32(0), allowed))
+
+	_, status = fs.Create("app/other", uint32(0), uint32(0), denied)
+	assert.Equal(t, fuse.EACCES, status)
+	assert.Equal(t, fuse.EACCES, fs.Mkdir("app/other", uint32(0), denied))
+	assert.Equal(t, fuse.EACCES, fs.Unlink("app/new", denied))
+	assert.Equal(t, fuse.EACCES, fs.Rmdir("app/dir", denied))
+	_, status = fs.Open("app/new", fuse.O_ANYWRITE, denied)
+	assert.Equal(t, fuse.EACCES, status)
+	// requests without a caller are refused as well.
+	_, status = fs.Create("app/other", uint32(0), uint32(0), nil)
+	assert.Equal(t, fuse.EACCES, status)
+	mockZooKeeper.zk.AssertExpectations(t)
+	mockZooKeeper.zk.AssertNotCalled(t, "Delete", "app/new")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	log "github.com/sirupsen/logrus"
+)
+
+// XAttrACL is the extended attribute presenting the ACL of a znode, one `scheme:id:perms` entry per line. Setting
+// it replaces the ACL of the znode.
+const XAttrACL = "user.zk.acl"
+
+// errNoAttr reports an extended attribute holding no value for a znode.
+var errNoAttr = errors.New("no value for attribute")
+
+// xattr is an extended attribute presented on every znode. Attributes with a set function may be written on
+// read/write mounts, the others are read-only.
+type xattr struct {
+	get func(ctx context.Context, path string) ([]byte, error)
+	set func(ctx context.Context, path string, data []byte) error
+}
+
+// xattrs returns the extended attributes presented on znodes, keyed by name.
+func (f *FuseFS) xattrs() map[string]xattr {
+	attrs := map[string]xattr{
+		XAttrACL:         {get: f.getACLAttr, set: f.setACLAttr},
+		XAttrIsLowestSeq: {get: f.getIsLowestSeqAttr},
+		XAttrContentType: {get: f.getContentTypeAttr},
+		XAttrCAS:         {get: f.getCASAttr, set: f.setCASAttr},
+	}
+	for name, field := range statXAttrs {
+		attrs[name] = xattr{get: f.statXAttr(field)}
+	}
+	if f.Latencies != nil {
+		attrs[XAttrLastLatency] = xattr{get: f.getLatencyAttr}
+	}
+	if f.WatchCounts != nil {
+		attrs[XAttrWatchCount] = xattr{get: f.getWatchCountAttr}
+	}
+	if f.ReadCap > 0 {
+		attrs[XAttrTruncated] = xattr{get: f.getTruncatedAttr}
+	}
+	return attrs
+}
+
+// xattrPath maps a fuse path onto the znode its extended attributes describe. Virtual paths carry no attributes.
+func (f *FuseFS) xattrPath(name string) (string, fuse.Status) {
+	if f.isVirtual(name) {
+		return "", fuse.ENOATTR
+	}
+	if status := f.ready(); !status.Ok() {
+		return "", status
+	}
+	if target, ok := f.base64Target(name); ok {
+		name = target
+	}
+	return f.unbucket(name), fuse.OK
+}
+
+// xattrStatus maps the error of an extended attribute operation onto the errno returned to the kernel.
+func (f *FuseFS) xattrStatus(op, path, attr string, err error) fuse.Status {
+	if err == errNoAttr {
+		return fuse.ENOATTR
+	}
+	if _, ok := err.(commandError); ok {
+		return fuse.EINVAL
+	}
+	if status := zkErrToStatus(err); status != fuse.EIO {
+		return status
+	}
+	log.WithFields(log.Fields{
+		"path": path,
+		"attr": attr,
+		"err":  err,
+	}).Error("extended attribute operation failed")
+	f.errors.record(op, path, err)
+	return fuse.EIO
+}
+
+// ListXAttr lists the extended attributes presented on znodes.
+func (f *FuseFS) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	if f.isVirtual(name) {
+		return nil, fuse.OK
+	}
+	var attrs []string
+	for attr := range f.xattrs() {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	return attrs, fuse.OK
+}
+
+// GetXAttr returns the value of an extended attribute of a znode.
+func (f *FuseFS) GetXAttr(name string, attr string, context *fuse.Context) ([]byte, fuse.Status) {
+	ctx := traceRequest(context, "GetXAttr", name)
+	x, ok := f.xattrs()[attr]
+	if !ok {
+		return nil, fuse.ENOATTR
+	}
+	path, status := f.xattrPath(name)
+	if !status.Ok() {
+		return nil, status
+	}
+	data, err := x.get(ctx, path)
+	if err != nil {
+		return nil, f.xattrStatus("GetXAttr", path, attr, err)
+	}
+	return data, fuse.OK
+}
+
+// SetXAttr writes an extended attribute of a znode, for the attributes which may be written.
+func (f *FuseFS) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	ctx := traceRequest(context, "SetXAttr", name)
+	x, ok := f.xattrs()[attr]
+	if !ok {
+		return fuse.Status(syscall.ENOTSUP)
+	}
+	if !f.IsReadWrite || f.isVirtual(name) || x.set == nil {
+		return fuse.EROFS
+	}
+	if status := f.checkWriter(context); !status.Ok() {
+		return status
+	}
+	path, status := f.xattrPath(name)
+	if !status.Ok() {
+		return status
+	}
+	if err := x.set(ctx, path, data); err != nil {
+		return f.xattrStatus("SetXAttr", path, attr, err)
+	}
+	return fuse.OK
+}
+
+// getACLAttr renders the ACL of the znode at `path`, one entry per line.
+func (f *FuseFS) getACLAttr(ctx context.Context, path string) ([]byte, error) {
+	acl, _, err := f.zh.GetACL(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, entry := range acl {
+		buf.WriteString(FormatACL(entry) + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// setACLAttr replaces the ACL of the znode at `path` with the entries held in `data`, one per line. The ACL is
+// replaced unconditionally, whatever its version.
+func (f *FuseFS) setACLAttr(ctx context.Context, path string, data []byte) error {
+	var acl []zk.ACL
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		entry, err := ParseACL(line)
+		if err != nil {
+			return commandError{msg: err.Error()}
+		}
+		acl = append(acl, entry)
+	}
+	if len(acl) == 0 {
+		return commandError{msg: "empty ACL"}
+	}
+	_, err := f.zh.SetACL(ctx, path, acl, -1)
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestACLXAttr verifies a world:anyone:cdrwa ACL round trips through the ACL extended attribute.
+func TestACLXAttr(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("SetACL", "app/config", zk.WorldACL(zk.PermAll), int32(-1)).Return(&zk.Stat{}, nil)
+	mockZooKeeper.zk.On("GetACL", "app/config").Return(zk.WorldACL(zk.PermAll), &zk.Stat{}, nil)
+	mockZooKeeper.zk.On("GetACL", "app/missing").Return([]zk.ACL(nil), (*zk.Stat)(nil), zk.ErrNoNode)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	attrs, status := fs.ListXAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Contains(t, attrs, XAttrACL)
+
+	assert.Equal(t, fuse.OK, fs.SetXAttr("app/config", XAttrACL, []byte("world:anyone:cdrwa\n"), 0, nil))
+	data, status := fs.GetXAttr("app/config", XAttrACL, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "world:anyone:rwcda\n", string(data))
+
+	_, status = fs.GetXAttr("app/missing", XAttrACL, nil)
+	assert.Equal(t, fuse.ENOENT, status)
+	_, status = fs.GetXAttr("app/config", "user.unknown", nil)
+	assert.Equal(t, fuse.ENOATTR, status)
+	_, status = fs.GetXAttr(ControlDir+"/config", XAttrACL, nil)
+	assert.Equal(t, fuse.ENOATTR, status)
+	mockZooKeeper.zk.AssertNumberOfCalls(t, "SetACL", 1)
+}
+
+// TestACLXAttrInvalid verifies malformed ACLs, and writes on read-only mounts, never reach Zookeeper.
+func TestACLXAttrInvalid(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	assert.Equal(t, fuse.EINVAL, fs.SetXAttr("app/config", XAttrACL, []byte("world:anyone:rwx"), 0, nil))
+	assert.Equal(t, fuse.EINVAL, fs.SetXAttr("app/config", XAttrACL, []byte("\n"), 0, nil))
+
+	fs = &FuseFS{zh: mockZooKeeper}
+	assert.Equal(t, fuse.EROFS, fs.SetXAttr("app/config", XAttrACL, []byte("world:anyone:r"), 0, nil))
+	mockZooKeeper.zk.AssertNotCalled(t, "SetACL", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// ZNodeStatMarker is a read-only file found in every directory, presenting the stat of the directory znode in the
+// form printed by `stat` in zkCli. It is not listed, alongside the ZNodeMarker, to keep listings unchanged, but may be
+// read by name, e.g. `cat dir/__znode_stat__`.
+const ZNodeStatMarker = "__znode_stat__"
+
+const (
+	// MarkerFormatText renders the ZNodeStatMarker in the zkCli form, for humans.
+	MarkerFormatText = "text"
+	// MarkerFormatJSON renders the ZNodeStatMarker as the JSON encoded zk.Stat, for scripts.
+	MarkerFormatJSON = "json"
+)
+
+// statMarkerTarget returns the fuse path of the znode whose stat is presented at `path`, if `path` is a
+// ZNodeStatMarker.
+func statMarkerTarget(path string) (string, bool) {
+	if filepath.Base(path) != ZNodeStatMarker {
+		return "", false
+	}
+	return parentPath(path), true
+}
+
+// renderZNodeStat renders the stat of the znode at `path`, in the MarkerFormat of the mount.
+func (f *FuseFS) renderZNodeStat(ctx context.Context, path string) ([]byte, error) {
+	path = f.unbucket(path)
+	found, stat, err := f.zh.Exists(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, zk.ErrNoNode
+	}
+	if f.MarkerFormat == MarkerFormatJSON {
+		out, err := json.MarshalIndent(stat, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	}
+	return formatStat(stat), nil
+}
+
+// statTime renders a ZK timestamp, in milliseconds since the epoch, as an RFC 3339 UTC time.
+func statTime(t int64) string {
+	return time.Unix(t/1000, (t%1000)*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano)
+}
+
+// formatStat renders `stat` one `name = value` field per line, as zkCli does. Times are given in UTC.
+func formatStat(stat *zk.Stat) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "cZxid = 0x%x\n", stat.Czxid)
+	fmt.Fprintf(&buf, "ctime = %s\n", statTime(stat.Ctime))
+	fmt.Fprintf(&buf, "mZxid = 0x%x\n", stat.Mzxid)
+	fmt.Fprintf(&buf, "mtime = %s\n", statTime(stat.Mtime))
+	fmt.Fprintf(&buf, "pZxid = 0x%x\n", stat.Pzxid)
+	fmt.Fprintf(&buf, "cversion = %d\n", stat.Cversion)
+	fmt.Fprintf(&buf, "dataVersion = %d\n", stat.Version)
+	fmt.Fprintf(&buf, "aclVersion = %d\n", stat.Aversion)
+	fmt.Fprintf(&buf, "ephemeralOwner = 0x%x\n", stat.EphemeralOwner)
+	fmt.Fprintf(&buf, "dataLength = %d\n", stat.DataLength)
+	fmt.Fprintf(&buf, "numChildren = %d\n", stat.NumChildren)
+	return buf.Bytes()
+}
+
+// statXAttrs are the read-only extended attributes presenting the fields of the znode stat, keyed by name, each
+// rendered as in the ZNodeStatMarker.
+var statXAttrs = map[string]func(stat *zk.Stat) string{
+	"user.zk.czxid":          func(stat *zk.Stat) string { return fmt.Sprintf("0x%x", stat.Czxid) },
+	"user.zk.ctime":          func(stat *zk.Stat) string { return statTime(stat.Ctime) },
+	"user.zk.mzxid":          func(stat *zk.Stat) string { return fmt.Sprintf("0x%x", stat.Mzxid) },
+	"user.zk.mtime":          func(stat *zk.Stat) string { return statTime(stat.Mtime) },
+	"user.zk.pzxid":          func(stat *zk.Stat) string { return fmt.Sprintf("0x%x", stat.Pzxid) },
+	"user.zk.cversion":       func(stat *zk.Stat) string { return strconv.Itoa(int(stat.Cversion)) },
+	"user.zk.version":        func(stat *zk.Stat) string { return strconv.Itoa(int(stat.Version)) },
+	"user.zk.aversion":       func(stat *zk.Stat) string { return strconv.Itoa(int(stat.Aversion)) },
+	"user.zk.ephemeralOwner": func(stat *zk.Stat) string { return fmt.Sprintf("0x%x", stat.EphemeralOwner) },
+	"user.zk.dataLength":     func(stat *zk.Stat) string { return strconv.Itoa(int(stat.DataLength)) },
+	"user.zk.numChildren":    func(stat *zk.Stat) string { return strconv.Itoa(int(stat.NumChildren)) },
+}
+
+// statXAttr returns the get function of the stat attribute rendered by `field`, reading the stat of the znode.
+func (f *FuseFS) statXAttr(field func(stat *zk.Stat) string) func(ctx context.Context, path string) ([]byte, error) {
+	return func(ctx context.Context, path string) ([]byte, error) {
+		found, stat, err := f.zh.Exists(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, zk.ErrNoNode
+		}
+		return []byte(field(stat)), nil
+	}
+}
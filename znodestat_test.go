@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestZNodeStatMarker verifies the stat marker of a directory renders the stat of the directory znode, and refuses
+// writes.
+func TestZNodeStatMarker(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{
+		Czxid:          0x10,
+		Mzxid:          0x2a,
+		Ctime:          1546300800000,
+		Mtime:          1546300800123,
+		Version:        3,
+		Cversion:       5,
+		Aversion:       1,
+		EphemeralOwner: 0x1000a1b2c3d0000,
+		DataLength:     12,
+		NumChildren:    2,
+		Pzxid:          0x2b,
+	}, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, IsReadWrite: true}
+	attr, status := fs.GetAttr("app/"+ZNodeStatMarker, nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, uint32(fuse.S_IFREG|IfRegRO), attr.Mode)
+
+	file, status := fs.Open("app/"+ZNodeStatMarker, uint32(0), nil)
+	assert.Equal(t, fuse.OK, status)
+	buf := make([]byte, attr.Size)
+	result, _ := file.Read(buf, 0)
+	data, _ := result.Bytes(buf)
+	assert.Equal(t, int(attr.Size), len(data))
+	assert.Equal(t, strings.Join([]string{
+		"cZxid = 0x10",
+		"ctime = 2019-01-01T00:00:00Z",
+		"mZxid = 0x2a",
+		"mtime = 2019-01-01T00:00:00.123Z",
+		"pZxid = 0x2b",
+		"cversion = 5",
+		"dataVersion = 3",
+		"aclVersion = 1",
+		"ephemeralOwner = 0x1000a1b2c3d0000",
+		"dataLength = 12",
+		"numChildren = 2",
+	}, "\n")+"\n", string(data))
+
+	_, status = fs.Open("app/"+ZNodeStatMarker, fuse.O_ANYWRITE, nil)
+	assert.Equal(t, fuse.EROFS, status)
+	assert.Equal(t, fuse.EROFS, fs.Unlink("app/"+ZNodeStatMarker, nil))
+}
+
+// TestZNodeStatMarkerJSON verifies the json marker format renders the stat as JSON, decoding back into the zk.Stat,
+// while the text format keeps the zkCli form.
+func TestZNodeStatMarkerJSON(t *testing.T) {
+	ctx := context.Background()
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	stat := &zk.Stat{
+		Czxid:          0x10,
+		Mzxid:          0x2a,
+		Ctime:          1546300800000,
+		Mtime:          1546300800123,
+		Version:        3,
+		Cversion:       5,
+		Aversion:       1,
+		EphemeralOwner: 0x1000a1b2c3d0000,
+		DataLength:     12,
+		NumChildren:    2,
+		Pzxid:          0x2b,
+	}
+	mockZooKeeper.zk.On("Exists", "app").Return(true, stat, nil)
+
+	fs := &FuseFS{zh: mockZooKeeper, MarkerFormat: MarkerFormatJSON}
+	data, err := fs.renderZNodeStat(ctx, "app")
+	assert.Nil(t, err)
+	var decoded zk.Stat
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, *stat, decoded)
+
+	fs.MarkerFormat = MarkerFormatText
+	data, err = fs.renderZNodeStat(ctx, "app")
+	assert.Nil(t, err)
+	assert.Equal(t, formatStat(stat), data)
+}
+
+// TestStatXAttrs verifies the stat of a znode is listed and presented through extended attributes, on files and
+// directories alike.
+func TestStatXAttrs(t *testing.T) {
+	mockZooKeeper := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	mockZooKeeper.zk.On("Exists", "app/config").Return(true, &zk.Stat{Version: 7, Czxid: 0x10, Mtime: 1546300800123}, nil)
+	mockZooKeeper.zk.On("Exists", "app").Return(true, &zk.Stat{Version: 2, NumChildren: 1}, nil)
+	mockZooKeeper.zk.On("Exists", "app/missing").Return(false, (*zk.Stat)(nil), nil)
+
+	fs := &FuseFS{zh: mockZooKeeper}
+	attrs, status := fs.ListXAttr("app/config", nil)
+	assert.Equal(t, fuse.OK, status)
+	for name := range statXAttrs {
+		assert.Contains(t, attrs, name)
+	}
+
+	for attr, value := range map[string]string{
+		"user.zk.version": "7",
+		"user.zk.czxid":   "0x10",
+		"user.zk.mtime":   "2019-01-01T00:00:00.123Z",
+	} {
+		data, status := fs.GetXAttr("app/config", attr, nil)
+		assert.Equal(t, fuse.OK, status)
+		assert.Equal(t, value, string(data), attr)
+	}
+	data, status := fs.GetXAttr("app", "user.zk.numChildren", nil)
+	assert.Equal(t, fuse.OK, status)
+	assert.Equal(t, "1", string(data))
+
+	_, status = fs.GetXAttr("app/missing", "user.zk.version", nil)
+	assert.Equal(t, fuse.ENOENT, status)
+	assert.Equal(t, fuse.EROFS, fs.SetXAttr("app/config", "user.zk.version", []byte("8"), 0, nil))
+}
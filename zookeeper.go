@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,40 +22,152 @@ const (
 	// See "jute.maxbuffer" at https://zookeeper.apache.org/doc/r3.3.3/zookeeperAdmin.html#Unsafe+Options
 	MaxZnodeData = 1048575
 
+	// MaxZnodeCeiling bounds the znode data limit configurable with `-maxznode`, for ensembles raising
+	// "jute.maxbuffer". Zookeeper itself warns against large znodes, every read and write holds them in memory whole.
+	MaxZnodeCeiling = 64 << 20
+
 	// ZNodeMarker is a special file that provides the contents of the parent znode.
 	// If a znode is deemed to be a directory (has children), the ZNodeMarker file is used
 	// as a file in order to allow access to data. Required since standard directories do not
 	// allow file content.
 	ZNodeMarker = "__znode_data__"
+
+	// DefaultSessionTimeout is the session timeout requested from the ensemble unless configured otherwise.
+	DefaultSessionTimeout = 5 * time.Second
+
+	// minSessionTimeout and maxSessionTimeout bound the session timeout negotiable with an ensemble running the
+	// default tickTime (2s), which grants between 2 and 20 ticks. Requests outside are clamped by the server.
+	minSessionTimeout = 4 * time.Second
+	maxSessionTimeout = 40 * time.Second
 )
 
-// Zoohandler defines the minimun actions required to fetch, delete and create entries in the Zookeeper directory.
+// Zoohandler defines the minimun actions required to fetch, delete and create entries in the Zookeeper directory. Each
+// call carries the context of the FUSE request it is made for, which holds the request ID logged alongside it.
 type Zoohandler interface {
 	Close()
 
 	// GetChildren Fetches all child nodes for a target Zookeeper node.
-	Children(path string) ([]string, *zk.Stat, error)
+	Children(ctx context.Context, path string) ([]string, *zk.Stat, error)
 
 	// Create, inserts a znode into the Zookeeper directory.
-	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error)
 
 	// Delete removes a single znode from the tree.
-	Delete(path string, version int32) error
+	Delete(ctx context.Context, path string, version int32) error
 
 	// Exists tests whether the znodes exits, returns boolean and if present, the zk.Stat object.
-	Exists(path string) (bool, *zk.Stat, error)
+	Exists(ctx context.Context, path string) (bool, *zk.Stat, error)
 
 	// Get retrieves a single znode entry from the directory.
-	Get(path string) ([]byte, *zk.Stat, error)
+	Get(ctx context.Context, path string) ([]byte, *zk.Stat, error)
+
+	Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error)
+
+	// GetACL retrieves the access control list of a znode.
+	GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error)
+
+	// SetACL replaces the access control list of a znode.
+	SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error)
+
+	// GetW retrieves a single znode entry, leaving a watch firing on the next change to its data.
+	GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error)
+
+	// ChildrenW fetches all child nodes of a znode, leaving a watch firing on the next change to its children.
+	ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+
+	// Sync brings the connected server up to date with the leader, ahead of a read of the znode.
+	Sync(ctx context.Context, path string) (string, error)
+}
+
+// zkConn is the connection to the ensemble wrapped by a ZooHandle.
+type zkConn interface {
+	Zoohandler
+
+	// AddAuth adds the credentials of the session, applied to every request from then on.
+	AddAuth(scheme string, auth []byte) error
+}
+
+// zkConnect establishes the connection to the ensemble, over TLS when `tlsConfig` is set. It is replaced by tests.
+var zkConnect = func(servers []string, timeout time.Duration, tlsConfig *tls.Config) (zkConn, <-chan zk.Event, error) {
+	dialer := zk.Dialer(net.DialTimeout)
+	if tlsConfig != nil {
+		dialer = tlsDialer(tlsConfig)
+	}
+	c, events, err := zk.Connect(servers, timeout, zk.WithLogger(zkLogger{}), zk.WithDialer(dialer))
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn{c}, events, nil
+}
+
+// conn adapts a zk.Conn to the Zoohandler interface. The Zookeeper client has no notion of a request context, it is
+// dropped once the call has been logged by the ZooHandle.
+type conn struct {
+	*zk.Conn
+}
+
+func (c conn) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
+	return c.Conn.Children(path)
+}
+
+func (c conn) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	return c.Conn.Create(path, data, flags, acl)
+}
+
+func (c conn) Delete(ctx context.Context, path string, version int32) error {
+	return c.Conn.Delete(path, version)
+}
+
+func (c conn) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
+	return c.Conn.Exists(path)
+}
+
+func (c conn) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
+	return c.Conn.Get(path)
+}
+
+func (c conn) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	return c.Conn.Set(path, data, version)
+}
+
+func (c conn) GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error) {
+	return c.Conn.GetACL(path)
+}
+
+func (c conn) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	return c.Conn.SetACL(path, acl, version)
+}
+
+func (c conn) GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	return c.Conn.GetW(path)
+}
+
+func (c conn) ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	return c.Conn.ChildrenW(path)
+}
+
+func (c conn) Sync(ctx context.Context, path string) (string, error) {
+	return c.Conn.Sync(path)
+}
+
+// zkLogger hands the messages of the Zookeeper client to our logger, among them the session timeout negotiated with
+// the ensemble once connected.
+type zkLogger struct{}
 
-	Set(path string, data []byte, version int32) (*zk.Stat, error)
+func (zkLogger) Printf(format string, args ...interface{}) {
+	log.WithFields(log.Fields{
+		"source": "zookeeper",
+	}).Infof(format, args...)
 }
 
 // ZooHandle functions implement the Zoohandler interface. This orchestrates all communication to the Zookeeper directory.
 type ZooHandle struct {
-	zk        Zoohandler // Connection object to ZK
-	ZKRoot    string     // chroot/alias the root of the zookeeper directory to an alternate location (default is /).
-	FuseMount string     // the full pathname of the fuse mounted filesystem
+	zk        Zoohandler  // Connection object to ZK, superseded by the current connection of `shared` when pooled
+	ZKRoot    string      // chroot/alias the root of the zookeeper directory to an alternate location (default is /).
+	FuseMount string      // the full pathname of the fuse mounted filesystem
+	acls      *aclCache   // optional cache of znode ACLs, nil when disabled
+	shared    *sharedConn // pooled connection `zk` was acquired from, nil when not pooled
+	MaxData   int         // largest znode data accepted by Set, the "jute.maxbuffer" of the ensemble (MaxZnodeData when 0)
 }
 
 // ZKPath performs the translation from a fuse directory/file path to a path suitable for the Zookeeper tree. Additionally
@@ -70,70 +187,161 @@ func (z *ZooHandle) ZKPath(path string) string {
 	return filepath.Join(string(os.PathSeparator), z.ZKRoot, rel)
 }
 
-// Close releases the Zookeeper connection.
+// maxData returns the largest znode data accepted by Set.
+func (z *ZooHandle) maxData() int {
+	if z.MaxData > 0 {
+		return z.MaxData
+	}
+	return MaxZnodeData
+}
+
+// WaitForSession blocks until the connection has established a session with Zookeeper.
+func (z *ZooHandle) WaitForSession() error {
+	select {
+	case <-z.shared.session:
+		return nil
+	case <-z.shared.closed:
+		return errors.New("connection closed before a session was established")
+	}
+}
+
+// conn returns the connection requests are sent over. A pooled connection is read under its lock, as it is swapped
+// for a new one once the session expires.
+func (z *ZooHandle) conn() Zoohandler {
+	if z.shared == nil {
+		return z.zk
+	}
+	return z.shared.current()
+}
+
+// Close releases the Zookeeper connection. A pooled connection is only closed once no other ZooHandle uses it.
 func (z *ZooHandle) Close() {
-	z.zk.Close()
+	if z.shared == nil {
+		z.zk.Close()
+		return
+	}
+	connections.release(z.shared)
+	z.shared = nil
 }
 
 // Delete the node with the given path
-func (z *ZooHandle) Delete(path string, version int32) error {
+func (z *ZooHandle) Delete(ctx context.Context, path string, version int32) error {
 	path = z.ZKPath(path)
-	log.WithFields(log.Fields{
+	log.WithFields(traceFields(ctx, log.Fields{
 		"path": path,
-	}).Debug("")
-	return z.zk.Delete(path, version)
+	})).Debug("")
+	return z.conn().Delete(ctx, path, version)
 }
 
 // Create a node with the given path
-func (z *ZooHandle) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+func (z *ZooHandle) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
 	path = z.ZKPath(path)
-	log.WithFields(log.Fields{
+	log.WithFields(traceFields(ctx, log.Fields{
 		"path":  path,
 		"data":  data,
 		"flags": flags,
 		"acl":   acl,
-	}).Debug("")
-	return z.zk.Create(path, data, flags, acl)
+	})).Debug("")
+	return z.conn().Create(ctx, path, data, flags, acl)
 }
 
 // Children returns the given children list and the stat of the znode path
-func (z *ZooHandle) Children(path string) ([]string, *zk.Stat, error) {
+func (z *ZooHandle) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
 	path = z.ZKPath(path)
-	log.WithFields(log.Fields{
+	log.WithFields(traceFields(ctx, log.Fields{
 		"path": path,
-	}).Debug("")
-	return z.zk.Children(path)
+	})).Debug("")
+	return z.conn().Children(ctx, path)
 }
 
 // Exists returns a bool based on the presence of the znode. Since it also returns the zk.Stat it is the preferred call for
 // light(er)weight state checking against ZK (instead of say zk.Get(..), which includes the data payload)
-func (z *ZooHandle) Exists(path string) (bool, *zk.Stat, error) {
+func (z *ZooHandle) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
 	path = z.ZKPath(path)
-	log.WithFields(log.Fields{
+	log.WithFields(traceFields(ctx, log.Fields{
 		"path": path,
-	}).Debug("")
-	return z.zk.Exists(path)
+	})).Debug("")
+	return z.conn().Exists(ctx, path)
 }
 
 // Get return the data and the stat of the node of the given path.
-func (z *ZooHandle) Get(path string) ([]byte, *zk.Stat, error) {
+func (z *ZooHandle) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
 	path = z.ZKPath(path)
-	log.WithFields(log.Fields{
+	log.WithFields(traceFields(ctx, log.Fields{
+		"path": path,
+	})).Debug("")
+	return z.conn().Get(ctx, path)
+}
+
+// GetW returns the data and the stat of the node of the given path, along with a watch on its data.
+func (z *ZooHandle) GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	path = z.ZKPath(path)
+	log.WithFields(traceFields(ctx, log.Fields{
+		"path": path,
+	})).Debug("")
+	return z.conn().GetW(ctx, path)
+}
+
+// ChildrenW returns the children list and the stat of the znode path, along with a watch on its children.
+func (z *ZooHandle) ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	path = z.ZKPath(path)
+	log.WithFields(traceFields(ctx, log.Fields{
+		"path": path,
+	})).Debug("")
+	return z.conn().ChildrenW(ctx, path)
+}
+
+// Sync flushes the channel between the connected server and the leader for the node of the given path.
+func (z *ZooHandle) Sync(ctx context.Context, path string) (string, error) {
+	path = z.ZKPath(path)
+	log.WithFields(traceFields(ctx, log.Fields{
 		"path": path,
-	}).Debug("")
-	return z.zk.Get(path)
+	})).Debug("")
+	return z.conn().Sync(ctx, path)
 }
 
 // Set writes data into a target znode of the given path.
-func (z *ZooHandle) Set(path string, data []byte, version int32) (*zk.Stat, error) {
-	if len(data) > MaxZnodeData {
-		return nil, fmt.Errorf("length of data payload exceeds allowable limit (%d)", MaxZnodeData)
+func (z *ZooHandle) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
+	if len(data) > z.maxData() {
+		return nil, fmt.Errorf("length of data payload exceeds allowable limit (%d)", z.maxData())
 	}
 	path = z.ZKPath(path)
-	log.WithFields(log.Fields{
+	log.WithFields(traceFields(ctx, log.Fields{
+		"path": path,
+	})).Debug("")
+	return z.conn().Set(ctx, path, data, version)
+}
+
+// GetACL returns the ACL of the node of the given path. When ACL caching is enabled a cached copy is returned
+// until it expires.
+func (z *ZooHandle) GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error) {
+	path = z.ZKPath(path)
+	if z.acls != nil {
+		if acl, ok := z.acls.get(path); ok {
+			return acl, nil, nil
+		}
+	}
+	log.WithFields(traceFields(ctx, log.Fields{
 		"path": path,
-	}).Debug("")
-	return z.zk.Set(path, data, version)
+	})).Debug("")
+	acl, stat, err := z.conn().GetACL(ctx, path)
+	if err == nil && z.acls != nil {
+		z.acls.put(path, acl)
+	}
+	return acl, stat, err
+}
+
+// SetACL replaces the ACL of the node of the given path, invalidating any cached copy.
+func (z *ZooHandle) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	path = z.ZKPath(path)
+	log.WithFields(traceFields(ctx, log.Fields{
+		"path": path,
+		"acl":  acl,
+	})).Debug("")
+	if z.acls != nil {
+		z.acls.invalidate(path)
+	}
+	return z.conn().SetACL(ctx, path, acl, version)
 }
 
 // MockZooHandle provides a struct with functions that implement the ZooHandle interface, providing capabability to stub out the
@@ -150,47 +358,172 @@ func (m *MockZooHandle) Close() {
 }
 
 // Children mocks Zoohandler.Children
-func (m *MockZooHandle) Children(path string) ([]string, *zk.Stat, error) {
+func (m *MockZooHandle) Children(ctx context.Context, path string) ([]string, *zk.Stat, error) {
 	args := m.zk.Called(path)
 	return args.Get(0).([]string), args.Get(1).(*zk.Stat), args.Error(2)
 }
 
 // Get mocks Zoohandler.Get
-func (m *MockZooHandle) Get(path string) ([]byte, *zk.Stat, error) {
+func (m *MockZooHandle) Get(ctx context.Context, path string) ([]byte, *zk.Stat, error) {
 	args := m.zk.Called(path)
 	return args.Get(0).([]byte), args.Get(1).(*zk.Stat), args.Error(2)
 }
 
 // Create mocks Zoohandler.Create
-func (m *MockZooHandle) Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+func (m *MockZooHandle) Create(ctx context.Context, path string, data []byte, flags int32, acl []zk.ACL) (string, error) {
 	args := m.zk.Called(path, data, flags, acl)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockZooHandle) Delete(path string, version int32) error {
+func (m *MockZooHandle) Delete(ctx context.Context, path string, version int32) error {
 	args := m.zk.Called(path)
 	return args.Error(0)
 }
 
-func (m *MockZooHandle) Exists(path string) (bool, *zk.Stat, error) {
+func (m *MockZooHandle) Exists(ctx context.Context, path string) (bool, *zk.Stat, error) {
 	args := m.zk.Called(path)
 	return args.Bool(0), args.Get(1).(*zk.Stat), args.Error(2)
 }
 
-func (m *MockZooHandle) Set(path string, data []byte, version int32) (*zk.Stat, error) {
+func (m *MockZooHandle) Set(ctx context.Context, path string, data []byte, version int32) (*zk.Stat, error) {
 	args := m.zk.Called(path, data, version)
 	return args.Get(0).(*zk.Stat), args.Error(1)
 }
 
-func NewZooHandler(zkConnection []string, zkRoot, fuseMount string) (*ZooHandle, error) {
-	c, _, err := zk.Connect(zkConnection, 5*time.Second)
+// GetACL mocks Zoohandler.GetACL
+func (m *MockZooHandle) GetACL(ctx context.Context, path string) ([]zk.ACL, *zk.Stat, error) {
+	args := m.zk.Called(path)
+	return args.Get(0).([]zk.ACL), args.Get(1).(*zk.Stat), args.Error(2)
+}
+
+// SetACL mocks Zoohandler.SetACL
+func (m *MockZooHandle) SetACL(ctx context.Context, path string, acl []zk.ACL, version int32) (*zk.Stat, error) {
+	args := m.zk.Called(path, acl, version)
+	return args.Get(0).(*zk.Stat), args.Error(1)
+}
+
+// GetW mocks Zoohandler.GetW
+func (m *MockZooHandle) GetW(ctx context.Context, path string) ([]byte, *zk.Stat, <-chan zk.Event, error) {
+	args := m.zk.Called(path)
+	return args.Get(0).([]byte), args.Get(1).(*zk.Stat), args.Get(2).(<-chan zk.Event), args.Error(3)
+}
+
+// ChildrenW mocks Zoohandler.ChildrenW
+func (m *MockZooHandle) ChildrenW(ctx context.Context, path string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	args := m.zk.Called(path)
+	return args.Get(0).([]string), args.Get(1).(*zk.Stat), args.Get(2).(<-chan zk.Event), args.Error(3)
+}
+
+// Sync mocks Zoohandler.Sync
+func (m *MockZooHandle) Sync(ctx context.Context, path string) (string, error) {
+	args := m.zk.Called(path)
+	return args.String(0), args.Error(1)
+}
+
+// AddAuth mocks zkConn.AddAuth
+func (m *MockZooHandle) AddAuth(scheme string, auth []byte) error {
+	args := m.zk.Called(scheme, auth)
+	return args.Error(0)
+}
+
+// NewZooHandler connects to the ensemble requesting sessions of `timeout`, authenticating the session with each of the
+// `user:password` digest credentials given in `auth`. A session which cannot be authenticated is closed and an error
+// returned, rather than handing back a connection every request of which would be refused. ZooHandles connecting to
+// the same ensemble with the same credentials and timeout share a single connection (see connPool). A `zkRoot`
+// missing from the ensemble is refused the same way, unless `createRoot` is set in which case it is created.
+func NewZooHandler(zkConnection []string, zkRoot, fuseMount string, auth []string, timeout time.Duration, createRoot bool) (*ZooHandle, error) {
+	for _, cred := range auth {
+		if !strings.Contains(cred, ":") {
+			return nil, fmt.Errorf("invalid auth for %s, expected user:password", authUser(cred))
+		}
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid session timeout %s, expected a positive duration", timeout)
+	}
+	if timeout < minSessionTimeout || timeout > maxSessionTimeout {
+		log.WithFields(log.Fields{
+			"timeout": timeout,
+			"min":     minSessionTimeout,
+			"max":     maxSessionTimeout,
+		}).Warn("session timeout outside the range negotiable with the default tickTime, the ensemble may clamp it")
+	}
 
+	shared, err := connections.acquire(zkConnection, auth, timeout)
 	if err != nil {
 		return nil, err
 	}
-	return &ZooHandle{
-		zk:        c,
+	zh := &ZooHandle{
+		zk:        shared.conn,
 		ZKRoot:    zkRoot,
 		FuseMount: fuseMount,
-	}, nil
+		shared:    shared,
+	}
+	if err := zh.checkRoot(createRoot); err != nil {
+		zh.Close()
+		return nil, err
+	}
+	return zh, nil
+}
+
+// checkRoot verifies the ZKRoot exists, as every path of the mount resolves beneath it. A missing root is created
+// along with its ancestors with `createRoot`, and reported as an error otherwise.
+func (z *ZooHandle) checkRoot(createRoot bool) error {
+	root := z.ZKPath("")
+	if root == "/" {
+		return nil
+	}
+	ctx := context.Background()
+	found, _, err := z.conn().Exists(ctx, root)
+	if err != nil {
+		return fmt.Errorf("unable to check zkroot %s: %v", root, err)
+	}
+	if found {
+		return nil
+	}
+	if !createRoot {
+		return fmt.Errorf("zkroot %s does not exist, create it or pass -create-root", root)
+	}
+
+	parts := strings.Split(root, "/")
+	for i := 2; i <= len(parts); i++ {
+		ancestor := strings.Join(parts[:i], "/")
+		if _, err := z.conn().Create(ctx, ancestor, []byte{}, 0, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+			return fmt.Errorf("unable to create zkroot %s: %v", ancestor, err)
+		}
+	}
+	log.WithFields(log.Fields{
+		"zkroot": root,
+	}).Info("created missing zkroot")
+	return nil
+}
+
+// authUser returns the user of a `user:password` credential, safe to be logged.
+func authUser(cred string) string {
+	if i := strings.Index(cred, ":"); i >= 0 {
+		return cred[:i]
+	}
+	return "<redacted>"
+}
+
+// ParseZKConn splits a comma separated connection string into the servers of the ensemble. Each server is given as
+// host:port, or as a bare host using the default Zookeeper port.
+func ParseZKConn(conn string) ([]string, error) {
+	var servers []string
+	for _, server := range strings.Split(conn, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			return nil, fmt.Errorf("invalid zkconn %q, empty server entry", conn)
+		}
+		if strings.Contains(server, ":") {
+			host, port, err := net.SplitHostPort(server)
+			if err != nil {
+				return nil, fmt.Errorf("invalid zkconn server %q: %v", server, err)
+			}
+			if n, err := strconv.Atoi(port); host == "" || err != nil || n < 1 || n > 65535 {
+				return nil, fmt.Errorf("invalid zkconn server %q, expected host:port", server)
+			}
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
 }
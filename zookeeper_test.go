@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -32,3 +38,162 @@ func TestZKPath(t *testing.T) {
 	assert.Equal(t, "/chroot/test-path/sub-node", zh.ZKPath("test-path/sub-node"))
 	assert.Equal(t, "/chroot/test-path/sub-node", zh.ZKPath("test-path/sub-node"+"/"+ZNodeMarker))
 }
+
+// TestSetMaxData verifies Set accepts data up to the configured znode limit and refuses larger data without a round
+// trip, while the default limit is MaxZnodeData.
+func TestSetMaxData(t *testing.T) {
+	ctx := context.Background()
+	mockClient := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	zh := ZooHandle{zk: mockClient, ZKRoot: "/", FuseMount: "/mnt/fuse", MaxData: 16}
+
+	under := make([]byte, 16)
+	mockClient.zk.On("Set", "/app", under, int32(-1)).Return(&zk.Stat{DataLength: 16}, nil)
+	_, err := zh.Set(ctx, "app", under, -1)
+	assert.Nil(t, err)
+
+	_, err = zh.Set(ctx, "app", make([]byte, 17), -1)
+	assert.Error(t, err)
+	mockClient.zk.AssertNumberOfCalls(t, "Set", 1)
+
+	// a raised limit accepts data past the default.
+	zh.MaxData = 2 * MaxZnodeData
+	over := make([]byte, MaxZnodeData+1)
+	mockClient.zk.On("Set", "/app", over, int32(-1)).Return(&zk.Stat{DataLength: int32(len(over))}, nil)
+	_, err = zh.Set(ctx, "app", over, -1)
+	assert.Nil(t, err)
+
+	zh.MaxData = 0
+	_, err = zh.Set(ctx, "app", over, -1)
+	assert.Error(t, err)
+	mockClient.zk.AssertNumberOfCalls(t, "Set", 2)
+}
+
+// fakeConnect replaces zkConnect for the duration of a test, handing out `conn`.
+func fakeConnect(conn *MockZooHandle) func() {
+	orig := zkConnect
+	zkConnect = func(servers []string, timeout time.Duration, tlsConfig *tls.Config) (zkConn, <-chan zk.Event, error) {
+		return conn, make(chan zk.Event), nil
+	}
+	return func() { zkConnect = orig }
+}
+
+// TestNewZooHandlerAuth verifies each digest credential is added to the session.
+func TestNewZooHandlerAuth(t *testing.T) {
+	conn := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	conn.zk.On("AddAuth", "digest", []byte("alice:secret")).Return(nil)
+	conn.zk.On("AddAuth", "digest", []byte("bob:hunter2")).Return(nil)
+	conn.zk.On("Close").Return()
+	defer fakeConnect(conn)()
+
+	zh, err := NewZooHandler([]string{"zk1:2181"}, "/", "/mnt/fuse", []string{"alice:secret", "bob:hunter2"}, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	zh.Close()
+	conn.zk.AssertExpectations(t)
+}
+
+// TestNewZooHandlerAuthFailure verifies a session which cannot be authenticated is closed and reported, without
+// revealing the password.
+func TestNewZooHandlerAuthFailure(t *testing.T) {
+	conn := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	conn.zk.On("AddAuth", "digest", []byte("alice:secret")).Return(errors.New("auth failed"))
+	conn.zk.On("Close").Return()
+	defer fakeConnect(conn)()
+
+	_, err := NewZooHandler([]string{"zk1:2181"}, "/", "/mnt/fuse", []string{"alice:secret"}, DefaultSessionTimeout, false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "alice")
+	assert.NotContains(t, err.Error(), "secret")
+	conn.zk.AssertCalled(t, "Close")
+
+	_, err = NewZooHandler([]string{"zk1:2181"}, "/", "/mnt/fuse", []string{"alice"}, DefaultSessionTimeout, false)
+	assert.NotNil(t, err)
+	conn.zk.AssertNumberOfCalls(t, "AddAuth", 1)
+}
+
+// TestNewZooHandlerTimeout verifies the session timeout is forwarded to the connect call, and a non-positive timeout
+// is refused.
+func TestNewZooHandlerTimeout(t *testing.T) {
+	conn := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	conn.zk.On("Close").Return()
+	var requested time.Duration
+	orig := zkConnect
+	zkConnect = func(servers []string, timeout time.Duration, tlsConfig *tls.Config) (zkConn, <-chan zk.Event, error) {
+		requested = timeout
+		return conn, make(chan zk.Event), nil
+	}
+	defer func() { zkConnect = orig }()
+
+	zh, err := NewZooHandler([]string{"zk1:2181"}, "/", "/mnt/fuse", nil, 12*time.Second, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 12*time.Second, requested)
+	zh.Close()
+
+	_, err = NewZooHandler([]string{"zk1:2181"}, "/", "/mnt/fuse", nil, 0, false)
+	assert.NotNil(t, err)
+}
+
+// TestNewZooHandlerMissingRoot verifies a zkroot missing from the ensemble is refused, closing the connection,
+// unless createRoot is set in which case it is created along with its ancestors.
+func TestNewZooHandlerMissingRoot(t *testing.T) {
+	conn := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	conn.zk.On("Exists", "/apps/billing").Return(false, (*zk.Stat)(nil), nil)
+	conn.zk.On("Create", "/apps", []byte{}, int32(0), zk.WorldACL(zk.PermAll)).Return("", zk.ErrNodeExists)
+	conn.zk.On("Create", "/apps/billing", []byte{}, int32(0), zk.WorldACL(zk.PermAll)).Return("/apps/billing", nil)
+	conn.zk.On("Close").Return()
+	defer fakeConnect(conn)()
+
+	_, err := NewZooHandler([]string{"zk1:2181"}, "/apps/billing", "/mnt/fuse", nil, DefaultSessionTimeout, false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "/apps/billing")
+	conn.zk.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	conn.zk.AssertNumberOfCalls(t, "Close", 1)
+
+	zh, err := NewZooHandler([]string{"zk1:2181"}, "/apps/billing", "/mnt/fuse", nil, DefaultSessionTimeout, true)
+	assert.Nil(t, err)
+	conn.zk.AssertCalled(t, "Create", "/apps/billing", []byte{}, int32(0), zk.WorldACL(zk.PermAll))
+	zh.Close()
+}
+
+// TestNewZooHandlerRoot verifies an existing zkroot is accepted as is, and the root of the tree is never checked.
+func TestNewZooHandlerRoot(t *testing.T) {
+	conn := &MockZooHandle{
+		zk: mock.Mock{},
+	}
+	conn.zk.On("Exists", "/apps").Return(true, &zk.Stat{}, nil)
+	conn.zk.On("Close").Return()
+	defer fakeConnect(conn)()
+
+	zh, err := NewZooHandler([]string{"zk1:2181"}, "/apps", "/mnt/fuse", nil, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	zh.Close()
+	zh, err = NewZooHandler([]string{"zk1:2181"}, "/", "/mnt/fuse", nil, DefaultSessionTimeout, false)
+	assert.Nil(t, err)
+	zh.Close()
+	conn.zk.AssertNumberOfCalls(t, "Exists", 1)
+	conn.zk.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestParseZKConn(t *testing.T) {
+	servers, err := ParseZKConn("zk1:2181")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"zk1:2181"}, servers)
+
+	servers, err = ParseZKConn(" zk1:2181, zk2:2182 ,zk3")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"zk1:2181", "zk2:2182", "zk3"}, servers)
+
+	for _, invalid := range []string{"", "zk1:2181,", "zk1:2181,,zk2:2181", "zk1:port", "zk1:0", ":2181", "zk1:2181:2182"} {
+		_, err := ParseZKConn(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}